@@ -52,6 +52,23 @@ func processInput(command string, client *TextOverHttpClient) bool {
 		return false
 	}
 
+	if strings.HasPrefix(command, "Auth ") {
+		if !client.isConnected {
+			fmt.Println("Please connect to server first (example: Connect http://servername:port/)")
+			return false
+		}
+		credentials := strings.Fields(command[len("Auth "):])
+		switch len(credentials) {
+		case 1:
+			client.transport = client.transport.WithCredentials(goodies.Credentials{Token: credentials[0]})
+		case 2:
+			client.transport = client.transport.WithCredentials(goodies.Credentials{Username: credentials[0], Password: credentials[1]})
+		default:
+			fmt.Println("Auth is expected to have a token or username and password (example: Auth reporting secret)")
+		}
+		return false
+	}
+
 	if !client.isConnected {
 		fmt.Println("Please connect to server first (example: Connect http://servername:port/)")
 		return false
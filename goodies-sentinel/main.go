@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"goodies/goodies"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	interval := flag.Duration("interval", time.Second, "interval between health checks")
+	downAfter := flag.Int("down-after", 3, "number of failed checks before leader is considered down")
+	token := flag.String("token", os.Getenv("GOODIES_SENTINEL_TOKEN"), "API token presented to the nodes (env GOODIES_SENTINEL_TOKEN)")
+	caFile := flag.String("ca", "", "PEM bundle of CAs verifying nodes served over TLS, system roots if empty")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %v [flags] http://node1:9006/ http://node2:9006/ ...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var options []goodies.ClientOption
+	if *token != "" {
+		options = append(options, goodies.WithToken(*token))
+	}
+	if *caFile != "" {
+		roots, err := loadCAs(*caFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error", err)
+			os.Exit(2)
+		}
+		options = append(options, goodies.WithTLSConfig(&tls.Config{RootCAs: roots}))
+	}
+	sentinel, err := goodies.NewSentinel(flag.Args(), *interval, *downAfter, options...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error", err)
+		os.Exit(2)
+	}
+	sentinel.Check()
+	fmt.Println("Monitoring:", flag.Args(), "leader:", sentinel.Leader())
+	sentinel.Start()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	<-signals
+	fmt.Println("Exiting...")
+	sentinel.Stop()
+}
+
+// loadCAs Reads a PEM bundle of CA certificates
+func loadCAs(filename string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %v", filename)
+	}
+	return roots, nil
+}
@@ -2,9 +2,16 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"flag"
 	"fmt"
 	"goodies/goodies"
+	"io"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 )
 
@@ -13,19 +20,123 @@ func formatError(err string) string {
 }
 
 func main() {
-	server := goodies.NewGoodiesHttpServer("9006", 1*time.Minute, "./goodies.dat", 30*time.Second)
-	fmt.Println("Listening on: 0.0.0.0:9006")
-	go server.ListenAndServe()
+	options, err := goodies.LoadServerConfig(os.Args[1:], os.LookupEnv)
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, formatError(err.Error()))
+		os.Exit(2)
+	}
+	config := options.Config
+	if options.HashSecret != "" {
+		if err := printHash(options.HashSecret); err != nil {
+			fmt.Fprintln(os.Stderr, formatError(err.Error()))
+			os.Exit(1)
+		}
+		return
+	}
+	if options.PrintConfig {
+		config.Print(os.Stdout)
+		return
+	}
+	if config.Log.File != "" {
+		logFile, err := os.OpenFile(config.Log.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, formatError(err.Error()))
+			os.Exit(1)
+		}
+		defer logFile.Close()
+		// goodies reports through stdout, so it is redirected as a whole
+		os.Stdout = logFile
+	}
 
-	fmt.Println("Enter any text to exit")
-	reader := bufio.NewReader(os.Stdin)
-	_, _, err := reader.ReadRune()
+	server, storage, err := goodies.NewGoodiesConfiguredServer(config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, formatError(err.Error()))
+		os.Exit(2)
+	}
+	served, err := goodies.ServeConfiguredServer(server, config)
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, formatError(err.Error()))
+		stop(storage)
+		os.Exit(1)
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	fmt.Println("Listening on:", strings.Join(config.ListenAddresses(), ", "))
+
+	for {
+		select {
+		case err := <-served:
+			fmt.Println(formatError(err.Error()))
+			shutdown(server, time.Duration(config.ShutdownTimeout))
+			stop(storage)
+			os.Exit(1)
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				config = reload(server, storage, config)
+				continue
+			}
+			fmt.Println("Exiting...")
+			shutdown(server, time.Duration(config.ShutdownTimeout))
+			stop(storage)
+			fmt.Println("Bye")
+			return
+		}
 	}
+}
 
-	fmt.Println("Exiting...")
-	server.Shutdown(nil)
-	<-time.After(5 * time.Second)
-	fmt.Println("Bye")
+// reload Reads the configuration again (flags given on start still take precedence) and applies it
+func reload(server *http.Server, storage goodies.Provider, current goodies.ServerConfig) goodies.ServerConfig {
+	options, err := goodies.LoadServerConfig(os.Args[1:], os.LookupEnv)
+	if err != nil {
+		fmt.Println("Configuration not reloaded:", formatError(err.Error()))
+		return current
+	}
+	if restart := goodies.ReconfigureServer(server, storage, current, options.Config); len(restart) > 0 {
+		fmt.Println("Configuration reloaded, changes of", restart, "take effect after restart")
+	} else {
+		fmt.Println("Configuration reloaded")
+	}
+	return options.Config
+}
+
+// printHash Reads a secret from the first line of stdin and prints its hash for the auth config
+func printHash(kind string) error {
+	secret, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	secret = strings.TrimRight(secret, "\r\n")
+	if secret == "" {
+		return fmt.Errorf("secret is expected on stdin")
+	}
+	if kind == "token" {
+		fmt.Println(goodies.HashToken(secret))
+		return nil
+	}
+	hash, err := goodies.HashPassword(secret)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+	return nil
+}
+
+// shutdown Stops accepting connections and waits for in-flight requests until timeout
+func shutdown(server *http.Server, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := goodies.ShutdownServer(ctx, server); err != nil {
+		fmt.Println("Requests still in flight are dropped:", err)
+		server.Close()
+	}
+}
+
+// stop Flushes persisted storage
+func stop(storage goodies.Provider) {
+	if stoppable, ok := storage.(goodies.StoppableProvider); ok {
+		stoppable.Stop()
+	}
 }
@@ -1,9 +1,12 @@
 package goodies
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 )
 
@@ -11,9 +14,31 @@ import (
 // Name would be the same as the method name exposed by goodies.Provider interface
 // Parameters would be the method parameters respectively
 // (ttl would be sent in seconds as string or as ExpireDefault/ExpireNever)
+// Asking is set by cluster clients following ErrAsk redirect to a slot being imported
+// Tracking is the id of near cache client which has to be notified once the read key changes
+// Database is the name of the logical database the command runs against, empty for DefaultDatabase
 type CommandRequest struct {
 	Name       string
 	Parameters []string
+	Asking     bool   `json:",omitempty"`
+	Tracking   string `json:",omitempty"`
+	Database   string `json:",omitempty"`
+
+	ctx context.Context
+}
+
+// Context Returns the request context, servers cancel it once the client is gone
+func (req CommandRequest) Context() context.Context {
+	if req.ctx != nil {
+		return req.ctx
+	}
+	return context.Background()
+}
+
+// WithContext Returns a copy of the request bound to ctx
+func (req CommandRequest) WithContext(ctx context.Context) CommandRequest {
+	req.ctx = ctx
+	return req
 }
 
 // CommandResponse Command like class that is returned as a result of command execution
@@ -31,12 +56,127 @@ type CommandProcesser interface {
 	HandleCommand(req CommandRequest) CommandResponse
 }
 
+// mutatingCommands Commands changing storage content, these are replicated and rejected by followers
+var mutatingCommands = map[string]bool{
+	"Set":             true,
+	"Update":          true,
+	"Remove":          true,
+	"ListPush":        true,
+	"ListRemoveIndex": true,
+	"ListRemoveValue": true,
+	"DictSet":         true,
+	"DictRemove":      true,
+	"SetExpiry":       true,
+	"Restore":         true,
+	"LockAcquire":     true,
+	"LockRenew":       true,
+	"LockRelease":     true,
+
+	"RateLimitTokenBucket":   true,
+	"RateLimitSlidingWindow": true,
+
+	"QueueEnqueue":     true,
+	"QueueDequeue":     true,
+	"QueueAck":         true,
+	"QueueNack":        true,
+	"QueueMaxAttempts": true,
+
+	"ScheduleAdd":    true,
+	"ScheduleCancel": true,
+
+	"FlushAll": true,
+
+	"DatabaseCreate": true,
+	"DatabaseFlush":  true,
+	"DatabaseSwap":   true,
+
+	"QuotaSet":    true,
+	"QuotaRemove": true,
+
+	"ACLSet":    true,
+	"ACLRemove": true,
+}
+
+// serverCommands Commands managing the server as a whole, they run against the default database whichever is selected
+var serverCommands = map[string]bool{
+	"ReplicaOf":         true,
+	"Role":              true,
+	"ClusterEnable":     true,
+	"ClusterSetSlots":   true,
+	"ClusterSetSlot":    true,
+	"ClusterSlots":      true,
+	"ClusterKeysInSlot": true,
+	"Migrate":           true,
+	"ScheduleAdd":       true,
+	"ScheduleCancel":    true,
+	"ScheduleList":      true,
+	"Save":              true,
+	"BgSave":            true,
+	"LastSave":          true,
+	"FlushAll":          true,
+	"DatabaseList":      true,
+	"DatabaseCreate":    true,
+	"DatabaseFlush":     true,
+	"DatabaseSwap":      true,
+	"QuotaSet":          true,
+	"QuotaRemove":       true,
+	"QuotaUsage":        true,
+	"ACLSet":            true,
+	"ACLRemove":         true,
+	"ACLList":           true,
+}
+
+// keyedCommands Commands addressing a single key passed as the first parameter
+var keyedCommands = map[string]bool{
+	"Set":             true,
+	"Get":             true,
+	"Update":          true,
+	"Remove":          true,
+	"ListPush":        true,
+	"ListLen":         true,
+	"ListGetByIndex":  true,
+	"ListGetAll":      true,
+	"ListRemoveIndex": true,
+	"ListRemoveValue": true,
+	"DictSet":         true,
+	"DictGet":         true,
+	"DictRemove":      true,
+	"DictHasKey":      true,
+	"SetExpiry":       true,
+	"Dump":            true,
+	"Restore":         true,
+	"LockAcquire":     true,
+	"LockRenew":       true,
+	"LockRelease":     true,
+
+	"RateLimitTokenBucket":   true,
+	"RateLimitSlidingWindow": true,
+
+	"QueueEnqueue":     true,
+	"QueueDequeue":     true,
+	"QueueAck":         true,
+	"QueueNack":        true,
+	"QueueMaxAttempts": true,
+	"QueueStats":       true,
+}
+
 // goodiesCommandProcessor Generic command processor class
 // helping to wrap command processing to the storage and back
 // mediates commands to provider
 type goodiesCommandProcessor struct {
 	storage         Provider
 	commandHandlers map[string]func(command CommandRequest, storage Provider) CommandResponse
+	pubsub          *PubSub
+	replication     *replication
+	cluster         *cluster
+	tracking        *tracking
+	quotas          *quotas
+	memory          *memoryLimit
+	// stopping is closed to stop executing scheduled commands, scheduling is done once the scheduler returns
+	stopping   chan struct{}
+	stopOnce   sync.Once
+	startOnce  sync.Once
+	scheduling sync.WaitGroup
 }
 
 func (gcp *goodiesCommandProcessor) addCommandHandler(
@@ -46,16 +186,88 @@ func (gcp *goodiesCommandProcessor) addCommandHandler(
 	gcp.commandHandlers[name] = handler
 }
 
-func (gcp *goodiesCommandProcessor) HandleCommand(req CommandRequest) CommandResponse {
+func (gcp *goodiesCommandProcessor) HandleCommand(req CommandRequest) (res CommandResponse) {
 	defer func() {
 		if r := recover(); r != nil {
+			res = createErrorResult(ErrInternalError{fmt.Sprintf("Command %v failed: %v", req.Name, r)})
 		}
 	}()
 	handler, ok := gcp.commandHandlers[req.Name]
 	if !ok {
 		return createErrorResult(ErrUnknownCommand{req.Name})
 	}
-	return handler(req, gcp.storage)
+	if err := gcp.authorize(req); err != nil {
+		return createErrorResult(err)
+	}
+	storage, err := gcp.database(req)
+	if err != nil {
+		return createErrorResult(err)
+	}
+	// keys evicted to make room for the command, replicated even if it fails
+	var evicted []CommandRequest
+	execute := func() CommandResponse {
+		// commands of aborted requests (e.g. waiting for a write) are not executed
+		if err := req.Context().Err(); err != nil {
+			return createErrorResult(ErrInternalError{fmt.Sprintf("Command %v aborted: %v", req.Name, err)})
+		}
+		// checked together with the write so a concurrent Migrate cannot move the key in between
+		if keyedCommands[req.Name] && len(req.Parameters) > 0 {
+			if err := gcp.cluster.checkKey(req.Parameters[0], req.Asking, storage); err != nil {
+				return createErrorResult(err)
+			}
+		}
+		// only the default database is tracked for near caches
+		if req.Tracking != "" && cacheableCommands[req.Name] && len(req.Parameters) > 0 && storage == gcp.storage {
+			gcp.tracking.track(req.Parameters[0], req.Tracking)
+		}
+		quotas := matchingQuotas(gcp.quotaDefinitions(), req)
+		if err := gcp.quotas.check(quotas, req, storage); err != nil {
+			return createErrorResult(err)
+		}
+		if evicted, err = gcp.memory.reserve(req, gcp.storage, storage); err != nil {
+			return createErrorResult(err)
+		}
+		return handler(req, storage)
+	}
+	if mutatingCommands[req.Name] {
+		return gcp.replication.write(func() (CommandResponse, []CommandRequest) {
+			effect := replicatesEffect(req, storage)
+			res := execute()
+			if !res.Success {
+				return res, evicted
+			}
+			if effect {
+				return res, append(evicted, effects(req, storage)...)
+			}
+			return res, append(evicted, req)
+		})
+	}
+	return execute()
+}
+
+// handleReplicated Executes a write command received from the leader
+func (gcp *goodiesCommandProcessor) handleReplicated(req CommandRequest) CommandResponse {
+	handler, ok := gcp.commandHandlers[req.Name]
+	if !ok {
+		return createErrorResult(ErrUnknownCommand{req.Name})
+	}
+	storage, err := gcp.database(req)
+	if err != nil {
+		return createErrorResult(err)
+	}
+	return handler(req, storage)
+}
+
+// database Returns the storage of the database selected by the request
+func (gcp *goodiesCommandProcessor) database(req CommandRequest) (Provider, error) {
+	if req.Database == "" || req.Database == DefaultDatabase || serverCommands[req.Name] {
+		return gcp.storage, nil
+	}
+	set, ok := gcp.storage.(databases)
+	if !ok {
+		return nil, ErrNotFound{fmt.Sprintf("database %v", req.Database)}
+	}
+	return set.Database(req.Database)
 }
 
 func createErrorResult(err error) CommandResponse {
@@ -68,16 +280,32 @@ func createOkResult(res string) CommandResponse {
 }
 
 // NewGoodiesCommandsProcessor Creates a generic command processor for goodies provider
+// Scheduled commands are executed once the processor schedules one, until the process exits
 func NewGoodiesCommandsProcessor(storage Provider) CommandProcesser {
-	gcp := goodiesCommandProcessor{storage, make(map[string]func(command CommandRequest, storage Provider) CommandResponse, 1)}
+	return newGoodiesCommandProcessor(storage, NewPubSub())
+}
+
+func newGoodiesCommandProcessor(storage Provider, pubsub *PubSub) *goodiesCommandProcessor {
+	gcp := goodiesCommandProcessor{
+		storage:         storage,
+		commandHandlers: make(map[string]func(command CommandRequest, storage Provider) CommandResponse, 1),
+		pubsub:          pubsub,
+		cluster:         newCluster(),
+		tracking:        newTracking(storage),
+		quotas:          newQuotas(),
+		memory:          newMemoryLimit(),
+		stopping:        make(chan struct{}),
+	}
+	gcp.replication = newReplication(storage, gcp.handleReplicated)
 	gcp.addCommandHandler("Set", setCommandHandler)
 	gcp.addCommandHandler("Get", getCommandHandler)
 	gcp.addCommandHandler("Update", updateCommandHandler)
 	gcp.addCommandHandler("Remove", removeCommandHandler)
-	gcp.addCommandHandler("Keys", keysCommandHandler)
+	gcp.addCommandHandler("Keys", gcp.keysCommandHandler)
 	gcp.addCommandHandler("ListPush", listPushCommandHandler)
 	gcp.addCommandHandler("ListLen", listLenCommandHandler)
 	gcp.addCommandHandler("ListGetByIndex", listGetByIndexCommandHandler)
+	gcp.addCommandHandler("ListGetAll", listGetAllCommandHandler)
 	gcp.addCommandHandler("ListRemoveIndex", listRemoveIndexCommandHandler)
 	gcp.addCommandHandler("ListRemoveValue", listRemoveValueCommandHandler)
 	gcp.addCommandHandler("DictSet", dictSetCommandHandler)
@@ -85,9 +313,76 @@ func NewGoodiesCommandsProcessor(storage Provider) CommandProcesser {
 	gcp.addCommandHandler("DictRemove", dictRemoveCommandHandler)
 	gcp.addCommandHandler("DictHasKey", dictHasKeyCommandHandler)
 	gcp.addCommandHandler("SetExpiry", setExpiryCommandHandler)
+	gcp.addCommandHandler("Publish", gcp.publishCommandHandler)
+	gcp.addCommandHandler("ReplicaOf", gcp.replicaOfCommandHandler)
+	gcp.addCommandHandler("Role", gcp.roleCommandHandler)
+	gcp.addCommandHandler("Dump", dumpCommandHandler)
+	gcp.addCommandHandler("Restore", restoreCommandHandler)
+	gcp.addCommandHandler("ClusterEnable", gcp.clusterEnableCommandHandler)
+	gcp.addCommandHandler("ClusterSetSlots", gcp.clusterSetSlotsCommandHandler)
+	gcp.addCommandHandler("ClusterSetSlot", gcp.clusterSetSlotCommandHandler)
+	gcp.addCommandHandler("ClusterSlots", gcp.clusterSlotsCommandHandler)
+	gcp.addCommandHandler("ClusterKeysInSlot", clusterKeysInSlotCommandHandler)
+	gcp.addCommandHandler("Migrate", gcp.migrateCommandHandler)
+	gcp.addCommandHandler("LockAcquire", lockAcquireCommandHandler)
+	gcp.addCommandHandler("LockRenew", lockRenewCommandHandler)
+	gcp.addCommandHandler("LockRelease", lockReleaseCommandHandler)
+	gcp.addCommandHandler("RateLimitTokenBucket", rateLimitCommandHandler)
+	gcp.addCommandHandler("RateLimitSlidingWindow", rateLimitCommandHandler)
+	gcp.addCommandHandler("QueueEnqueue", queueEnqueueCommandHandler)
+	gcp.addCommandHandler("QueueDequeue", queueDequeueCommandHandler)
+	gcp.addCommandHandler("QueueAck", queueAckCommandHandler)
+	gcp.addCommandHandler("QueueNack", queueNackCommandHandler)
+	gcp.addCommandHandler("QueueMaxAttempts", queueMaxAttemptsCommandHandler)
+	gcp.addCommandHandler("QueueStats", queueStatsCommandHandler)
+	gcp.addCommandHandler("ScheduleAdd", gcp.scheduleAddCommandHandler)
+	gcp.addCommandHandler("ScheduleCancel", scheduleCancelCommandHandler)
+	gcp.addCommandHandler("ScheduleList", scheduleListCommandHandler)
+	gcp.addCommandHandler("FlushAll", flushAllCommandHandler)
+	gcp.addCommandHandler("DbSize", dbSizeCommandHandler)
+	gcp.addCommandHandler("Save", saveCommandHandler)
+	gcp.addCommandHandler("BgSave", saveCommandHandler)
+	gcp.addCommandHandler("LastSave", lastSaveCommandHandler)
+	gcp.addCommandHandler("ConfigGet", configGetCommandHandler)
+	gcp.addCommandHandler("ConfigSet", configSetCommandHandler)
+	gcp.addCommandHandler("DatabaseList", databaseListCommandHandler)
+	gcp.addCommandHandler("DatabaseCreate", databaseCreateCommandHandler)
+	gcp.addCommandHandler("DatabaseFlush", databaseFlushCommandHandler)
+	gcp.addCommandHandler("DatabaseSwap", databaseSwapCommandHandler)
+	gcp.addCommandHandler("QuotaSet", gcp.quotaSetCommandHandler)
+	gcp.addCommandHandler("QuotaRemove", gcp.quotaRemoveCommandHandler)
+	gcp.addCommandHandler("QuotaUsage", gcp.quotaUsageCommandHandler)
+	gcp.addCommandHandler("ACLSet", gcp.aclSetCommandHandler)
+	gcp.addCommandHandler("ACLRemove", aclRemoveCommandHandler)
+	gcp.addCommandHandler("ACLList", aclListCommandHandler)
 	return &gcp
 }
 
+// startScheduler Starts executing scheduled commands unless the processor was stopped, the scheduler
+// runs until stop
+func (gcp *goodiesCommandProcessor) startScheduler() {
+	if _, ok := gcp.storage.(schedule); !ok {
+		return
+	}
+	gcp.startOnce.Do(func() {
+		select {
+		case <-gcp.stopping:
+			return
+		default:
+		}
+		gcp.scheduling.Add(1)
+		go gcp.runScheduler()
+	})
+}
+
+// stop Stops executing scheduled commands, returns once the command being executed finished
+func (gcp *goodiesCommandProcessor) stop() {
+	gcp.stopOnce.Do(func() { close(gcp.stopping) })
+	// a scheduler starting concurrently is added before waiting, later ones never start
+	gcp.startOnce.Do(func() {})
+	gcp.scheduling.Wait()
+}
+
 func setCommandHandler(command CommandRequest, storage Provider) CommandResponse {
 	if len(command.Parameters) != 3 {
 		return createErrorResult(ErrCommandArgumentsMismatch{"Set command is expected to have 3 arguments (key, value, ttl)"})
@@ -134,19 +429,61 @@ func removeCommandHandler(command CommandRequest, storage Provider) CommandRespo
 	return createOkResult("")
 }
 
-func keysCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+// keysCommandHandler Lists keys, identities restricted by ACLs receive only the keys they are allowed to access
+func (gcp *goodiesCommandProcessor) keysCommandHandler(command CommandRequest, storage Provider) CommandResponse {
 	if len(command.Parameters) != 0 {
 		return createErrorResult(ErrCommandArgumentsMismatch{"Keys command is expected to have 0 arguments"})
 	}
 	val, _ := storage.Keys()
-	return createOkResult(strings.Trim(strings.Join(strings.Fields(fmt.Sprint(val)), ":"), "[]"))
+	if acl, restricted := aclOf(gcp.storage, command.Context()); restricted {
+		allowed := val[:0]
+		for _, key := range val {
+			if acl.allowsKey(key) {
+				allowed = append(allowed, key)
+			}
+		}
+		val = allowed
+	}
+	// keys are sent as a JSON array, as they can contain any separator
+	data, err := json.Marshal(val)
+	if err != nil {
+		return createErrorResult(ErrTransformation{err.Error()})
+	}
+	return createOkResult(string(data))
+}
+
+// expiringWriter is implemented by storages able to write collection items together with the ttl of the collection
+type expiringWriter interface {
+	listPushWithExpiry(key string, value string, ttl time.Duration) error
+	dictSetWithExpiry(key string, dictKey string, value string, ttl time.Duration) error
+}
+
+// parseCollectionTTL Parses the optional ttl of ListPush and DictSet given as the parameter at index
+func parseCollectionTTL(command CommandRequest, index int, storage Provider) (time.Duration, expiringWriter, error) {
+	if len(command.Parameters) <= index {
+		return 0, nil, nil
+	}
+	writer, ok := storage.(expiringWriter)
+	if !ok {
+		return 0, nil, ErrInternalError{fmt.Sprintf("Storage doesn't support %v with ttl", command.Name)}
+	}
+	ttl, err := parseTTL(command.Parameters[index])
+	return ttl, writer, err
 }
 
 func listPushCommandHandler(command CommandRequest, storage Provider) CommandResponse {
-	if len(command.Parameters) != 2 {
-		return createErrorResult(ErrCommandArgumentsMismatch{"ListPush command is expected to have 2 arguments (key, value)"})
+	if len(command.Parameters) != 2 && len(command.Parameters) != 3 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"ListPush command is expected to have 2 or 3 arguments (key, value, [ttl])"})
+	}
+	ttl, writer, err := parseCollectionTTL(command, 2, storage)
+	if err != nil {
+		return createErrorResult(err)
+	}
+	if writer != nil {
+		err = writer.listPushWithExpiry(command.Parameters[0], command.Parameters[1], ttl)
+	} else {
+		err = storage.ListPush(command.Parameters[0], command.Parameters[1])
 	}
-	err := storage.ListPush(command.Parameters[0], command.Parameters[1])
 	if err != nil {
 		return createErrorResult(err)
 	}
@@ -207,11 +544,43 @@ func listGetByIndexCommandHandler(command CommandRequest, storage Provider) Comm
 	return createOkResult(val)
 }
 
+// listReader is implemented by storages returning whole lists
+type listReader interface {
+	ListGetAll(key string) ([]string, error)
+}
+
+func listGetAllCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 1 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"ListGetAll command is expected to have 1 argument (key)"})
+	}
+	reader, ok := storage.(listReader)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support reading whole lists"})
+	}
+	list, err := reader.ListGetAll(command.Parameters[0])
+	if err != nil {
+		return createErrorResult(err)
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return createErrorResult(ErrTransformation{err.Error()})
+	}
+	return createOkResult(string(data))
+}
+
 func dictSetCommandHandler(command CommandRequest, storage Provider) CommandResponse {
-	if len(command.Parameters) != 3 {
-		return createErrorResult(ErrCommandArgumentsMismatch{"DictSet command is expected to have 3 arguments (key, dictKey, value)"})
+	if len(command.Parameters) != 3 && len(command.Parameters) != 4 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"DictSet command is expected to have 3 or 4 arguments (key, dictKey, value, [ttl])"})
+	}
+	ttl, writer, err := parseCollectionTTL(command, 3, storage)
+	if err != nil {
+		return createErrorResult(err)
+	}
+	if writer != nil {
+		err = writer.dictSetWithExpiry(command.Parameters[0], command.Parameters[1], command.Parameters[2], ttl)
+	} else {
+		err = storage.DictSet(command.Parameters[0], command.Parameters[1], command.Parameters[2])
 	}
-	err := storage.DictSet(command.Parameters[0], command.Parameters[1], command.Parameters[2])
 	if err != nil {
 		return createErrorResult(err)
 	}
@@ -269,6 +638,42 @@ func setExpiryCommandHandler(command CommandRequest, storage Provider) CommandRe
 	return createOkResult("")
 }
 
+func (gcp *goodiesCommandProcessor) publishCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 2 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"Publish command is expected to have 2 arguments (channel, message)"})
+	}
+	received, err := gcp.pubsub.Publish(command.Parameters[0], command.Parameters[1])
+	if err != nil {
+		return createErrorResult(err)
+	}
+	return createOkResult(strconv.Itoa(received))
+}
+
+func (gcp *goodiesCommandProcessor) replicaOfCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 1 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"ReplicaOf command is expected to have 1 argument (leader address or empty to promote)"})
+	}
+	leader := command.Parameters[0]
+	if leader != "" {
+		if _, err := url.ParseRequestURI(leader); err != nil {
+			return createErrorResult(ErrCommandArgumentsMismatch{fmt.Sprintf("ReplicaOf leader address is malformed: %v", err)})
+		}
+	}
+	gcp.replication.replicaOf(leader)
+	return createOkResult("")
+}
+
+func (gcp *goodiesCommandProcessor) roleCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 0 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"Role command is expected to have 0 arguments"})
+	}
+	data, err := json.Marshal(gcp.replication.info())
+	if err != nil {
+		return createErrorResult(ErrTransformation{err.Error()})
+	}
+	return createOkResult(string(data))
+}
+
 func parseTTL(s string) (time.Duration, error) {
 	if s == "-2" {
 		return ExpireDefault, nil
@@ -0,0 +1,312 @@
+package goodies
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// ACLAll Allows any command in ACL.Commands, as ACL.Identity the ACL applies to identities without their own
+const ACLAll = "*"
+
+// ACL Restricts an authenticated identity to the commands and, for commands addressing a key, to keys
+// matching any of the glob patterns (* matches any sequence, ? a single byte)
+// Identities without an ACL (and without an ACLAll one) are not restricted, nor are requests of servers without auth
+// Channels are published to as keys, commands reaching keys they don't name (FlushAll, DatabaseFlush,
+// DatabaseSwap, ClusterKeysInSlot) and administration commands (ACLs, quotas, ConfigSet, replication and
+// cluster setup) need the "*" pattern allowing any key
+// Event streams carry keys of all commands, so subscriptions, replication and near cache tracking are only
+// open to identities not restricted, watches need Get and deliver events of allowed keys only
+type ACL struct {
+	Identity string
+	Commands []string
+	Keys     []string
+}
+
+// ACLProvider Access control management interface implemented by the client returned from NewGoodiesClient
+type ACLProvider interface {
+	// SetACL Creates or replaces the ACL of the identity
+	SetACL(acl ACL) error
+	// RemoveACL Removes the ACL of the identity, returns ErrNotFound if there is none
+	RemoveACL(identity string) error
+	// ACLs Returns all ACLs ordered by identity
+	ACLs() ([]ACL, error)
+}
+
+// aclKeyParameters Commands addressing a key (or a channel) by a parameter other than the first one of keyedCommands
+var aclKeyParameters = map[string]int{
+	"Migrate": 1,
+	"Publish": 0,
+}
+
+// aclAllKeysCommands Commands reaching keys they don't name, e.g. whole databases or slots, and commands
+// administering the server, so an identity restricted to some keys cannot widen its own access
+var aclAllKeysCommands = map[string]bool{
+	"FlushAll":          true,
+	"DatabaseFlush":     true,
+	"DatabaseSwap":      true,
+	"ClusterKeysInSlot": true,
+
+	"ACLSet":          true,
+	"ACLRemove":       true,
+	"ACLList":         true,
+	"QuotaSet":        true,
+	"QuotaRemove":     true,
+	"ConfigSet":       true,
+	"ReplicaOf":       true,
+	"ClusterEnable":   true,
+	"ClusterSetSlots": true,
+	"ClusterSetSlot":  true,
+}
+
+// aclStore is implemented by storages keeping ACLs
+type aclStore interface {
+	setACL(acl ACL) error
+	removeACL(identity string) error
+	listACLs() (map[string]ACL, error)
+}
+
+func (g *GoodiesStorage) listACLs() (map[string]ACL, error) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	// ACLs are replaced as a whole, as they are read without holding the lock
+	return g.state.ACLs, nil
+}
+
+func (g *GoodiesStorage) setACL(acl ACL) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	replaced := make(map[string]ACL, len(g.state.ACLs)+1)
+	for identity, existing := range g.state.ACLs {
+		replaced[identity] = existing
+	}
+	replaced[acl.Identity] = acl
+	g.state.ACLs = replaced
+	return nil
+}
+
+func (g *GoodiesStorage) removeACL(identity string) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if _, found := g.state.ACLs[identity]; !found {
+		return ErrNotFound{fmt.Sprintf("ACL of %v", identity)}
+	}
+	remaining := make(map[string]ACL, len(g.state.ACLs))
+	for existing, acl := range g.state.ACLs {
+		if existing != identity {
+			remaining[existing] = acl
+		}
+	}
+	g.state.ACLs = remaining
+	return nil
+}
+
+func (a ACL) allowsCommand(name string) bool {
+	for _, allowed := range a.Commands {
+		if allowed == ACLAll || allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (a ACL) allowsKey(key string) bool {
+	for _, pattern := range a.Keys {
+		if matchGlob(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a ACL) allowsAllKeys() bool {
+	for _, pattern := range a.Keys {
+		if pattern == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob Reports if the key matches the pattern, * matches any sequence of bytes and ? a single byte
+func matchGlob(pattern string, key string) bool {
+	p, k := 0, 0
+	// position of the last star and of the key byte it is matched up to, to backtrack on mismatch
+	star, matched := -1, 0
+	for k < len(key) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, matched = p, k
+			p++
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == key[k]):
+			p++
+			k++
+		case star >= 0:
+			matched++
+			p, k = star+1, matched
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// aclOf Returns the ACL restricting the identity the request context was authenticated as,
+// false if the identity is not restricted
+func aclOf(storage Provider, ctx context.Context) (ACL, bool) {
+	identity, authenticated := identityFrom(ctx)
+	store, ok := storage.(aclStore)
+	if !authenticated || !ok {
+		return ACL{}, false
+	}
+	acls, err := store.listACLs()
+	if err != nil {
+		// unreadable ACLs allow nothing rather than everything
+		return ACL{Identity: identity}, true
+	}
+	if acl, found := acls[identity]; found {
+		return acl, true
+	}
+	acl, found := acls[ACLAll]
+	return acl, found
+}
+
+// authorize Returns ErrForbidden if the identity of the request is not allowed to run it
+func (gcp *goodiesCommandProcessor) authorize(req CommandRequest) error {
+	acl, restricted := aclOf(gcp.storage, req.Context())
+	if !restricted {
+		return nil
+	}
+	identity, _ := identityFrom(req.Context())
+	if !acl.allowsCommand(req.Name) {
+		return ErrForbidden{fmt.Sprintf("%v is not allowed to run %v", identity, req.Name)}
+	}
+	index, keyed := aclKeyParameters[req.Name]
+	if keyedCommands[req.Name] {
+		index, keyed = 0, true
+	}
+	if keyed && len(req.Parameters) > index && !acl.allowsKey(req.Parameters[index]) {
+		return ErrForbidden{fmt.Sprintf("%v is not allowed to access key %v", identity, req.Parameters[index])}
+	}
+	if aclAllKeysCommands[req.Name] && !acl.allowsAllKeys() {
+		return ErrForbidden{fmt.Sprintf("%v is not allowed to run %v, it needs access to any key", identity, req.Name)}
+	}
+	return nil
+}
+
+// authorizeStream Rejects streams carrying events of all keys for identities restricted by an ACL
+func (s *goodiesHTTPServer) authorizeStream(w http.ResponseWriter, r *http.Request) bool {
+	if _, restricted := aclOf(s.storage, r.Context()); restricted {
+		identity, _ := identityFrom(r.Context())
+		err := ErrForbidden{fmt.Sprintf("%v is not allowed to open %v", identity, r.URL.Path)}
+		http.Error(w, err.Error(), statusForError(err))
+		return false
+	}
+	return true
+}
+
+func (gcp *goodiesCommandProcessor) aclSetCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 1 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"ACLSet command is expected to have 1 argument (acl(JSON))"})
+	}
+	store, ok := storage.(aclStore)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support ACLs"})
+	}
+	var acl ACL
+	if err := json.Unmarshal([]byte(command.Parameters[0]), &acl); err != nil {
+		return createErrorResult(ErrCommandArgumentsMismatch{fmt.Sprintf("ACLSet acl is not valid: %v", err)})
+	}
+	if acl.Identity == "" {
+		return createErrorResult(ErrCommandArgumentsMismatch{"ACL identity cannot be empty"})
+	}
+	for _, name := range acl.Commands {
+		if _, known := gcp.commandHandlers[name]; !known && name != ACLAll {
+			return createErrorResult(ErrUnknownCommand{name})
+		}
+	}
+	for _, pattern := range acl.Keys {
+		if pattern == "" {
+			return createErrorResult(ErrCommandArgumentsMismatch{"ACL key pattern cannot be empty"})
+		}
+	}
+	if err := store.setACL(acl); err != nil {
+		return createErrorResult(err)
+	}
+	return createOkResult("")
+}
+
+func aclRemoveCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 1 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"ACLRemove command is expected to have 1 argument (identity)"})
+	}
+	store, ok := storage.(aclStore)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support ACLs"})
+	}
+	if err := store.removeACL(command.Parameters[0]); err != nil {
+		return createErrorResult(err)
+	}
+	return createOkResult("")
+}
+
+func aclListCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 0 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"ACLList command is expected to have no arguments"})
+	}
+	store, ok := storage.(aclStore)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support ACLs"})
+	}
+	acls, err := store.listACLs()
+	if err != nil {
+		return createErrorResult(err)
+	}
+	list := make([]ACL, 0, len(acls))
+	for _, acl := range acls {
+		list = append(list, acl)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Identity < list[j].Identity })
+	data, err := json.Marshal(list)
+	if err != nil {
+		return createErrorResult(ErrTransformation{err.Error()})
+	}
+	return createOkResult(string(data))
+}
+
+func (c goodiesClient) SetACL(acl ACL) error {
+	data, err := json.Marshal(acl)
+	if err != nil {
+		return ErrTransformation{err.Error()}
+	}
+	res := internalProcess(CommandRequest{Name: "ACLSet", Parameters: []string{string(data)}}, c)
+	if !res.Success {
+		return res.Err
+	}
+	return nil
+}
+
+func (c goodiesClient) RemoveACL(identity string) error {
+	res := internalProcess(CommandRequest{Name: "ACLRemove", Parameters: []string{identity}}, c)
+	if !res.Success {
+		return res.Err
+	}
+	return nil
+}
+
+func (c goodiesClient) ACLs() ([]ACL, error) {
+	res := internalProcess(CommandRequest{Name: "ACLList"}, c)
+	if !res.Success {
+		return nil, res.Err
+	}
+	var acls []ACL
+	if err := json.Unmarshal([]byte(res.Result), &acls); err != nil {
+		return nil, ErrTransformation{err.Error()}
+	}
+	return acls, nil
+}
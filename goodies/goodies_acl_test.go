@@ -0,0 +1,197 @@
+package goodies
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMatchGlob(testing *testing.T) {
+	for _, c := range []struct {
+		pattern string
+		key     string
+		matches bool
+	}{
+		{"report:*", "report:2024/01", true},
+		{"report:*", "reports", false},
+		{"*", "", true},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"*:*:end", "a:b:c:end", true},
+		{"*x", "abc", false},
+		{"exact", "exact", true},
+	} {
+		if matchGlob(c.pattern, c.key) != c.matches {
+			testing.Errorf("Pattern %q on key %q is expected to match: %v", c.pattern, c.key, c.matches)
+		}
+	}
+}
+
+func TestACLEnforcement(testing *testing.T) {
+	server, _ := newTestAuthServer(testing, AuthConfig{Tokens: map[string]string{
+		"admin":     HashToken("admin-token"),
+		"reporting": HashToken("reporting-token"),
+	}})
+	defer server.Close()
+	admin := NewGoodiesClient(server.URL, WithToken("admin-token"))
+	reporting := NewGoodiesClient(server.URL, WithToken("reporting-token"))
+
+	if err := admin.(ACLProvider).SetACL(ACL{Identity: "reporting", Commands: []string{"Fly"}}); err == nil {
+		testing.Error("Unknown commands are expected to be rejected")
+	}
+	acl := ACL{Identity: "reporting", Commands: []string{"Get", "DictGet", "ScheduleAdd"}, Keys: []string{"report:*"}}
+	if err := admin.(ACLProvider).SetACL(acl); err != nil {
+		testing.Fatalf("Unexpected error on set ACL: %v", err)
+	}
+	admin.Set("report:daily", "42", ExpireNever)
+	admin.Set("secret", "s", ExpireNever)
+
+	if val, err := reporting.Get("report:daily"); err != nil || val != "42" {
+		testing.Errorf("Allowed command on allowed key failed: %v %v", val, err)
+	}
+	if _, err := reporting.Get("secret"); err == nil {
+		testing.Error("Key outside of patterns is expected to be forbidden")
+	} else if _, forbidden := err.(ErrForbidden); !forbidden {
+		testing.Errorf("Expected ErrForbidden for key outside of patterns, got %v", err)
+	}
+	if _, forbidden := reporting.Set("report:daily", "0", ExpireNever).(ErrForbidden); !forbidden {
+		testing.Error("Command not listed is expected to be forbidden")
+	}
+	if status, _ := doREST(testing, "GET", server.URL+"/keys/secret", "", map[string]string{"Authorization": "Bearer reporting-token"}); status != http.StatusForbidden {
+		testing.Errorf("REST is expected to report forbidden access as 403, got %v", status)
+	}
+	_, err := reporting.(SchedulerProvider).ScheduleCommand(time.Now().Add(time.Hour), CommandRequest{Name: "Remove", Parameters: []string{"report:daily"}})
+	if _, forbidden := err.(ErrForbidden); !forbidden {
+		testing.Errorf("Scheduling a forbidden command is expected to be forbidden, got %v", err)
+	}
+	if _, err := reporting.(PubSubProvider).Subscribe("news"); err == nil {
+		testing.Error("Subscriptions are expected to be forbidden to restricted identities")
+	}
+
+	acls, err := admin.(ACLProvider).ACLs()
+	if err != nil || len(acls) != 1 || acls[0].Identity != "reporting" || len(acls[0].Keys) != 1 {
+		testing.Errorf("Unexpected ACLs: %+v %v", acls, err)
+	}
+	if err := admin.(ACLProvider).RemoveACL("reporting"); err != nil {
+		testing.Errorf("Unexpected error on remove ACL: %v", err)
+	}
+	if _, err := reporting.Get("secret"); err != nil {
+		testing.Errorf("Identity without ACL is expected to be unrestricted: %v", err)
+	}
+}
+
+func TestACLKeyParameters(testing *testing.T) {
+	gcp := newGoodiesCommandProcessor(NewGoodiesStorage(ExpireNever), NewPubSub())
+	gcp.HandleCommand(CommandRequest{Name: "ACLSet", Parameters: []string{`{"Identity":"app","Commands":["*"],"Keys":["app:*"]}`}})
+	ctx := withIdentity(context.Background(), "app")
+	for _, req := range []CommandRequest{
+		{Name: "Migrate", Parameters: []string{"http://127.0.0.1:1", "secret"}},
+		{Name: "Publish", Parameters: []string{"secret", "message"}},
+		{Name: "ClusterKeysInSlot", Parameters: []string{"0"}},
+		{Name: "DatabaseFlush", Parameters: []string{DefaultDatabase}},
+		{Name: "ACLSet", Parameters: []string{`{"Identity":"app","Commands":["*"],"Keys":["*"]}`}},
+		{Name: "ACLRemove", Parameters: []string{"app"}},
+		{Name: "QuotaRemove", Parameters: []string{DefaultDatabase, "app:"}},
+		{Name: "ConfigSet", Parameters: []string{ConfigDefaultExpiry, "1m"}},
+		{Name: "ReplicaOf", Parameters: []string{""}},
+	} {
+		if _, forbidden := gcp.HandleCommand(req.WithContext(ctx)).Err.(ErrForbidden); !forbidden {
+			testing.Errorf("%v is expected to be forbidden", req.Name)
+		}
+	}
+	if res := gcp.HandleCommand(CommandRequest{Name: "Publish", Parameters: []string{"app:news", "message"}}.WithContext(ctx)); !res.Success {
+		testing.Errorf("Publishing on allowed channel failed: %v", res.Err)
+	}
+	if res := gcp.HandleCommand(CommandRequest{Name: "Set", Parameters: []string{"secret", "s", "-1"}}.WithContext(ctx)); res.Success {
+		testing.Error("Identity is not expected to grant itself access to more keys")
+	}
+}
+
+func TestACLDefaultAndWatch(testing *testing.T) {
+	server, _ := newTestAuthServer(testing, AuthConfig{Tokens: map[string]string{
+		"admin": HashToken("admin-token"),
+		"app":   HashToken("app-token"),
+	}})
+	defer server.Close()
+	admin := NewGoodiesClient(server.URL, WithToken("admin-token"))
+	app := NewGoodiesClient(server.URL, WithToken("app-token"))
+	admin.(ACLProvider).SetACL(ACL{Identity: "admin", Commands: []string{ACLAll}, Keys: []string{"*"}})
+	admin.(ACLProvider).SetACL(ACL{Identity: ACLAll, Commands: []string{"Get", "Set"}, Keys: []string{"app:*"}})
+
+	if _, forbidden := app.Set("other", "v", ExpireNever).(ErrForbidden); !forbidden {
+		testing.Error("ACL of ACLAll is expected to restrict identities without their own")
+	}
+
+	watcher, err := app.(Watchable).Watch("")
+	if err != nil {
+		testing.Fatalf("Unexpected error on watch: %v", err)
+	}
+	defer watcher.Close()
+	admin.Set("other", "v", ExpireNever)
+	app.Set("app:key", "v", ExpireNever)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	select {
+	case event := <-watcher.Events():
+		if event.Key != "app:key" {
+			testing.Errorf("Watch is expected to deliver allowed keys only, got %v", event.Key)
+		}
+	case <-ctx.Done():
+		testing.Fatal("Timed out waiting for key event")
+	}
+}
+
+func TestACLPersisted(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	if err := storage.setACL(ACL{Identity: "app", Commands: []string{"Get"}, Keys: []string{"*"}}); err != nil {
+		testing.Fatalf("Unexpected error on set ACL: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := storage.writeSnapshot(&buf); err != nil {
+		testing.Fatalf("Unexpected error on snapshot: %v", err)
+	}
+	restored := NewGoodiesStorage(ExpireNever)
+	if err := restored.loadSnapshot(&buf); err != nil {
+		testing.Fatalf("Unexpected error on load: %v", err)
+	}
+	gcp := newGoodiesCommandProcessor(restored, NewPubSub())
+	ctx := withIdentity(context.Background(), "app")
+	if res := gcp.HandleCommand(CommandRequest{Name: "Set", Parameters: []string{"k", "v", "-1"}}.WithContext(ctx)); res.Success {
+		testing.Error("Restored ACL is expected to be enforced")
+	}
+	if res := gcp.HandleCommand(CommandRequest{Name: "Set", Parameters: []string{"k", "v", "-1"}}); !res.Success {
+		testing.Errorf("Requests without identity are not expected to be restricted: %v", res.Err)
+	}
+}
+
+func TestACLSurviveFlushAndSwap(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	gcp := newGoodiesCommandProcessor(storage, NewPubSub())
+	gcp.HandleCommand(CommandRequest{Name: "ACLSet", Parameters: []string{`{"Identity":"reporting","Commands":["Get","Set","Keys","FlushAll","DatabaseSwap"],"Keys":["report:*"]}`}})
+	gcp.HandleCommand(CommandRequest{Name: "ACLSet", Parameters: []string{`{"Identity":"ops","Commands":["FlushAll","DatabaseSwap"],"Keys":["*"]}`}})
+	gcp.HandleCommand(CommandRequest{Name: "Set", Parameters: []string{"secret", "s", "-1"}})
+	gcp.HandleCommand(CommandRequest{Name: "Set", Parameters: []string{"report:daily", "42", "-1"}})
+	ctx := withIdentity(context.Background(), "reporting")
+	ops := withIdentity(context.Background(), "ops")
+
+	res := gcp.HandleCommand(CommandRequest{Name: "Keys"}.WithContext(ctx))
+	if !res.Success || res.Result != `["report:daily"]` {
+		testing.Errorf("Keys are expected to be filtered by ACL, got %+v", res)
+	}
+	gcp.HandleCommand(CommandRequest{Name: "DatabaseCreate", Parameters: []string{"staging", "-1"}})
+	if res := gcp.HandleCommand(CommandRequest{Name: "FlushAll"}.WithContext(ctx)); res.Success {
+		testing.Error("FlushAll is expected to need access to any key")
+	}
+	if res := gcp.HandleCommand(CommandRequest{Name: "DatabaseSwap", Parameters: []string{DefaultDatabase, "staging"}}.WithContext(ops)); !res.Success {
+		testing.Fatalf("Unexpected error on swap: %v", res.Err)
+	}
+	if res := gcp.HandleCommand(CommandRequest{Name: "FlushAll"}.WithContext(ops)); !res.Success {
+		testing.Fatalf("Unexpected error on flush: %v", res.Err)
+	}
+	res = gcp.HandleCommand(CommandRequest{Name: "Set", Parameters: []string{"secret", "s", "-1"}}.WithContext(ctx))
+	if _, forbidden := res.Err.(ErrForbidden); !forbidden {
+		testing.Errorf("ACL is expected to survive flush and swap, got %+v", res)
+	}
+}
@@ -0,0 +1,301 @@
+package goodies
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// ConfigDefaultExpiry Runtime setting holding ttl of items stored with ExpireDefault
+	ConfigDefaultExpiry = "defaultExpiry"
+	// ConfigPersistInterval Runtime setting holding the interval between snapshots of persisted storage
+	ConfigPersistInterval = "persistInterval"
+)
+
+// AdminProvider Server administration interface implemented by the client returned from NewGoodiesClient
+// Runtime settings are node local (not replicated) and written as durations, e.g. "1m30s"
+type AdminProvider interface {
+	// FlushAll Removes all items of every database, locks are released keeping their fencing tokens
+	FlushAll() error
+	// DbSize Returns the number of keys
+	DbSize() (int, error)
+	// Save Saves the snapshot of persisted storage synchronously
+	Save() error
+	// BgSave Starts saving the snapshot of persisted storage in background
+	BgSave() error
+	// LastSave Returns time of the last successful snapshot, zero time if there is none since start
+	LastSave() (time.Time, error)
+	// ConfigGet Returns value of a runtime setting (ConfigDefaultExpiry, ConfigPersistInterval)
+	ConfigGet(name string) (string, error)
+	// ConfigSet Changes a runtime setting
+	ConfigSet(name string, value string) error
+}
+
+// FlushAll Removes all items of the database notifying watchers about every removed key
+// Fencing counters of locks are kept in the server state, so their tokens keep growing
+func (g *GoodiesStorage) FlushAll() error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for key, item := range g.storage {
+		g.internalRemove(key)
+		if checkExpiry(item.Expiry) {
+			g.emit(KeyExpired, key)
+		} else {
+			g.emit(KeyRemoved, key)
+		}
+	}
+	return nil
+}
+
+// DbSize Returns the number of keys which are not expired
+func (g *GoodiesStorage) DbSize() (int, error) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	size := 0
+	for _, item := range g.storage {
+		if !checkExpiry(item.Expiry) {
+			size++
+		}
+	}
+	return size, nil
+}
+
+// flusher is implemented by storages able to remove all items
+type flusher interface {
+	FlushAll() error
+	DbSize() (int, error)
+}
+
+// saver is implemented by persisted storages
+type saver interface {
+	SaveSnapshot() error
+	BackgroundSave() error
+	LastSave() time.Time
+}
+
+// runtimeSetting A setting of a running server readable by ConfigGet and writable by ConfigSet
+type runtimeSetting struct {
+	get func(storage Provider) (time.Duration, bool)
+	set func(storage Provider, value time.Duration) bool
+	// min Smallest allowed value
+	min time.Duration
+}
+
+var runtimeSettings = map[string]runtimeSetting{
+	ConfigDefaultExpiry: {
+		get: func(storage Provider) (time.Duration, bool) {
+			expiring, ok := storage.(interface{ DefaultExpiry() time.Duration })
+			if !ok {
+				return 0, false
+			}
+			return expiring.DefaultExpiry(), true
+		},
+		set: func(storage Provider, value time.Duration) bool {
+			expiring, ok := storage.(interface{ SetDefaultExpiry(time.Duration) })
+			if ok {
+				expiring.SetDefaultExpiry(value)
+			}
+			return ok
+		},
+	},
+	ConfigPersistInterval: {
+		get: func(storage Provider) (time.Duration, bool) {
+			persisted, ok := storage.(interface{ PersistInterval() time.Duration })
+			if !ok {
+				return 0, false
+			}
+			return persisted.PersistInterval(), true
+		},
+		set: func(storage Provider, value time.Duration) bool {
+			persisted, ok := storage.(interface{ SetPersistInterval(time.Duration) })
+			if ok {
+				persisted.SetPersistInterval(value)
+			}
+			return ok
+		},
+		min: time.Millisecond,
+	},
+}
+
+func runtimeSettingNames() []string {
+	names := make([]string, 0, len(runtimeSettings))
+	for name := range runtimeSettings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func flushAllCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 0 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"FlushAll command is expected to have no arguments"})
+	}
+	flusher, ok := storage.(flusher)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support flushing"})
+	}
+	if err := flusher.FlushAll(); err != nil {
+		return createErrorResult(err)
+	}
+	// the storage is the default database, databases created next to it are flushed as well
+	if set, ok := storage.(databases); ok {
+		for _, database := range set.namedDatabases() {
+			if err := database.FlushAll(); err != nil {
+				return createErrorResult(err)
+			}
+		}
+	}
+	return createOkResult("")
+}
+
+func dbSizeCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 0 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"DbSize command is expected to have no arguments"})
+	}
+	flusher, ok := storage.(flusher)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support counting keys"})
+	}
+	size, err := flusher.DbSize()
+	if err != nil {
+		return createErrorResult(err)
+	}
+	return createOkResult(strconv.Itoa(size))
+}
+
+func saveCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 0 {
+		return createErrorResult(ErrCommandArgumentsMismatch{fmt.Sprintf("%v command is expected to have no arguments", command.Name)})
+	}
+	saver, ok := storage.(saver)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage is not persisted"})
+	}
+	var err error
+	if command.Name == "BgSave" {
+		err = saver.BackgroundSave()
+	} else {
+		err = saver.SaveSnapshot()
+	}
+	if err != nil {
+		return createErrorResult(ErrInternalError{fmt.Sprintf("Snapshot not saved: %v", err)})
+	}
+	return createOkResult("")
+}
+
+func lastSaveCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 0 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"LastSave command is expected to have no arguments"})
+	}
+	saver, ok := storage.(saver)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage is not persisted"})
+	}
+	var saved int64
+	if last := saver.LastSave(); !last.IsZero() {
+		saved = last.UnixMilli()
+	}
+	return createOkResult(strconv.FormatInt(saved, 10))
+}
+
+func configGetCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 1 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"ConfigGet command is expected to have 1 argument (name)"})
+	}
+	setting, found := runtimeSettings[command.Parameters[0]]
+	if !found {
+		return createErrorResult(ErrNotFound{fmt.Sprintf("setting %v (known: %v)", command.Parameters[0], runtimeSettingNames())})
+	}
+	value, ok := setting.get(storage)
+	if !ok {
+		return createErrorResult(ErrInternalError{fmt.Sprintf("Storage doesn't support setting %v", command.Parameters[0])})
+	}
+	return createOkResult(value.String())
+}
+
+func configSetCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 2 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"ConfigSet command is expected to have 2 arguments (name, value(DURATION))"})
+	}
+	setting, found := runtimeSettings[command.Parameters[0]]
+	if !found {
+		return createErrorResult(ErrNotFound{fmt.Sprintf("setting %v (known: %v)", command.Parameters[0], runtimeSettingNames())})
+	}
+	value, err := time.ParseDuration(command.Parameters[1])
+	if err != nil || value < setting.min {
+		return createErrorResult(ErrCommandArgumentsMismatch{fmt.Sprintf("Setting %v is expected to be a duration of at least %v", command.Parameters[0], setting.min)})
+	}
+	if !setting.set(storage, value) {
+		return createErrorResult(ErrInternalError{fmt.Sprintf("Storage doesn't support setting %v", command.Parameters[0])})
+	}
+	return createOkResult("")
+}
+
+func (c goodiesClient) FlushAll() error {
+	res := internalProcess(CommandRequest{Name: "FlushAll"}, c)
+	if !res.Success {
+		return res.Err
+	}
+	return nil
+}
+
+func (c goodiesClient) DbSize() (int, error) {
+	res := internalProcess(CommandRequest{Name: "DbSize"}, c)
+	if !res.Success {
+		return 0, res.Err
+	}
+	size, err := strconv.Atoi(res.Result)
+	if err != nil {
+		return 0, ErrTransformation{err.Error()}
+	}
+	return size, nil
+}
+
+func (c goodiesClient) Save() error {
+	res := internalProcess(CommandRequest{Name: "Save"}, c)
+	if !res.Success {
+		return res.Err
+	}
+	return nil
+}
+
+func (c goodiesClient) BgSave() error {
+	res := internalProcess(CommandRequest{Name: "BgSave"}, c)
+	if !res.Success {
+		return res.Err
+	}
+	return nil
+}
+
+func (c goodiesClient) LastSave() (time.Time, error) {
+	res := internalProcess(CommandRequest{Name: "LastSave"}, c)
+	if !res.Success {
+		return time.Time{}, res.Err
+	}
+	saved, err := strconv.ParseInt(res.Result, 10, 64)
+	if err != nil {
+		return time.Time{}, ErrTransformation{err.Error()}
+	}
+	if saved == 0 {
+		return time.Time{}, nil
+	}
+	return time.UnixMilli(saved), nil
+}
+
+func (c goodiesClient) ConfigGet(name string) (string, error) {
+	res := internalProcess(CommandRequest{Name: "ConfigGet", Parameters: []string{name}}, c)
+	if !res.Success {
+		return "", res.Err
+	}
+	return res.Result, nil
+}
+
+func (c goodiesClient) ConfigSet(name string, value string) error {
+	res := internalProcess(CommandRequest{Name: "ConfigSet", Parameters: []string{name, value}}, c)
+	if !res.Success {
+		return res.Err
+	}
+	return nil
+}
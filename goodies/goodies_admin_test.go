@@ -0,0 +1,62 @@
+package goodies
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAdminCommands(testing *testing.T) {
+	filename := filepath.Join(testing.TempDir(), "goodies.dat")
+	storage := NewGoodiesPersistedStorage(time.Minute, filename, time.Hour)
+	defer storage.Stop()
+	server := httptest.NewServer(newGoodiesHTTPHandler(storage))
+	defer server.Close()
+	client := NewGoodiesClient(server.URL)
+	admin := client.(AdminProvider)
+
+	client.Set("first", "value", ExpireNever)
+	client.ListPush("second", "value")
+	if size, err := admin.DbSize(); err != nil || size != 2 {
+		testing.Errorf("Unexpected size: %v %v", size, err)
+	}
+	if saved, err := admin.LastSave(); err != nil || !saved.IsZero() {
+		testing.Errorf("Nothing is expected to be saved yet: %v %v", saved, err)
+	}
+	before := time.Now().Add(-time.Second)
+	if err := admin.Save(); err != nil {
+		testing.Fatalf("Unexpected error on save: %v", err)
+	}
+	if saved, _ := admin.LastSave(); saved.Before(before) {
+		testing.Errorf("Save time is expected to be reported: %v", saved)
+	}
+	if err := admin.BgSave(); err != nil {
+		testing.Errorf("Unexpected error on background save: %v", err)
+	}
+
+	if err := admin.FlushAll(); err != nil {
+		testing.Errorf("Unexpected error on flush: %v", err)
+	}
+	if size, _ := admin.DbSize(); size != 0 {
+		testing.Errorf("Flushed storage is expected to be empty, got %v keys", size)
+	}
+	restored := NewGoodiesPersistedStorage(ExpireNever, filename, time.Hour)
+	defer restored.Stop()
+	if val, err := restored.Get("first"); err != nil || val != "value" {
+		testing.Errorf("Saved snapshot is expected to keep items: %v %v", val, err)
+	}
+
+	if err := admin.ConfigSet(ConfigDefaultExpiry, "1h"); err != nil {
+		testing.Errorf("Unexpected error on config set: %v", err)
+	}
+	if value, err := admin.ConfigGet(ConfigDefaultExpiry); err != nil || value != "1h0m0s" {
+		testing.Errorf("Unexpected setting: %v %v", value, err)
+	}
+	if err := admin.ConfigSet(ConfigPersistInterval, "0s"); err == nil {
+		testing.Error("Zero persist interval is not expected to be accepted")
+	}
+	if _, notFound := admin.ConfigSet("maxMemory", "1s").(ErrNotFound); !notFound {
+		testing.Error("Unknown setting is expected to be reported as ErrNotFound")
+	}
+}
@@ -0,0 +1,257 @@
+package goodies
+
+import (
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// tokenHashScheme Tokens are random and long, a plain digest is enough to keep them out of config files
+	tokenHashScheme = "sha256"
+	// passwordHashScheme Passwords are guessable, they are stretched by PBKDF2
+	passwordHashScheme = "pbkdf2-sha256"
+	// passwordHashIterations PBKDF2 iterations of new password hashes, verified ones keep their own count
+	passwordHashIterations = 100000
+	passwordSaltSize       = 16
+	passwordKeySize        = 32
+)
+
+// Credentials Secrets a client presents to the server, a token is sent as a bearer token,
+// username with password as basic authentication
+type Credentials struct {
+	Token    string
+	Username string
+	Password string
+}
+
+// authorize Adds the credentials to the request
+func (c Credentials) authorize(r *http.Request) {
+	switch {
+	case c.Token != "":
+		r.Header.Set("Authorization", "Bearer "+c.Token)
+	case c.Username != "":
+		r.SetBasicAuth(c.Username, c.Password)
+	}
+}
+
+// WithToken Authenticates the client by a static API token
+func WithToken(token string) ClientOption {
+	return func(options *clientOptions) {
+		options.credentials = Credentials{Token: token}
+	}
+}
+
+// WithBasicAuth Authenticates the client by username and password
+func WithBasicAuth(username string, password string) ClientOption {
+	return func(options *clientOptions) {
+		options.credentials = Credentials{Username: username, Password: password}
+	}
+}
+
+// WithCredentials Returns a copy of the transport presenting the credentials
+func (tr GoodiesHttpCommandClient) WithCredentials(credentials Credentials) GoodiesHttpCommandClient {
+	tr.credentials = credentials
+	return tr
+}
+
+// HashToken Returns the hash of an API token to be put into AuthConfig.Tokens
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return tokenHashScheme + "$" + hex.EncodeToString(sum[:])
+}
+
+// HashPassword Returns the salted hash of a password to be put into AuthConfig.Users
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordHashIterations, passwordKeySize)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%v$%v$%v$%v", passwordHashScheme, passwordHashIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// passwordHash Parsed hash made by HashPassword
+type passwordHash struct {
+	iterations int
+	salt       []byte
+	key        []byte
+}
+
+func parsePasswordHash(hash string) (passwordHash, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != passwordHashScheme {
+		return passwordHash{}, fmt.Errorf("password hash is expected to be %v$iterations$salt$key", passwordHashScheme)
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return passwordHash{}, fmt.Errorf("password hash has invalid iterations %q", parts[1])
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return passwordHash{}, fmt.Errorf("password hash has invalid salt: %v", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return passwordHash{}, fmt.Errorf("password hash has invalid key")
+	}
+	return passwordHash{iterations, salt, key}, nil
+}
+
+func (h passwordHash) verify(password string) bool {
+	key, err := pbkdf2.Key(sha256.New, password, h.salt, h.iterations, len(h.key))
+	return err == nil && subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+func parseTokenHash(hash string) (string, error) {
+	digest, found := strings.CutPrefix(hash, tokenHashScheme+"$")
+	if decoded, err := hex.DecodeString(digest); !found || err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("token hash is expected to be %v$<hex digest>", tokenHashScheme)
+	}
+	return strings.ToLower(digest), nil
+}
+
+// authenticator Verifies credentials of incoming requests, server without any credentials configured is open
+type authenticator struct {
+	lock sync.RWMutex
+	// tokens Identities by hex digest of their token
+	tokens map[string]string
+	users  map[string]passwordHash
+	// verified Digests of username and password pairs known to be valid, so PBKDF2 runs once per pair
+	verified map[[sha256.Size]byte]bool
+}
+
+func newAuthenticator() *authenticator {
+	return &authenticator{}
+}
+
+// update Replaces credentials, e.g. on configuration reload
+func (a *authenticator) update(config AuthConfig) error {
+	tokens := make(map[string]string, len(config.Tokens))
+	for identity, hash := range config.Tokens {
+		digest, err := parseTokenHash(hash)
+		if err != nil {
+			return ErrInvalidConfig{fmt.Sprintf("token %v: %v", identity, err)}
+		}
+		tokens[digest] = identity
+	}
+	users := make(map[string]passwordHash, len(config.Users))
+	for username, hash := range config.Users {
+		parsed, err := parsePasswordHash(hash)
+		if err != nil {
+			return ErrInvalidConfig{fmt.Sprintf("user %v: %v", username, err)}
+		}
+		users[username] = parsed
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.tokens, a.users, a.verified = tokens, users, make(map[[sha256.Size]byte]bool)
+	return nil
+}
+
+// authenticate Returns identity of the request, empty identity if authentication is not required
+// Verified client certificate authenticates requests without other credentials
+func (a *authenticator) authenticate(r *http.Request) (string, error) {
+	if identity, verified := certificateIdentity(r); verified && r.Header.Get("Authorization") == "" {
+		return identity, nil
+	}
+	a.lock.RLock()
+	required := len(a.tokens) > 0 || len(a.users) > 0
+	a.lock.RUnlock()
+	if !required {
+		return "", nil
+	}
+	if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+		sum := sha256.Sum256([]byte(token))
+		a.lock.RLock()
+		identity, known := a.tokens[hex.EncodeToString(sum[:])]
+		a.lock.RUnlock()
+		if !known {
+			return "", ErrUnauthorized{"invalid token"}
+		}
+		return identity, nil
+	}
+	if username, password, found := r.BasicAuth(); found {
+		if !a.verifyPassword(username, password) {
+			return "", ErrUnauthorized{"invalid username or password"}
+		}
+		return username, nil
+	}
+	return "", ErrUnauthorized{"credentials required"}
+}
+
+func (a *authenticator) verifyPassword(username string, password string) bool {
+	pair := sha256.Sum256([]byte(username + "\x00" + password))
+	a.lock.RLock()
+	hash, known := a.users[username]
+	verified := a.verified[pair]
+	a.lock.RUnlock()
+	if !known {
+		return false
+	}
+	if verified {
+		return true
+	}
+	if !hash.verify(password) {
+		return false
+	}
+	a.lock.Lock()
+	// credentials might have been replaced while verifying
+	if current, still := a.users[username]; still && subtle.ConstantTimeCompare(current.key, hash.key) == 1 {
+		a.verified[pair] = true
+	}
+	a.lock.Unlock()
+	return true
+}
+
+// identityKey Context key of the identity authenticated for the request
+type identityKey struct{}
+
+func withIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// identityFrom Returns the authenticated identity of the request context, false if the request was not authenticated
+func identityFrom(ctx context.Context) (string, bool) {
+	identity, ok := ctx.Value(identityKey{}).(string)
+	return identity, ok
+}
+
+// writeUnauthorized Rejects the request, command requests get the error as a command response
+// so clients report it as any other typed error
+func (s *goodiesHTTPServer) writeUnauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	w.Header().Add("WWW-Authenticate", `Bearer realm="goodies"`)
+	w.Header().Add("WWW-Authenticate", `Basic realm="goodies"`)
+	if isCommandPath(r.URL.Path) {
+		data, serErr := s.serializer.SerialiseResponse(createErrorResult(err))
+		if serErr != nil {
+			panic("Cannot serialise response")
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write(data)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusUnauthorized)
+}
+
+// setAuth Replaces credentials accepted by the server and the ones it presents to other nodes
+func (s *goodiesHTTPServer) setAuth(config AuthConfig) error {
+	if err := s.auth.update(config); err != nil {
+		return err
+	}
+	s.replication.setPeerCredentials(Credentials{Token: config.PeerToken})
+	return nil
+}
@@ -0,0 +1,152 @@
+package goodies
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestAuthServer(testing *testing.T, config AuthConfig) (*httptest.Server, *goodiesHTTPServer) {
+	handler := newGoodiesHTTPHandler(NewGoodiesStorage(ExpireNever))
+	if err := handler.setAuth(config); err != nil {
+		testing.Fatalf("Unexpected error on auth setup: %v", err)
+	}
+	return httptest.NewServer(handler), handler
+}
+
+func TestAuthCredentials(testing *testing.T) {
+	password, err := HashPassword("s3cret")
+	if err != nil {
+		testing.Fatalf("Cannot hash password: %v", err)
+	}
+	server, _ := newTestAuthServer(testing, AuthConfig{
+		Tokens: map[string]string{"reporting": HashToken("t0ken")},
+		Users:  map[string]string{"admin": password},
+	})
+	defer server.Close()
+
+	err = NewGoodiesClient(server.URL).Set("key", "value", ExpireNever)
+	if _, unauthorized := err.(ErrUnauthorized); !unauthorized {
+		testing.Errorf("Expected ErrUnauthorized without credentials, got %v", err)
+	}
+	for _, option := range []ClientOption{WithToken("wrong"), WithBasicAuth("admin", "wrong"), WithBasicAuth("nobody", "s3cret")} {
+		if _, err := NewGoodiesClient(server.URL, option).Get("key"); err == nil {
+			testing.Error("Invalid credentials are expected to be rejected")
+		} else if _, unauthorized := err.(ErrUnauthorized); !unauthorized {
+			testing.Errorf("Expected ErrUnauthorized for invalid credentials, got %v", err)
+		}
+	}
+
+	admin := NewGoodiesClient(server.URL, WithBasicAuth("admin", "s3cret"))
+	if err := admin.Set("key", "value", ExpireNever); err != nil {
+		testing.Errorf("Unexpected error with valid password: %v", err)
+	}
+	// the second request is served from verified pairs
+	if val, err := admin.Get("key"); err != nil || val != "value" {
+		testing.Errorf("Unexpected result with valid password: %v %v", val, err)
+	}
+	if val, err := NewGoodiesClient(server.URL, WithToken("t0ken")).Get("key"); err != nil || val != "value" {
+		testing.Errorf("Unexpected result with valid token: %v %v", val, err)
+	}
+}
+
+func TestAuthTransports(testing *testing.T) {
+	server, _ := newTestAuthServer(testing, AuthConfig{Tokens: map[string]string{"app": HashToken("t0ken")}})
+	defer server.Close()
+
+	if status, _ := doREST(testing, "GET", server.URL+"/keys/key", "", nil); status != http.StatusUnauthorized {
+		testing.Errorf("REST is expected to require credentials, got %v", status)
+	}
+	if status, _ := doREST(testing, "GET", server.URL+"/keys/key", "", map[string]string{"Authorization": "Bearer t0ken"}); status != http.StatusNotFound {
+		testing.Errorf("REST is expected to accept the token, got %v", status)
+	}
+	if _, err := NewGoodiesClient(server.URL).(Watchable).Watch(""); err == nil {
+		testing.Error("Watch is expected to require credentials")
+	} else if _, unauthorized := err.(ErrUnauthorized); !unauthorized {
+		testing.Errorf("Expected ErrUnauthorized on watch, got %v", err)
+	}
+	watcher, err := NewGoodiesClient(server.URL, WithToken("t0ken")).(Watchable).Watch("")
+	if err != nil {
+		testing.Fatalf("Unexpected error on authenticated watch: %v", err)
+	}
+	watcher.Close()
+}
+
+func TestAuthReplicationPeerToken(testing *testing.T) {
+	leaderServer, _ := newTestAuthServer(testing, AuthConfig{Tokens: map[string]string{"replica": HashToken("peer")}})
+	defer leaderServer.Close()
+	followerServer, _ := newTestAuthServer(testing, AuthConfig{PeerToken: "peer"})
+	defer followerServer.Close()
+
+	leader := NewGoodiesClient(leaderServer.URL, WithToken("peer"))
+	follower := NewGoodiesClient(followerServer.URL)
+	leader.Set("key", "value", ExpireNever)
+	if err := follower.(ReplicationProvider).ReplicaOf(leaderServer.URL); err != nil {
+		testing.Fatalf("Unexpected error on ReplicaOf: %v", err)
+	}
+	waitFor(testing, "authenticated synchronisation", func() bool {
+		val, err := follower.Get("key")
+		return err == nil && val == "value"
+	})
+	follower.(ReplicationProvider).ReplicaOf("")
+}
+
+func TestAuthConfigValidation(testing *testing.T) {
+	config := DefaultServerConfig()
+	config.Auth.Tokens = map[string]string{"app": "plain"}
+	if _, invalid := config.Validate().(ErrInvalidConfig); !invalid {
+		testing.Error("Plain token is expected to be rejected")
+	}
+	config.Auth.Tokens = map[string]string{"app": HashToken("t0ken")}
+	config.Auth.Users = map[string]string{"admin": "pbkdf2-sha256$0$c2FsdA$a2V5"}
+	if _, invalid := config.Validate().(ErrInvalidConfig); !invalid {
+		testing.Error("Password hash without iterations is expected to be rejected")
+	}
+	config.Auth.Users = nil
+	if err := config.Validate(); err != nil {
+		testing.Errorf("Unexpected error for hashed token: %v", err)
+	}
+}
+
+func TestAuthMultiNodeClients(testing *testing.T) {
+	config := AuthConfig{Tokens: map[string]string{"admin": HashToken("t0ken")}, PeerToken: "t0ken"}
+	first, _ := newTestAuthServer(testing, config)
+	defer first.Close()
+	second, _ := newTestAuthServer(testing, config)
+	defer second.Close()
+	nodes := []string{first.URL, second.URL}
+	token := WithToken("t0ken")
+
+	sentinel, _ := NewSentinel(nodes[:1], time.Second, 1, token)
+	sentinel.Check()
+	if leader := sentinel.Leader(); leader != first.URL {
+		testing.Errorf("Sentinel is expected to authenticate its checks, leader %q", leader)
+	}
+	if err := NewGoodiesFailoverClient(nodes[:1], token).Set("failover", "value", ExpireNever); err != nil {
+		testing.Errorf("Unexpected error through failover client: %v", err)
+	}
+	if err := NewGoodiesShardedClient(nodes, token).Set("sharded", "value", ExpireNever); err != nil {
+		testing.Errorf("Unexpected error through sharded client: %v", err)
+	}
+
+	for _, node := range nodes {
+		admin := NewGoodiesClient(node, token).(ClusterAdmin)
+		if err := admin.ClusterEnable(node); err != nil {
+			testing.Fatalf("Unexpected error on cluster enable: %v", err)
+		}
+		if err := admin.ClusterSetSlots(0, ClusterSlots-1, first.URL); err != nil {
+			testing.Fatalf("Unexpected error on slots assignment: %v", err)
+		}
+	}
+	cluster := NewGoodiesClusterClient(nodes[:1], token)
+	if err := cluster.Set("clustered", "value", ExpireNever); err != nil {
+		testing.Errorf("Unexpected error through cluster client: %v", err)
+	}
+	if err := MigrateSlot(nodes, KeySlot("clustered"), first.URL, second.URL, token); err != nil {
+		testing.Fatalf("Unexpected error on authenticated migration: %v", err)
+	}
+	if val, err := cluster.Get("clustered"); err != nil || val != "value" {
+		testing.Errorf("Migrated key is expected to be served by the target: %v %v", val, err)
+	}
+}
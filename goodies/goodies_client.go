@@ -1,8 +1,10 @@
 package goodies
 
 import (
+	"context"
+	"encoding/json"
+	"io"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -10,9 +12,50 @@ type goodiesClient struct {
 	transport CommandProcessor
 }
 
+// subscribingTransport is implemented by transports able to stream published messages
+type subscribingTransport interface {
+	subscribe(channels []string, patterns []string) (*Subscription, error)
+}
+
+// watchingTransport is implemented by transports able to stream key events
+type watchingTransport interface {
+	watch(prefix string) (*Watcher, error)
+}
+
+// Close Releases background resources of the transport (e.g. near cache invalidation stream)
+func (c goodiesClient) Close() error {
+	if closer, ok := c.transport.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
 func internalProcess(req CommandRequest, c goodiesClient) CommandResponse {
+	return internalProcessContext(context.Background(), req, c)
+}
+
+// internalProcessContext Sends the command limiting it by DefaultCommandTimeout if ctx has no deadline
+// Cancellation and deadline errors are returned as is, so they can be checked with errors.Is
+func internalProcessContext(ctx context.Context, req CommandRequest, c goodiesClient) CommandResponse {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultCommandTimeout)
+		defer cancel()
+	}
 	var res CommandResponse
-	err := c.transport.Process(req, &res)
+	var err error
+	if transport, ok := c.transport.(ContextCommandProcessor); ok {
+		err = transport.ProcessContext(ctx, req, &res)
+	} else {
+		err = c.transport.Process(req, &res)
+	}
+	// a response received just before the deadline is kept, the context error only explains transport failures
+	if err != nil && ctx.Err() != nil {
+		return CommandResponse{false, "", ctx.Err()}
+	}
+	if _, open := err.(ErrCircuitOpen); open {
+		return CommandResponse{false, "", err}
+	}
 	if err != nil {
 		return CommandResponse{false, "", ErrInternalError{err.Error()}}
 	}
@@ -20,8 +63,12 @@ func internalProcess(req CommandRequest, c goodiesClient) CommandResponse {
 }
 
 func (c goodiesClient) Set(key string, value string, ttl time.Duration) error {
-	req := CommandRequest{"Set", []string{key, value, ttlAsString(ttl)}}
-	res := internalProcess(req, c)
+	return c.SetContext(context.Background(), key, value, ttl)
+}
+
+func (c goodiesClient) SetContext(ctx context.Context, key string, value string, ttl time.Duration) error {
+	req := CommandRequest{Name: "Set", Parameters: []string{key, value, ttlAsString(ttl)}}
+	res := internalProcessContext(ctx, req, c)
 	if !res.Success {
 		return res.Err
 	}
@@ -29,8 +76,12 @@ func (c goodiesClient) Set(key string, value string, ttl time.Duration) error {
 }
 
 func (c goodiesClient) Get(key string) (string, error) {
-	req := CommandRequest{"Get", []string{key}}
-	res := internalProcess(req, c)
+	return c.GetContext(context.Background(), key)
+}
+
+func (c goodiesClient) GetContext(ctx context.Context, key string) (string, error) {
+	req := CommandRequest{Name: "Get", Parameters: []string{key}}
+	res := internalProcessContext(ctx, req, c)
 	if !res.Success {
 		return "", res.Err
 	}
@@ -38,8 +89,12 @@ func (c goodiesClient) Get(key string) (string, error) {
 }
 
 func (c goodiesClient) Update(key string, value string, ttl time.Duration) error {
-	req := CommandRequest{"Update", []string{key, value, ttlAsString(ttl)}}
-	res := internalProcess(req, c)
+	return c.UpdateContext(context.Background(), key, value, ttl)
+}
+
+func (c goodiesClient) UpdateContext(ctx context.Context, key string, value string, ttl time.Duration) error {
+	req := CommandRequest{Name: "Update", Parameters: []string{key, value, ttlAsString(ttl)}}
+	res := internalProcessContext(ctx, req, c)
 	if !res.Success {
 		return res.Err
 	}
@@ -47,8 +102,12 @@ func (c goodiesClient) Update(key string, value string, ttl time.Duration) error
 }
 
 func (c goodiesClient) Remove(key string) error {
-	req := CommandRequest{"Remove", []string{key}}
-	res := internalProcess(req, c)
+	return c.RemoveContext(context.Background(), key)
+}
+
+func (c goodiesClient) RemoveContext(ctx context.Context, key string) error {
+	req := CommandRequest{Name: "Remove", Parameters: []string{key}}
+	res := internalProcessContext(ctx, req, c)
 	if !res.Success {
 		return res.Err
 	}
@@ -56,17 +115,29 @@ func (c goodiesClient) Remove(key string) error {
 }
 
 func (c goodiesClient) Keys() ([]string, error) {
-	req := CommandRequest{"Keys", []string{}}
-	res := internalProcess(req, c)
+	return c.KeysContext(context.Background())
+}
+
+func (c goodiesClient) KeysContext(ctx context.Context) ([]string, error) {
+	req := CommandRequest{Name: "Keys", Parameters: []string{}}
+	res := internalProcessContext(ctx, req, c)
 	if !res.Success {
 		return nil, res.Err
 	}
-	return strings.Split(res.Result, ":"), nil
+	keys := []string{}
+	if err := json.Unmarshal([]byte(res.Result), &keys); err != nil {
+		return nil, ErrTransformation{err.Error()}
+	}
+	return keys, nil
 }
 
 func (c goodiesClient) ListPush(key string, value string) error {
-	req := CommandRequest{"ListPush", []string{key, value}}
-	res := internalProcess(req, c)
+	return c.ListPushContext(context.Background(), key, value)
+}
+
+func (c goodiesClient) ListPushContext(ctx context.Context, key string, value string) error {
+	req := CommandRequest{Name: "ListPush", Parameters: []string{key, value}}
+	res := internalProcessContext(ctx, req, c)
 	if !res.Success {
 		return res.Err
 	}
@@ -74,8 +145,12 @@ func (c goodiesClient) ListPush(key string, value string) error {
 }
 
 func (c goodiesClient) ListLen(key string) (int, error) {
-	req := CommandRequest{"ListLen", []string{key}}
-	res := internalProcess(req, c)
+	return c.ListLenContext(context.Background(), key)
+}
+
+func (c goodiesClient) ListLenContext(ctx context.Context, key string) (int, error) {
+	req := CommandRequest{Name: "ListLen", Parameters: []string{key}}
+	res := internalProcessContext(ctx, req, c)
 	if !res.Success {
 		return 0, res.Err
 	}
@@ -84,8 +159,12 @@ func (c goodiesClient) ListLen(key string) (int, error) {
 }
 
 func (c goodiesClient) ListRemoveIndex(key string, index int) error {
-	req := CommandRequest{"ListRemoveIndex", []string{key, strconv.Itoa(index)}}
-	res := internalProcess(req, c)
+	return c.ListRemoveIndexContext(context.Background(), key, index)
+}
+
+func (c goodiesClient) ListRemoveIndexContext(ctx context.Context, key string, index int) error {
+	req := CommandRequest{Name: "ListRemoveIndex", Parameters: []string{key, strconv.Itoa(index)}}
+	res := internalProcessContext(ctx, req, c)
 	if !res.Success {
 		return res.Err
 	}
@@ -93,8 +172,12 @@ func (c goodiesClient) ListRemoveIndex(key string, index int) error {
 }
 
 func (c goodiesClient) ListRemoveValue(key string, value string) error {
-	req := CommandRequest{"ListRemoveIndex", []string{key, value}}
-	res := internalProcess(req, c)
+	return c.ListRemoveValueContext(context.Background(), key, value)
+}
+
+func (c goodiesClient) ListRemoveValueContext(ctx context.Context, key string, value string) error {
+	req := CommandRequest{Name: "ListRemoveValue", Parameters: []string{key, value}}
+	res := internalProcessContext(ctx, req, c)
 	if !res.Success {
 		return res.Err
 	}
@@ -102,8 +185,12 @@ func (c goodiesClient) ListRemoveValue(key string, value string) error {
 }
 
 func (c goodiesClient) ListGetByIndex(key string, index int) (string, error) {
-	req := CommandRequest{"ListGetByIndex", []string{key, strconv.Itoa(index)}}
-	res := internalProcess(req, c)
+	return c.ListGetByIndexContext(context.Background(), key, index)
+}
+
+func (c goodiesClient) ListGetByIndexContext(ctx context.Context, key string, index int) (string, error) {
+	req := CommandRequest{Name: "ListGetByIndex", Parameters: []string{key, strconv.Itoa(index)}}
+	res := internalProcessContext(ctx, req, c)
 	if !res.Success {
 		return "", res.Err
 	}
@@ -111,8 +198,12 @@ func (c goodiesClient) ListGetByIndex(key string, index int) (string, error) {
 }
 
 func (c goodiesClient) DictSet(key string, dictKey string, value string) error {
-	req := CommandRequest{"DictSet", []string{key, dictKey, value}}
-	res := internalProcess(req, c)
+	return c.DictSetContext(context.Background(), key, dictKey, value)
+}
+
+func (c goodiesClient) DictSetContext(ctx context.Context, key string, dictKey string, value string) error {
+	req := CommandRequest{Name: "DictSet", Parameters: []string{key, dictKey, value}}
+	res := internalProcessContext(ctx, req, c)
 	if !res.Success {
 		return res.Err
 	}
@@ -120,8 +211,12 @@ func (c goodiesClient) DictSet(key string, dictKey string, value string) error {
 }
 
 func (c goodiesClient) DictGet(key string, dictKey string) (string, error) {
-	req := CommandRequest{"DictGet", []string{key, dictKey}}
-	res := internalProcess(req, c)
+	return c.DictGetContext(context.Background(), key, dictKey)
+}
+
+func (c goodiesClient) DictGetContext(ctx context.Context, key string, dictKey string) (string, error) {
+	req := CommandRequest{Name: "DictGet", Parameters: []string{key, dictKey}}
+	res := internalProcessContext(ctx, req, c)
 	if !res.Success {
 		return "", res.Err
 	}
@@ -129,8 +224,12 @@ func (c goodiesClient) DictGet(key string, dictKey string) (string, error) {
 }
 
 func (c goodiesClient) DictRemove(key string, dictKey string) error {
-	req := CommandRequest{"DictRemove", []string{key, dictKey}}
-	res := internalProcess(req, c)
+	return c.DictRemoveContext(context.Background(), key, dictKey)
+}
+
+func (c goodiesClient) DictRemoveContext(ctx context.Context, key string, dictKey string) error {
+	req := CommandRequest{Name: "DictRemove", Parameters: []string{key, dictKey}}
+	res := internalProcessContext(ctx, req, c)
 	if !res.Success {
 		return res.Err
 	}
@@ -138,8 +237,12 @@ func (c goodiesClient) DictRemove(key string, dictKey string) error {
 }
 
 func (c goodiesClient) DictHasKey(key string, dictKey string) (bool, error) {
-	req := CommandRequest{"DictHasKey", []string{key, dictKey}}
-	res := internalProcess(req, c)
+	return c.DictHasKeyContext(context.Background(), key, dictKey)
+}
+
+func (c goodiesClient) DictHasKeyContext(ctx context.Context, key string, dictKey string) (bool, error) {
+	req := CommandRequest{Name: "DictHasKey", Parameters: []string{key, dictKey}}
+	res := internalProcessContext(ctx, req, c)
 	if !res.Success {
 		return false, res.Err
 	}
@@ -150,7 +253,61 @@ func (c goodiesClient) DictHasKey(key string, dictKey string) (bool, error) {
 }
 
 func (c goodiesClient) SetExpiry(key string, ttl time.Duration) error {
-	req := CommandRequest{"SetExpiry", []string{key, ttlAsString(ttl)}}
+	return c.SetExpiryContext(context.Background(), key, ttl)
+}
+
+func (c goodiesClient) SetExpiryContext(ctx context.Context, key string, ttl time.Duration) error {
+	req := CommandRequest{Name: "SetExpiry", Parameters: []string{key, ttlAsString(ttl)}}
+	res := internalProcessContext(ctx, req, c)
+	if !res.Success {
+		return res.Err
+	}
+	return nil
+}
+
+func (c goodiesClient) Publish(channel string, message string) (int, error) {
+	return c.PublishContext(context.Background(), channel, message)
+}
+
+func (c goodiesClient) PublishContext(ctx context.Context, channel string, message string) (int, error) {
+	req := CommandRequest{Name: "Publish", Parameters: []string{channel, message}}
+	res := internalProcessContext(ctx, req, c)
+	if !res.Success {
+		return 0, res.Err
+	}
+	received, _ := strconv.Atoi(res.Result)
+	return received, nil
+}
+
+func (c goodiesClient) Subscribe(channels ...string) (*Subscription, error) {
+	return c.subscribe(channels, nil)
+}
+
+func (c goodiesClient) PatternSubscribe(patterns ...string) (*Subscription, error) {
+	if err := validatePatterns(patterns); err != nil {
+		return nil, err
+	}
+	return c.subscribe(nil, patterns)
+}
+
+func (c goodiesClient) subscribe(channels []string, patterns []string) (*Subscription, error) {
+	transport, ok := c.transport.(subscribingTransport)
+	if !ok {
+		return nil, ErrInternalError{"Transport doesn't support subscriptions"}
+	}
+	return transport.subscribe(channels, patterns)
+}
+
+func (c goodiesClient) Watch(prefix string) (*Watcher, error) {
+	transport, ok := c.transport.(watchingTransport)
+	if !ok {
+		return nil, ErrInternalError{"Transport doesn't support watching"}
+	}
+	return transport.watch(prefix)
+}
+
+func (c goodiesClient) ReplicaOf(leader string) error {
+	req := CommandRequest{Name: "ReplicaOf", Parameters: []string{leader}}
 	res := internalProcess(req, c)
 	if !res.Success {
 		return res.Err
@@ -158,6 +315,23 @@ func (c goodiesClient) SetExpiry(key string, ttl time.Duration) error {
 	return nil
 }
 
+func (c goodiesClient) Role() (ReplicationInfo, error) {
+	return c.RoleContext(context.Background())
+}
+
+func (c goodiesClient) RoleContext(ctx context.Context) (ReplicationInfo, error) {
+	req := CommandRequest{Name: "Role", Parameters: []string{}}
+	res := internalProcessContext(ctx, req, c)
+	if !res.Success {
+		return ReplicationInfo{}, res.Err
+	}
+	var info ReplicationInfo
+	if err := json.Unmarshal([]byte(res.Result), &info); err != nil {
+		return ReplicationInfo{}, ErrTransformation{err.Error()}
+	}
+	return info, nil
+}
+
 func ttlAsString(ttl time.Duration) string {
 	if ttl == ExpireDefault {
 		return "-2"
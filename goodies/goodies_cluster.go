@@ -0,0 +1,692 @@
+package goodies
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ClusterSlots Amount of hash slots keys are distributed over in cluster mode
+	ClusterSlots = 16384
+
+	// SlotMigrating Slot state set on the owner while its keys are moved to the node
+	SlotMigrating = "MIGRATING"
+	// SlotImporting Slot state set on the node receiving keys from the owner
+	SlotImporting = "IMPORTING"
+	// SlotStable Clears migrating and importing state of a slot
+	SlotStable = "STABLE"
+	// SlotNode Assigns slot to the node clearing its migrating and importing state
+	SlotNode = "NODE"
+
+	// clusterMaxRedirects Amount of MOVED/ASK redirects cluster client follows for a single command
+	clusterMaxRedirects = 5
+	// clusterMigrateTimeout Timeout of transferring a single key to another node
+	clusterMigrateTimeout = 5 * time.Second
+	// clusterMigrateAttempts Amount of times a key written while being transferred is sent again
+	clusterMigrateAttempts = 3
+)
+
+// ClusterSlotRange Continuous range of slots served by a node
+type ClusterSlotRange struct {
+	From int
+	To   int
+	Node string
+}
+
+// ClusterAdmin Cluster management interface implemented by the client returned from NewGoodiesClient
+// Cluster configuration is kept in memory only, it has to be set again after a server restart
+type ClusterAdmin interface {
+	// ClusterEnable Turns cluster mode on, self is the address other nodes and clients use for the server
+	ClusterEnable(self string) error
+	// ClusterSetSlots Assigns slots from-to (inclusive) to the node
+	ClusterSetSlots(from int, to int, node string) error
+	// ClusterSetSlot Changes state of a single slot (see Slot* constants), node is ignored for SlotStable
+	ClusterSetSlot(slot int, state string, node string) error
+	ClusterSlots() ([]ClusterSlotRange, error)
+	ClusterKeysInSlot(slot int, count int) ([]string, error)
+	// Migrate Atomically moves the key to the target node, returns false if the key doesn't exist
+	Migrate(target string, key string) (bool, error)
+}
+
+// KeySlot Returns cluster slot of the key
+// Only the part inside the first non-empty {hashtag} is hashed, so related keys can share a slot
+func KeySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key)) % ClusterSlots
+}
+
+// crc16 CRC16-XMODEM checksum
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// cluster Slot ownership as known by a server, cluster mode is off until self is set
+type cluster struct {
+	lock      sync.RWMutex
+	self      string
+	slots     [ClusterSlots]string
+	migrating map[int]string
+	importing map[int]string
+}
+
+func newCluster() *cluster {
+	return &cluster{migrating: make(map[int]string), importing: make(map[int]string)}
+}
+
+// checkKey Returns ErrMoved or ErrAsk if the key has to be served by another node
+func (c *cluster) checkKey(key string, asking bool, storage Provider) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.self == "" {
+		return nil
+	}
+	slot := KeySlot(key)
+	owner := c.slots[slot]
+	if owner == c.self {
+		if target, migrating := c.migrating[slot]; migrating && !storageHasKey(storage, key) {
+			return ErrAsk{slot, target}
+		}
+		return nil
+	}
+	if _, importing := c.importing[slot]; importing && asking {
+		return nil
+	}
+	if owner == "" {
+		return ErrInternalError{fmt.Sprintf("Slot %v is not served by any node", slot)}
+	}
+	return ErrMoved{slot, owner}
+}
+
+func (c *cluster) enable(self string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.self = self
+}
+
+func (c *cluster) setSlots(from int, to int, node string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for slot := from; slot <= to; slot++ {
+		c.slots[slot] = node
+	}
+}
+
+func (c *cluster) setSlot(slot int, state string, node string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	switch state {
+	case SlotMigrating:
+		c.migrating[slot] = node
+	case SlotImporting:
+		c.importing[slot] = node
+	case SlotStable:
+		delete(c.migrating, slot)
+		delete(c.importing, slot)
+	case SlotNode:
+		c.slots[slot] = node
+		delete(c.migrating, slot)
+		delete(c.importing, slot)
+	default:
+		return ErrCommandArgumentsMismatch{fmt.Sprintf("Unknown slot state %v", state)}
+	}
+	return nil
+}
+
+// ranges Returns assigned slots merged into continuous ranges
+func (c *cluster) ranges() []ClusterSlotRange {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	ranges := []ClusterSlotRange{}
+	for slot, node := range c.slots {
+		if node == "" {
+			continue
+		}
+		if last := len(ranges) - 1; last >= 0 && ranges[last].Node == node && ranges[last].To == slot-1 {
+			ranges[last].To = slot
+			continue
+		}
+		ranges = append(ranges, ClusterSlotRange{From: slot, To: slot, Node: node})
+	}
+	return ranges
+}
+
+// dumper is implemented by storages able to move items between servers
+type dumper interface {
+	hasKey(key string) bool
+	dump(key string) ([]byte, error)
+	restore(key string, data []byte) error
+	removeIfUnchanged(key string, data []byte) (bool, error)
+}
+
+// storageHasKey Reports if the key exists, storages not supporting migration are assumed to have every key
+func storageHasKey(storage Provider, key string) bool {
+	dumper, ok := storage.(dumper)
+	return !ok || dumper.hasKey(key)
+}
+
+func (g *GoodiesStorage) hasKey(key string) bool {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	_, found := g.internalGet(key)
+	return found
+}
+
+// dump Encodes the item of any type keeping its absolute expiry
+func (g *GoodiesStorage) dump(key string) ([]byte, error) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	if _, found := g.internalGet(key); !found {
+		return nil, ErrNotFound{key}
+	}
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(g.storage[key]); err != nil {
+		return nil, ErrTransformation{err.Error()}
+	}
+	return data.Bytes(), nil
+}
+
+// restore Replaces the item with the one encoded by dump, items expired in transit are dropped
+func (g *GoodiesStorage) restore(key string, data []byte) error {
+	var item goodiesItem
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&item); err != nil {
+		return ErrTransformation{err.Error()}
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.internalExpire(key)
+	if checkExpiry(item.Expiry) {
+		return nil
+	}
+	if lock, isLock := item.Value.(lockItem); isLock {
+		g.internalFence(key, lock.Token)
+	}
+	g.storage[key] = item
+	g.emit(KeySet, key)
+	return nil
+}
+
+// removeIfUnchanged Removes the item if it still is the one encoded by dump, reports if it was removed
+func (g *GoodiesStorage) removeIfUnchanged(key string, data []byte) (bool, error) {
+	var dumped goodiesItem
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&dumped); err != nil {
+		return false, ErrTransformation{err.Error()}
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.internalExpire(key)
+	item, found := g.storage[key]
+	if !found {
+		return false, nil
+	}
+	// the current item goes through the same encoding so both sides are compared decoded the same way
+	var encoded bytes.Buffer
+	var current goodiesItem
+	if err := gob.NewEncoder(&encoded).Encode(item); err != nil {
+		return false, ErrTransformation{err.Error()}
+	}
+	if err := gob.NewDecoder(&encoded).Decode(&current); err != nil {
+		return false, ErrTransformation{err.Error()}
+	}
+	if !reflect.DeepEqual(current, dumped) {
+		return false, nil
+	}
+	g.internalRemove(key)
+	g.emit(KeyRemoved, key)
+	return true, nil
+}
+
+func dumpCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 1 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"Dump command is expected to have 1 argument (key)"})
+	}
+	dumper, ok := storage.(dumper)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support dumps"})
+	}
+	data, err := dumper.dump(command.Parameters[0])
+	if err != nil {
+		return createErrorResult(err)
+	}
+	return createOkResult(base64.StdEncoding.EncodeToString(data))
+}
+
+func restoreCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 2 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"Restore command is expected to have 2 arguments (key, data)"})
+	}
+	dumper, ok := storage.(dumper)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support dumps"})
+	}
+	data, err := base64.StdEncoding.DecodeString(command.Parameters[1])
+	if err != nil {
+		return createErrorResult(ErrTransformation{err.Error()})
+	}
+	if err = dumper.restore(command.Parameters[0], data); err != nil {
+		return createErrorResult(err)
+	}
+	return createOkResult("")
+}
+
+func (gcp *goodiesCommandProcessor) clusterEnableCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 1 || command.Parameters[0] == "" {
+		return createErrorResult(ErrCommandArgumentsMismatch{"ClusterEnable command is expected to have 1 argument (own address)"})
+	}
+	gcp.cluster.enable(command.Parameters[0])
+	return createOkResult("")
+}
+
+func (gcp *goodiesCommandProcessor) clusterSetSlotsCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 3 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"ClusterSetSlots command is expected to have 3 arguments (from(INT), to(INT), node)"})
+	}
+	from, err := parseSlot(command.Parameters[0])
+	if err != nil {
+		return createErrorResult(err)
+	}
+	to, err := parseSlot(command.Parameters[1])
+	if err != nil {
+		return createErrorResult(err)
+	}
+	gcp.cluster.setSlots(from, to, command.Parameters[2])
+	return createOkResult("")
+}
+
+func (gcp *goodiesCommandProcessor) clusterSetSlotCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 3 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"ClusterSetSlot command is expected to have 3 arguments (slot(INT), state, node)"})
+	}
+	slot, err := parseSlot(command.Parameters[0])
+	if err != nil {
+		return createErrorResult(err)
+	}
+	if err = gcp.cluster.setSlot(slot, command.Parameters[1], command.Parameters[2]); err != nil {
+		return createErrorResult(err)
+	}
+	return createOkResult("")
+}
+
+func (gcp *goodiesCommandProcessor) clusterSlotsCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 0 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"ClusterSlots command is expected to have 0 arguments"})
+	}
+	data, err := json.Marshal(gcp.cluster.ranges())
+	if err != nil {
+		return createErrorResult(ErrTransformation{err.Error()})
+	}
+	return createOkResult(string(data))
+}
+
+func clusterKeysInSlotCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 2 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"ClusterKeysInSlot command is expected to have 2 arguments (slot(INT), count(INT))"})
+	}
+	slot, err := parseSlot(command.Parameters[0])
+	if err != nil {
+		return createErrorResult(err)
+	}
+	count, err := strconv.Atoi(command.Parameters[1])
+	if err != nil || count < 1 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"ClusterKeysInSlot count is expected to be a positive integer"})
+	}
+	keys, err := storage.Keys()
+	if err != nil {
+		return createErrorResult(err)
+	}
+	sort.Strings(keys)
+	inSlot := make([]string, 0, count)
+	for _, key := range keys {
+		if len(inSlot) == count {
+			break
+		}
+		if KeySlot(key) == slot {
+			inSlot = append(inSlot, key)
+		}
+	}
+	return createOkResult(strings.Join(inSlot, ":"))
+}
+
+// migrateCommandHandler Moves the key to the target node
+// The key is sent without blocking other writes, it is removed (and replicated to own followers as Remove)
+// under the replication lock only if it was not written in the meantime, otherwise it is sent again
+func (gcp *goodiesCommandProcessor) migrateCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 2 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"Migrate command is expected to have 2 arguments (target, key)"})
+	}
+	target, key := command.Parameters[0], command.Parameters[1]
+	dumper, ok := storage.(dumper)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support dumps"})
+	}
+	remove := CommandRequest{Name: "Remove", Parameters: []string{key}}
+	transport := gcp.replication.peerClient(target)
+	transport.client.Timeout = clusterMigrateTimeout
+	client := goodiesClient{transport}
+	for attempt := 0; attempt < clusterMigrateAttempts; attempt++ {
+		data, err := dumper.dump(key)
+		if _, notFound := err.(ErrNotFound); notFound {
+			if attempt > 0 {
+				// the key was removed while being sent, so is the sent copy
+				discard := CommandRequest{Name: "Remove", Parameters: []string{key}, Asking: true}
+				if res := internalProcessContext(command.Context(), discard, client); !res.Success {
+					return res
+				}
+			}
+			return createOkResult("0")
+		}
+		if err != nil {
+			return createErrorResult(err)
+		}
+		restore := CommandRequest{
+			Name:       "Restore",
+			Parameters: []string{key, base64.StdEncoding.EncodeToString(data)},
+			Asking:     true,
+		}
+		if res := internalProcessContext(command.Context(), restore, client); !res.Success {
+			return res
+		}
+		var removed bool
+		res := gcp.replication.write(func() (CommandResponse, []CommandRequest) {
+			var err error
+			if removed, err = dumper.removeIfUnchanged(key, data); err != nil {
+				return createErrorResult(err), nil
+			}
+			if !removed {
+				return createOkResult("0"), nil
+			}
+			return createOkResult("1"), []CommandRequest{remove}
+		})
+		if !res.Success || removed {
+			return res
+		}
+	}
+	return createErrorResult(ErrInternalError{fmt.Sprintf("Key %v kept changing while migrated", key)})
+}
+
+func parseSlot(s string) (int, error) {
+	slot, err := strconv.Atoi(s)
+	if err != nil || slot < 0 || slot >= ClusterSlots {
+		return 0, ErrCommandArgumentsMismatch{fmt.Sprintf("Slot is expected to be an integer in range 0-%v", ClusterSlots-1)}
+	}
+	return slot, nil
+}
+
+func (c goodiesClient) ClusterEnable(self string) error {
+	req := CommandRequest{Name: "ClusterEnable", Parameters: []string{self}}
+	res := internalProcess(req, c)
+	if !res.Success {
+		return res.Err
+	}
+	return nil
+}
+
+func (c goodiesClient) ClusterSetSlots(from int, to int, node string) error {
+	req := CommandRequest{Name: "ClusterSetSlots", Parameters: []string{strconv.Itoa(from), strconv.Itoa(to), node}}
+	res := internalProcess(req, c)
+	if !res.Success {
+		return res.Err
+	}
+	return nil
+}
+
+func (c goodiesClient) ClusterSetSlot(slot int, state string, node string) error {
+	req := CommandRequest{Name: "ClusterSetSlot", Parameters: []string{strconv.Itoa(slot), state, node}}
+	res := internalProcess(req, c)
+	if !res.Success {
+		return res.Err
+	}
+	return nil
+}
+
+func (c goodiesClient) ClusterSlots() ([]ClusterSlotRange, error) {
+	req := CommandRequest{Name: "ClusterSlots", Parameters: []string{}}
+	res := internalProcess(req, c)
+	if !res.Success {
+		return nil, res.Err
+	}
+	var ranges []ClusterSlotRange
+	if err := json.Unmarshal([]byte(res.Result), &ranges); err != nil {
+		return nil, ErrTransformation{err.Error()}
+	}
+	return ranges, nil
+}
+
+func (c goodiesClient) ClusterKeysInSlot(slot int, count int) ([]string, error) {
+	req := CommandRequest{Name: "ClusterKeysInSlot", Parameters: []string{strconv.Itoa(slot), strconv.Itoa(count)}}
+	res := internalProcess(req, c)
+	if !res.Success {
+		return nil, res.Err
+	}
+	if res.Result == "" {
+		return []string{}, nil
+	}
+	return strings.Split(res.Result, ":"), nil
+}
+
+func (c goodiesClient) Migrate(target string, key string) (bool, error) {
+	req := CommandRequest{Name: "Migrate", Parameters: []string{target, key}}
+	res := internalProcess(req, c)
+	if !res.Success {
+		return false, res.Err
+	}
+	return res.Result == "1", nil
+}
+
+// MigrateSlot Moves the slot with all its keys from source to target node while it keeps being served
+// nodes are addresses of all cluster nodes, they learn the new owner once all keys are moved
+// options (e.g. credentials) are applied to clients of all the nodes
+func MigrateSlot(nodes []string, slot int, source string, target string, options ...ClientOption) error {
+	sourceAdmin := NewGoodiesClient(source, options...).(ClusterAdmin)
+	targetAdmin := NewGoodiesClient(target, options...).(ClusterAdmin)
+	if err := targetAdmin.ClusterSetSlot(slot, SlotImporting, source); err != nil {
+		return err
+	}
+	if err := sourceAdmin.ClusterSetSlot(slot, SlotMigrating, target); err != nil {
+		return err
+	}
+	for {
+		keys, err := sourceAdmin.ClusterKeysInSlot(slot, 100)
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			break
+		}
+		for _, key := range keys {
+			if _, err := sourceAdmin.Migrate(target, key); err != nil {
+				return err
+			}
+		}
+	}
+	// target first, so the source never redirects to a node not yet knowing it owns the slot
+	if err := targetAdmin.ClusterSetSlot(slot, SlotNode, target); err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if node == target {
+			continue
+		}
+		if err := NewGoodiesClient(node, options...).(ClusterAdmin).ClusterSetSlot(slot, SlotNode, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clusterTransport Routes commands to the node owning the key slot following MOVED and ASK redirects
+type clusterTransport struct {
+	seeds   []string
+	options []ClientOption
+	lock    sync.Mutex
+	slots   [ClusterSlots]string
+	// nodes Sorted addresses of nodes in the slot map, refreshed whenever the slot map changes
+	nodes []string
+
+	clientsLock sync.Mutex
+	clients     map[string]GoodiesHttpCommandClient
+}
+
+// NewGoodiesClusterClient Creates a client of a goodies cluster, slot map is discovered from seed addresses
+// Keys is collected from all nodes, commands without a key are sent to any known node
+// Connection options (database, credentials, TLS) are applied to all nodes, the others are ignored
+func NewGoodiesClusterClient(seeds []string, options ...ClientOption) Provider {
+	return goodiesClient{&clusterTransport{seeds: seeds, options: options, clients: make(map[string]GoodiesHttpCommandClient)}}
+}
+
+func (t *clusterTransport) Process(req CommandRequest, res *CommandResponse) error {
+	return t.ProcessContext(context.Background(), req, res)
+}
+
+func (t *clusterTransport) ProcessContext(ctx context.Context, req CommandRequest, res *CommandResponse) error {
+	if req.Name == "Keys" {
+		return t.keys(ctx, req, res)
+	}
+	address, err := t.nodeFor(req)
+	if err != nil {
+		return err
+	}
+	for redirects := 0; ; redirects++ {
+		*res = CommandResponse{}
+		if err := t.client(address).ProcessContext(ctx, req, res); err != nil {
+			return err
+		}
+		if redirects == clusterMaxRedirects {
+			return nil
+		}
+		switch redirect := res.Err.(type) {
+		case ErrMoved:
+			t.lock.Lock()
+			t.slots[redirect.Slot] = redirect.Address
+			t.refreshNodes()
+			t.lock.Unlock()
+			address, req.Asking = redirect.Address, false
+		case ErrAsk:
+			// slot map is not updated as the slot still belongs to the current node
+			address, req.Asking = redirect.Address, true
+		default:
+			return nil
+		}
+	}
+}
+
+// nodeFor Returns address of the node serving the command, discovering slot map if it is unknown
+func (t *clusterTransport) nodeFor(req CommandRequest) (string, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.nodes == nil {
+		if err := t.discover(); err != nil {
+			return "", err
+		}
+	}
+	if keyedCommands[req.Name] && len(req.Parameters) > 0 {
+		if node := t.slots[KeySlot(req.Parameters[0])]; node != "" {
+			return node, nil
+		}
+	}
+	return t.nodes[0], nil
+}
+
+// discover Loads slot map from the first seed answering, must be called under lock
+func (t *clusterTransport) discover() error {
+	var lastErr error = ErrInternalError{"No cluster seeds given"}
+	for _, seed := range t.seeds {
+		ranges, err := goodiesClient{t.client(seed)}.ClusterSlots()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, r := range ranges {
+			for slot := r.From; slot <= r.To; slot++ {
+				t.slots[slot] = r.Node
+			}
+		}
+		t.refreshNodes()
+		if t.nodes != nil {
+			return nil
+		}
+		lastErr = ErrInternalError{fmt.Sprintf("No slots assigned according to %v", seed)}
+	}
+	return lastErr
+}
+
+// refreshNodes Collects addresses of nodes in the slot map, must be called under lock
+func (t *clusterTransport) refreshNodes() {
+	unique := make(map[string]bool)
+	for _, node := range t.slots {
+		if node != "" {
+			unique[node] = true
+		}
+	}
+	var nodes []string
+	for node := range unique {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	t.nodes = nodes
+}
+
+// keys Collects keys from all nodes in the slot map
+func (t *clusterTransport) keys(ctx context.Context, req CommandRequest, res *CommandResponse) error {
+	t.lock.Lock()
+	if t.nodes == nil {
+		if err := t.discover(); err != nil {
+			t.lock.Unlock()
+			return err
+		}
+	}
+	nodes := t.nodes
+	t.lock.Unlock()
+
+	sharded := NewShardedProvider(1)
+	for _, node := range nodes {
+		sharded.AddNode(node, goodiesClient{t.client(node)})
+	}
+	keys, err := sharded.KeysContext(ctx)
+	if err != nil {
+		*res = createErrorResult(err)
+		return nil
+	}
+	data, err := json.Marshal(keys)
+	if err != nil {
+		*res = createErrorResult(ErrTransformation{err.Error()})
+		return nil
+	}
+	*res = createOkResult(string(data))
+	return nil
+}
+
+func (t *clusterTransport) client(address string) GoodiesHttpCommandClient {
+	t.clientsLock.Lock()
+	defer t.clientsLock.Unlock()
+	client, ok := t.clients[address]
+	if !ok {
+		client = connectedTransport(address, t.options)
+		t.clients[address] = client
+	}
+	return client
+}
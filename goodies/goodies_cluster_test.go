@@ -0,0 +1,155 @@
+package goodies
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestKeySlot(testing *testing.T) {
+	if slot := KeySlot("123456789"); slot != 12739 {
+		testing.Errorf("Unexpected slot of reference key: %v", slot)
+	}
+	if KeySlot("{user1000}.following") != KeySlot("{user1000}.followers") {
+		testing.Error("Keys sharing hashtag are expected to share slot")
+	}
+	if KeySlot("foo{}{bar}") != int(crc16("foo{}{bar}"))%ClusterSlots {
+		testing.Error("Empty hashtag is expected to hash the whole key")
+	}
+}
+
+func newTestCluster(testing *testing.T, size int) ([]string, func()) {
+	var servers []*httptest.Server
+	var nodes []string
+	for i := 0; i < size; i++ {
+		server := httptest.NewServer(newGoodiesHTTPHandler(NewGoodiesStorage(ExpireNever)))
+		servers = append(servers, server)
+		nodes = append(nodes, server.URL)
+	}
+	for _, node := range nodes {
+		admin := NewGoodiesClient(node).(ClusterAdmin)
+		if err := admin.ClusterEnable(node); err != nil {
+			testing.Fatalf("Unexpected error on cluster enable: %v", err)
+		}
+		for i, owner := range nodes {
+			from, to := i*ClusterSlots/size, (i+1)*ClusterSlots/size-1
+			if err := admin.ClusterSetSlots(from, to, owner); err != nil {
+				testing.Fatalf("Unexpected error on slots assignment: %v", err)
+			}
+		}
+	}
+	return nodes, func() {
+		for _, server := range servers {
+			server.Close()
+		}
+	}
+}
+
+func TestClusterRedirects(testing *testing.T) {
+	nodes, closeCluster := newTestCluster(testing, 3)
+	defer closeCluster()
+
+	ranges, err := NewGoodiesClient(nodes[0]).(ClusterAdmin).ClusterSlots()
+	if err != nil || len(ranges) != 3 || ranges[2].To != ClusterSlots-1 || ranges[1].Node != nodes[1] {
+		testing.Fatalf("Unexpected slot ranges: %+v %v", ranges, err)
+	}
+
+	client := NewGoodiesClusterClient(nodes[:1])
+	keys := []string{"alpha", "beta", "gamma", "delta", "epsilon"}
+	for _, key := range keys {
+		if err := client.Set(key, key+"-value", ExpireNever); err != nil {
+			testing.Fatalf("Unexpected error on set through cluster client: %v", err)
+		}
+	}
+	for _, key := range keys {
+		owner := nodes[KeySlot(key)*3/ClusterSlots]
+		if val, err := NewGoodiesClient(owner).Get(key); err != nil || val != key+"-value" {
+			testing.Errorf("Key %v is not stored by its owner: %v %v", key, val, err)
+		}
+		for _, node := range nodes {
+			if node == owner {
+				continue
+			}
+			_, err := NewGoodiesClient(node).Get(key)
+			if moved, ok := err.(ErrMoved); !ok || moved.Address != owner || moved.Slot != KeySlot(key) {
+				testing.Errorf("Expected MOVED to %v for %v, got %v", owner, key, err)
+			}
+		}
+	}
+	all, err := client.Keys()
+	if err != nil || len(all) != len(keys) {
+		testing.Errorf("Unexpected keys collected from cluster: %v %v", all, err)
+	}
+}
+
+func TestClusterSlotMigration(testing *testing.T) {
+	nodes, closeCluster := newTestCluster(testing, 2)
+	defer closeCluster()
+
+	client := NewGoodiesClusterClient(nodes)
+	slot := KeySlot("{user}")
+	source := nodes[slot*2/ClusterSlots]
+	target := nodes[0]
+	if source == target {
+		target = nodes[1]
+	}
+	client.Set("{user}.name", "john", ExpireNever)
+	client.ListPush("{user}.roles", "admin")
+	client.DictSet("{user}.address", "city", "Berlin")
+
+	sourceAdmin := NewGoodiesClient(source).(ClusterAdmin)
+	targetAdmin := NewGoodiesClient(target).(ClusterAdmin)
+	targetAdmin.ClusterSetSlot(slot, SlotImporting, source)
+	sourceAdmin.ClusterSetSlot(slot, SlotMigrating, target)
+	if moved, err := sourceAdmin.Migrate(target, "{user}.name"); err != nil || !moved {
+		testing.Fatalf("Key was not migrated: %v", err)
+	}
+
+	_, err := NewGoodiesClient(source).Get("{user}.name")
+	if ask, ok := err.(ErrAsk); !ok || ask.Address != target {
+		testing.Errorf("Expected ASK redirect for migrated key, got %v", err)
+	}
+	if _, err := NewGoodiesClient(target).Get("{user}.name"); err == nil {
+		testing.Error("Importing node is not expected to serve keys without asking")
+	}
+	if val, err := client.Get("{user}.name"); err != nil || val != "john" {
+		testing.Errorf("Cluster client didn't follow ASK redirect: %v %v", val, err)
+	}
+	if val, err := client.DictGet("{user}.address", "city"); err != nil || val != "Berlin" {
+		testing.Errorf("Not yet migrated key is expected to be served by source: %v %v", val, err)
+	}
+
+	if err := MigrateSlot(nodes, slot, source, target); err != nil {
+		testing.Fatalf("Unexpected error on slot migration: %v", err)
+	}
+	if keys, _ := sourceAdmin.ClusterKeysInSlot(slot, 10); len(keys) != 0 {
+		testing.Errorf("Keys left on source after migration: %v", keys)
+	}
+	if val, err := client.ListGetByIndex("{user}.roles", 0); err != nil || val != "admin" {
+		testing.Errorf("Migrated list is not available: %v %v", val, err)
+	}
+	if val, err := client.DictGet("{user}.address", "city"); err != nil || val != "Berlin" {
+		testing.Errorf("Migrated dict is not available: %v %v", val, err)
+	}
+	_, err = NewGoodiesClient(source).Get("{user}.name")
+	if moved, ok := err.(ErrMoved); !ok || moved.Address != target {
+		testing.Errorf("Expected MOVED to new owner, got %v", err)
+	}
+}
+
+func TestRemoveIfUnchanged(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	storage.DictSet("dict", "first", "1")
+	storage.DictSet("dict", "second", "2")
+	data, _ := storage.dump("dict")
+	storage.DictSet("dict", "third", "3")
+	if removed, err := storage.removeIfUnchanged("dict", data); err != nil || removed {
+		testing.Errorf("Item written after dump is not expected to be removed: %v", err)
+	}
+	data, _ = storage.dump("dict")
+	if removed, err := storage.removeIfUnchanged("dict", data); err != nil || !removed {
+		testing.Errorf("Unchanged item is expected to be removed: %v", err)
+	}
+	if storage.hasKey("dict") {
+		testing.Error("Removed item is still stored")
+	}
+}
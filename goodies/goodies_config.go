@@ -0,0 +1,501 @@
+package goodies
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// PersistenceSnapshot Items are periodically saved to Persistence.Path and loaded on start
+	PersistenceSnapshot = "snapshot"
+	// PersistenceNone Items live in memory only
+	PersistenceNone = "none"
+
+	// configEnvPrefix Prefix of environment variables overriding the config file, e.g. GOODIES_LISTEN
+	configEnvPrefix = "GOODIES_"
+	// redactedSecret Printed in place of plain secrets
+	redactedSecret = "<redacted>"
+)
+
+// ConfigDuration Duration written as a string ("30s", "1m") in config files
+type ConfigDuration time.Duration
+
+func (d ConfigDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *ConfigDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = ConfigDuration(parsed)
+	return nil
+}
+
+// PersistenceConfig Configures how items survive restarts
+type PersistenceConfig struct {
+	Mode     string         `json:"mode"`
+	Path     string         `json:"path"`
+	Interval ConfigDuration `json:"interval"`
+	// EncryptionKeyFile File of keys encrypting snapshots (see ParseEncryptionKeys), snapshots are plain if no keys are set
+	EncryptionKeyFile string `json:"encryptionKeyFile,omitempty"`
+	// EncryptionKeys Keys given inline, only by environment (GOODIES_ENCRYPTION_KEYS) or flag, never written to files
+	EncryptionKeys string `json:"-"`
+}
+
+// LogConfig Configures server output
+type LogConfig struct {
+	// File Output is appended to the file instead of stdout if it is set
+	File string `json:"file,omitempty"`
+}
+
+// AuthConfig Configures authentication, server without tokens and users accepts anyone
+// Secrets are stored as hashes made by HashToken and HashPassword (goodies-server -hash-secret)
+type AuthConfig struct {
+	// Tokens Static API token hashes by the identity they authenticate
+	Tokens map[string]string `json:"tokens,omitempty"`
+	// Users Password hashes by username
+	Users map[string]string `json:"users,omitempty"`
+	// PeerToken Plain token the server presents to other nodes, i.e. its leader and migration targets
+	PeerToken string `json:"peerToken,omitempty"`
+}
+
+// ServerConfig Configuration of goodies-server
+// Values are taken from defaults overridden by the config file, environment (GOODIES_*) and flags in that order
+type ServerConfig struct {
+	// Listen Comma separated addresses the HTTP transport (commands, REST and event streams) listens on,
+	// empty if the server is reached through UnixSocket only
+	Listen string `json:"listen"`
+	// UnixSocket Path of a unix socket the HTTP transport listens on besides Listen, it is served without TLS
+	// as the socket is protected by permissions of the file
+	UnixSocket string `json:"unixSocket,omitempty"`
+	// DefaultTTL Expiry of items stored with ExpireDefault, 0 means they never expire
+	DefaultTTL  ConfigDuration    `json:"defaultTTL"`
+	Persistence PersistenceConfig `json:"persistence"`
+	// ReplicaOf Address of the leader to follow on start, empty for a leader
+	ReplicaOf string `json:"replicaOf,omitempty"`
+	// ShutdownTimeout Time in-flight requests are given to finish on shutdown
+	ShutdownTimeout ConfigDuration `json:"shutdownTimeout"`
+	Log             LogConfig      `json:"log"`
+	Auth            AuthConfig     `json:"auth"`
+	TLS             TLSConfig      `json:"tls"`
+	Memory          MemoryConfig   `json:"memory"`
+}
+
+// DefaultServerConfig Returns configuration used when nothing is overridden
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		Listen:     ":9006",
+		DefaultTTL: ConfigDuration(time.Minute),
+		Persistence: PersistenceConfig{
+			Mode:     PersistenceSnapshot,
+			Path:     "./goodies.dat",
+			Interval: ConfigDuration(30 * time.Second),
+		},
+		ShutdownTimeout: ConfigDuration(10 * time.Second),
+		Memory:          MemoryConfig{Policy: MemoryPolicyNoEviction},
+	}
+}
+
+// Validate Returns ErrInvalidConfig describing the first invalid setting
+func (c ServerConfig) Validate() error {
+	if c.Listen == "" && c.UnixSocket == "" {
+		return ErrInvalidConfig{"listen address or unixSocket is required"}
+	}
+	for _, address := range c.tcpAddresses() {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return ErrInvalidConfig{fmt.Sprintf("listen address %q is not host:port", address)}
+		}
+	}
+	if c.DefaultTTL < 0 {
+		return ErrInvalidConfig{"defaultTTL cannot be negative"}
+	}
+	if c.ShutdownTimeout <= 0 {
+		return ErrInvalidConfig{"shutdownTimeout has to be positive"}
+	}
+	switch c.Persistence.Mode {
+	case PersistenceSnapshot:
+		if c.Persistence.Path == "" {
+			return ErrInvalidConfig{"persistence path is required for snapshot mode"}
+		}
+		if c.Persistence.Interval <= 0 {
+			return ErrInvalidConfig{"persistence interval has to be positive"}
+		}
+	case PersistenceNone:
+		if c.Persistence.EncryptionKeyFile != "" || c.Persistence.EncryptionKeys != "" {
+			return ErrInvalidConfig{"encryption keys require snapshot persistence"}
+		}
+	default:
+		return ErrInvalidConfig{fmt.Sprintf("unknown persistence mode %q (expected %v or %v)", c.Persistence.Mode, PersistenceSnapshot, PersistenceNone)}
+	}
+	if c.Persistence.EncryptionKeyFile != "" && c.Persistence.EncryptionKeys != "" {
+		return ErrInvalidConfig{"encryption keys are expected either in a file or inline, not both"}
+	}
+	if c.Persistence.EncryptionKeys != "" {
+		if _, err := ParseEncryptionKeys(c.Persistence.EncryptionKeys); err != nil {
+			return err
+		}
+	}
+	if err := c.TLS.validate(); err != nil {
+		return err
+	}
+	if err := c.Memory.validate(); err != nil {
+		return err
+	}
+	for identity, hash := range c.Auth.Tokens {
+		if _, err := parseTokenHash(hash); err != nil {
+			return ErrInvalidConfig{fmt.Sprintf("auth token %v: %v", identity, err)}
+		}
+	}
+	for username, hash := range c.Auth.Users {
+		if _, err := parsePasswordHash(hash); err != nil {
+			return ErrInvalidConfig{fmt.Sprintf("auth user %v: %v", username, err)}
+		}
+	}
+	return nil
+}
+
+// tcpAddresses Returns addresses of Listen
+func (c ServerConfig) tcpAddresses() []string {
+	if c.Listen == "" {
+		return nil
+	}
+	addresses := strings.Split(c.Listen, ",")
+	for i, address := range addresses {
+		addresses[i] = strings.TrimSpace(address)
+	}
+	return addresses
+}
+
+// ListenAddresses Returns all addresses the server listens on, the unix socket as a client address (unix://path)
+func (c ServerConfig) ListenAddresses() []string {
+	addresses := c.tcpAddresses()
+	if c.UnixSocket != "" {
+		addresses = append(addresses, unixSocketScheme+c.UnixSocket)
+	}
+	return addresses
+}
+
+// Print Writes the configuration as an indented config file, plain secrets (PeerToken) are redacted
+func (c ServerConfig) Print(w io.Writer) error {
+	if c.Auth.PeerToken != "" {
+		c.Auth.PeerToken = redactedSecret
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// configSetting A setting configurable by flag and environment
+type configSetting struct {
+	flag  string
+	usage string
+	set   func(c *ServerConfig, value string) error
+}
+
+func durationSetting(target func(c *ServerConfig) *ConfigDuration) func(c *ServerConfig, value string) error {
+	return func(c *ServerConfig, value string) error {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*target(c) = ConfigDuration(parsed)
+		return nil
+	}
+}
+
+func bytesSetting(target func(c *ServerConfig) *int64) func(c *ServerConfig, value string) error {
+	return func(c *ServerConfig, value string) error {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		*target(c) = parsed
+		return nil
+	}
+}
+
+func stringSetting(target func(c *ServerConfig) *string) func(c *ServerConfig, value string) error {
+	return func(c *ServerConfig, value string) error {
+		*target(c) = value
+		return nil
+	}
+}
+
+var configSettings = []configSetting{
+	{"listen", "comma separated addresses to listen on (host:port)", stringSetting(func(c *ServerConfig) *string { return &c.Listen })},
+	{"unix-socket", "path of a unix socket to listen on", stringSetting(func(c *ServerConfig) *string { return &c.UnixSocket })},
+	{"default-ttl", "expiry of items stored with default ttl, 0 for never", durationSetting(func(c *ServerConfig) *ConfigDuration { return &c.DefaultTTL })},
+	{"persistence-mode", "persistence mode (snapshot or none)", stringSetting(func(c *ServerConfig) *string { return &c.Persistence.Mode })},
+	{"persistence-path", "snapshot file path", stringSetting(func(c *ServerConfig) *string { return &c.Persistence.Path })},
+	{"persistence-interval", "interval between snapshots", durationSetting(func(c *ServerConfig) *ConfigDuration { return &c.Persistence.Interval })},
+	{"encryption-key-file", "file of keys encrypting snapshots", stringSetting(func(c *ServerConfig) *string { return &c.Persistence.EncryptionKeyFile })},
+	{"encryption-keys", "keys encrypting snapshots, preferably given by environment", stringSetting(func(c *ServerConfig) *string { return &c.Persistence.EncryptionKeys })},
+	{"replica-of", "address of the leader to follow", stringSetting(func(c *ServerConfig) *string { return &c.ReplicaOf })},
+	{"shutdown-timeout", "time in-flight requests are given to finish on shutdown", durationSetting(func(c *ServerConfig) *ConfigDuration { return &c.ShutdownTimeout })},
+	{"log-file", "file output is appended to instead of stdout", stringSetting(func(c *ServerConfig) *string { return &c.Log.File })},
+	{"auth-peer-token", "token presented to the leader and migration targets", stringSetting(func(c *ServerConfig) *string { return &c.Auth.PeerToken })},
+	{"tls-cert", "PEM certificate chain, enables TLS", stringSetting(func(c *ServerConfig) *string { return &c.TLS.CertFile })},
+	{"tls-key", "PEM private key of the certificate", stringSetting(func(c *ServerConfig) *string { return &c.TLS.KeyFile })},
+	{"tls-client-ca", "PEM bundle of CAs verifying client certificates", stringSetting(func(c *ServerConfig) *string { return &c.TLS.ClientCAFile })},
+	{"tls-client-auth", "client certificate verification (request or require)", stringSetting(func(c *ServerConfig) *string { return &c.TLS.ClientAuth })},
+	{"tls-peer-ca", "PEM bundle of CAs verifying other nodes", stringSetting(func(c *ServerConfig) *string { return &c.TLS.PeerCAFile })},
+	{"max-memory", "memory limit of items in bytes, 0 for unlimited", bytesSetting(func(c *ServerConfig) *int64 { return &c.Memory.MaxBytes })},
+	{"memory-policy", "handling of writes over the memory limit (noeviction or allkeys-random)", stringSetting(func(c *ServerConfig) *string { return &c.Memory.Policy })},
+}
+
+// configEnv Returns environment variable of the setting, e.g. GOODIES_PERSISTENCE_PATH for persistence-path
+func configEnv(flagName string) string {
+	return configEnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// ServerOptions Result of parsing goodies-server command line
+type ServerOptions struct {
+	Config ServerConfig
+	// ConfigFile Path of the config file (flag -config or GOODIES_CONFIG), empty if none is used
+	ConfigFile  string
+	PrintConfig bool
+	// HashSecret Kind of secret (token or password) to read from stdin and print the hash of instead of serving
+	HashSecret string
+}
+
+// LoadServerConfig Parses command line arguments (without the program name) and builds validated configuration,
+// lookupEnv is usually os.LookupEnv
+func LoadServerConfig(args []string, lookupEnv func(string) (string, bool)) (ServerOptions, error) {
+	var options ServerOptions
+	flags := flag.NewFlagSet("goodies-server", flag.ContinueOnError)
+	flags.StringVar(&options.ConfigFile, "config", "", "JSON config file (env "+configEnv("config")+")")
+	flags.BoolVar(&options.PrintConfig, "print-config", false, "print effective configuration and exit")
+	flags.StringVar(&options.HashSecret, "hash-secret", "", "read a secret from stdin, print its hash for the auth config and exit (token or password)")
+	values := make(map[string]*string, len(configSettings))
+	for _, setting := range configSettings {
+		values[setting.flag] = flags.String(setting.flag, "", setting.usage+" (env "+configEnv(setting.flag)+")")
+	}
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return options, err
+	} else if err != nil {
+		return options, ErrInvalidConfig{err.Error()}
+	}
+	if flags.NArg() > 0 {
+		return options, ErrInvalidConfig{fmt.Sprintf("unexpected arguments %v", flags.Args())}
+	}
+	if options.HashSecret != "" && options.HashSecret != "token" && options.HashSecret != "password" {
+		return options, ErrInvalidConfig{fmt.Sprintf("hash-secret is expected to be token or password, got %q", options.HashSecret)}
+	}
+	if options.ConfigFile == "" {
+		options.ConfigFile, _ = lookupEnv(configEnv("config"))
+	}
+
+	config, err := loadServerConfigFile(options.ConfigFile, lookupEnv)
+	if err != nil {
+		return options, err
+	}
+	var flagErr error
+	flags.Visit(func(f *flag.Flag) {
+		for _, setting := range configSettings {
+			if setting.flag == f.Name && flagErr == nil {
+				if err := setting.set(&config, *values[f.Name]); err != nil {
+					flagErr = ErrInvalidConfig{fmt.Sprintf("flag -%v: %v", f.Name, err)}
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return options, flagErr
+	}
+	options.Config = config
+	return options, config.Validate()
+}
+
+// loadServerConfigFile Returns defaults overridden by the file (if any) and environment
+func loadServerConfigFile(filename string, lookupEnv func(string) (string, bool)) (ServerConfig, error) {
+	config := DefaultServerConfig()
+	if filename != "" {
+		file, err := os.Open(filename)
+		if err != nil {
+			return config, ErrInvalidConfig{err.Error()}
+		}
+		defer file.Close()
+		decoder := json.NewDecoder(file)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&config); err != nil {
+			return config, ErrInvalidConfig{fmt.Sprintf("%v: %v", filename, err)}
+		}
+	}
+	for _, setting := range configSettings {
+		if value, found := lookupEnv(configEnv(setting.flag)); found {
+			if err := setting.set(&config, value); err != nil {
+				return config, ErrInvalidConfig{fmt.Sprintf("%v: %v", configEnv(setting.flag), err)}
+			}
+		}
+	}
+	return config, nil
+}
+
+// NewGoodiesConfiguredServer Creates the server and its storage described by the config
+// Persisted storage implements StoppableProvider and has to be stopped once the server is shut down
+func NewGoodiesConfiguredServer(config ServerConfig) (*http.Server, Provider, error) {
+	if err := config.Validate(); err != nil {
+		return nil, nil, err
+	}
+	// files are checked before storage is created, so a bad certificate doesn't leave it running
+	if _, err := loadTLS(config.TLS); err != nil {
+		return nil, nil, err
+	}
+	var storage Provider
+	if config.Persistence.Mode == PersistenceSnapshot {
+		keys, err := LoadEncryptionKeys(config.Persistence)
+		if err != nil {
+			return nil, nil, err
+		}
+		storage, err = OpenGoodiesPersistedStorage(time.Duration(config.DefaultTTL), config.Persistence.Path, time.Duration(config.Persistence.Interval), keys)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		storage = NewGoodiesStorage(time.Duration(config.DefaultTTL))
+	}
+	handler := newGoodiesHTTPHandler(storage)
+	if err := handler.setAuth(config.Auth); err != nil {
+		return nil, nil, err
+	}
+	if config.ReplicaOf != "" {
+		handler.replication.replicaOf(config.ReplicaOf)
+	}
+	handler.memory.configure(config.Memory)
+	server := &http.Server{Handler: handler}
+	if config.TLS.Enabled() {
+		// served by ServeTLS(listener, "", "") as certificates come from the configuration
+		var err error
+		if server.TLSConfig, err = handler.setTLS(config.TLS); err != nil {
+			return nil, nil, err
+		}
+	}
+	// event streams never finish on their own, so they would hold Shutdown until its deadline
+	server.RegisterOnShutdown(handler.closeStreams)
+	return server, storage, nil
+}
+
+// ServeConfiguredServer Starts serving the server returned from NewGoodiesConfiguredServer on all addresses of the
+// config, returns the error of the first failing listener
+// A stale unix socket (e.g. left by a killed server) is replaced, listeners are closed on shutdown
+func ServeConfiguredServer(server *http.Server, config ServerConfig) (<-chan error, error) {
+	var listeners []net.Listener
+	listen := func(network string, address string) error {
+		listener, err := net.Listen(network, address)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, listener)
+		return nil
+	}
+	for _, address := range config.tcpAddresses() {
+		if err := listen("tcp", address); err != nil {
+			return nil, err
+		}
+	}
+	if config.UnixSocket != "" {
+		if info, err := os.Stat(config.UnixSocket); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(config.UnixSocket)
+		}
+		if err := listen("unix", config.UnixSocket); err != nil {
+			return nil, err
+		}
+	}
+	served := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			if config.TLS.Enabled() && listener.Addr().Network() != "unix" {
+				served <- server.ServeTLS(listener, "", "")
+			} else {
+				served <- server.Serve(listener)
+			}
+		}(listener)
+	}
+	return served, nil
+}
+
+// ShutdownServer Stops the server returned from NewGoodiesConfiguredServer waiting for in-flight requests until ctx
+// is done, scheduled commands are not executed once it returns so the storage can take its final snapshot
+func ShutdownServer(ctx context.Context, server *http.Server) error {
+	err := server.Shutdown(ctx)
+	if handler, ok := server.Handler.(*goodiesHTTPServer); ok {
+		// shutdown hooks run in background, so the scheduler is stopped here too and waited for
+		handler.closeStreams()
+	}
+	return err
+}
+
+// ReconfigureServer Applies settings of the reloaded config which can change at runtime (defaultTTL,
+// persistence interval, encryption keys, auth, tls files which are reloaded even if unchanged, memory limit,
+// shutdownTimeout is read on shutdown)
+// and returns the changed ones requiring restart or failing to apply
+// server and storage are the ones returned from NewGoodiesConfiguredServer
+func ReconfigureServer(server *http.Server, storage Provider, current ServerConfig, reloaded ServerConfig) []string {
+	if expiring, ok := storage.(interface{ SetDefaultExpiry(time.Duration) }); ok && reloaded.DefaultTTL != current.DefaultTTL {
+		expiring.SetDefaultExpiry(time.Duration(reloaded.DefaultTTL))
+	}
+	if persisted, ok := storage.(interface{ SetPersistInterval(time.Duration) }); ok && reloaded.Persistence.Interval != current.Persistence.Interval {
+		persisted.SetPersistInterval(time.Duration(reloaded.Persistence.Interval))
+	}
+	var restart []string
+	// keys are loaded again even if unchanged, as the key file might have changed
+	if persisted, ok := storage.(interface{ SetEncryptionKeys(*EncryptionKeys) }); ok {
+		if keys, err := LoadEncryptionKeys(reloaded.Persistence); err != nil {
+			fmt.Printf("Encryption keys not reloaded %v\n", err)
+			restart = append(restart, "encryption")
+		} else {
+			persisted.SetEncryptionKeys(keys)
+		}
+	}
+	handler, ok := server.Handler.(*goodiesHTTPServer)
+	if !ok || handler.setAuth(reloaded.Auth) != nil {
+		restart = append(restart, "auth")
+	}
+	if reloaded.TLS.Enabled() != current.TLS.Enabled() || !ok {
+		restart = append(restart, "tls")
+	} else if reloaded.TLS.Enabled() {
+		if _, err := handler.setTLS(reloaded.TLS); err != nil {
+			fmt.Printf("TLS files not reloaded %v\n", err)
+			restart = append(restart, "tls")
+		}
+	}
+	if ok {
+		handler.memory.configure(reloaded.Memory)
+	} else if reloaded.Memory != current.Memory {
+		restart = append(restart, "memory")
+	}
+	if reloaded.Listen != current.Listen || reloaded.UnixSocket != current.UnixSocket {
+		restart = append(restart, "listen")
+	}
+	if reloaded.Persistence.Mode != current.Persistence.Mode || reloaded.Persistence.Path != current.Persistence.Path {
+		restart = append(restart, "persistence")
+	}
+	if reloaded.ReplicaOf != current.ReplicaOf {
+		restart = append(restart, "replicaOf")
+	}
+	if reloaded.Log != current.Log {
+		restart = append(restart, "log")
+	}
+	return restart
+}
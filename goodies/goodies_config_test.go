@@ -0,0 +1,177 @@
+package goodies
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadServerConfigPrecedence(testing *testing.T) {
+	file := filepath.Join(testing.TempDir(), "goodies.json")
+	os.WriteFile(file, []byte(`{"listen": ":7000", "defaultTTL": "5m", "persistence": {"mode": "none"}}`), 0600)
+	env := map[string]string{
+		"GOODIES_CONFIG":      file,
+		"GOODIES_DEFAULT_TTL": "10m",
+	}
+	lookupEnv := func(name string) (string, bool) {
+		value, found := env[name]
+		return value, found
+	}
+
+	options, err := LoadServerConfig([]string{"-listen", "127.0.0.1:7001"}, lookupEnv)
+	if err != nil {
+		testing.Fatalf("Unexpected error: %v", err)
+	}
+	config := options.Config
+	if options.ConfigFile != file || config.Listen != "127.0.0.1:7001" || time.Duration(config.DefaultTTL) != 10*time.Minute ||
+		config.Persistence.Mode != PersistenceNone || time.Duration(config.Persistence.Interval) != 30*time.Second {
+		testing.Errorf("Flags, environment, file and defaults are expected to be applied in order: %+v", options)
+	}
+
+	var printed bytes.Buffer
+	config.Print(&printed)
+	if !strings.Contains(printed.String(), `"defaultTTL": "10m0s"`) {
+		testing.Errorf("Durations are expected to be printed as strings: %v", printed.String())
+	}
+	printedFile := filepath.Join(testing.TempDir(), "printed.json")
+	os.WriteFile(printedFile, printed.Bytes(), 0600)
+	if reloaded, err := LoadServerConfig([]string{"-config", printedFile}, func(string) (string, bool) { return "", false }); err != nil || !reflect.DeepEqual(reloaded.Config, config) {
+		testing.Errorf("Printed config is expected to load back: %+v %v", reloaded.Config, err)
+	}
+
+	config.Auth.PeerToken = "peer-secret"
+	printed.Reset()
+	config.Print(&printed)
+	if strings.Contains(printed.String(), "peer-secret") || config.Auth.PeerToken != "peer-secret" {
+		testing.Errorf("Peer token is expected to be redacted in printed config only: %v", printed.String())
+	}
+}
+
+func TestServerConfigValidation(testing *testing.T) {
+	noEnv := func(string) (string, bool) { return "", false }
+	for _, args := range [][]string{
+		{"-listen", "9006"},
+		{"-listen", ":9006,9007"},
+		{"-listen", ""},
+		{"-persistence-mode", "log"},
+		{"-persistence-path", ""},
+		{"-default-ttl", "soon"},
+		{"-max-memory", "-1"},
+		{"-memory-policy", "lru"},
+		{"-unknown"},
+	} {
+		if _, err := LoadServerConfig(args, noEnv); err == nil {
+			testing.Errorf("Arguments %v are expected to be rejected", args)
+		} else if _, invalid := err.(ErrInvalidConfig); !invalid {
+			testing.Errorf("Expected ErrInvalidConfig for %v, got %v", args, err)
+		}
+	}
+
+	file := filepath.Join(testing.TempDir(), "goodies.json")
+	os.WriteFile(file, []byte(`{"listen": ":7000", "persistance": {}}`), 0600)
+	if _, err := LoadServerConfig([]string{"-config", file}, noEnv); err == nil {
+		testing.Error("Misspelled settings are expected to be rejected")
+	}
+}
+
+func TestConfiguredServerShutdown(testing *testing.T) {
+	config := DefaultServerConfig()
+	config.Listen = "127.0.0.1:0"
+	config.Persistence.Path = filepath.Join(testing.TempDir(), "goodies.dat")
+	config.Persistence.Interval = ConfigDuration(time.Hour)
+	server, storage, err := NewGoodiesConfiguredServer(config)
+	if err != nil {
+		testing.Fatalf("Unexpected error: %v", err)
+	}
+	listener, err := net.Listen("tcp", config.Listen)
+	if err != nil {
+		testing.Fatalf("Cannot listen: %v", err)
+	}
+	go server.Serve(listener)
+	address := "http://" + listener.Addr().String() + "/"
+
+	client := NewGoodiesClient(address)
+	client.Set("key", "value", ExpireNever)
+	watcher, err := client.(Watchable).Watch("")
+	if err != nil {
+		testing.Fatalf("Cannot watch: %v", err)
+	}
+	defer watcher.Close()
+
+	reloaded := config
+	reloaded.DefaultTTL = ConfigDuration(time.Hour)
+	reloaded.Persistence.Interval = ConfigDuration(time.Minute)
+	reloaded.Listen = "127.0.0.1:1"
+	if restart := ReconfigureServer(server, storage, config, reloaded); len(restart) != 1 || restart[0] != "listen" {
+		testing.Errorf("Only listen change is expected to require restart: %v", restart)
+	}
+	persisted := storage.(Persister)
+	if persisted.DefaultExpiry() != time.Hour || persisted.PersistInterval() != time.Minute {
+		testing.Errorf("Runtime settings are expected to be applied: %v %v", persisted.DefaultExpiry(), persisted.PersistInterval())
+	}
+
+	// open event streams don't hold shutdown until its deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		testing.Fatalf("Shutdown is expected to drain connections: %v", err)
+	}
+	persisted.Stop()
+
+	restored := NewGoodiesPersistedStorage(ExpireNever, config.Persistence.Path, time.Hour)
+	defer restored.Stop()
+	if val, err := restored.Get("key"); err != nil || val != "value" {
+		testing.Errorf("Stop is expected to flush the snapshot: %v %v", val, err)
+	}
+}
+
+func TestConfiguredServerListeners(testing *testing.T) {
+	config := DefaultServerConfig()
+	config.Listen = "127.0.0.1:0, 127.0.0.1:0"
+	config.UnixSocket = filepath.Join(testing.TempDir(), "goodies.sock")
+	config.Persistence.Mode = PersistenceNone
+	server, _, err := NewGoodiesConfiguredServer(config)
+	if err != nil {
+		testing.Fatalf("Unexpected error: %v", err)
+	}
+	served, err := ServeConfiguredServer(server, config)
+	if err != nil {
+		testing.Fatalf("Cannot serve: %v", err)
+	}
+	addresses := config.ListenAddresses()
+	if len(addresses) != 3 || addresses[1] != "127.0.0.1:0" || addresses[2] != "unix://"+config.UnixSocket {
+		testing.Errorf("Unexpected listen addresses: %v", addresses)
+	}
+
+	client := NewGoodiesClient("unix://" + config.UnixSocket)
+	watcher, err := client.(Watchable).Watch("")
+	if err != nil {
+		testing.Fatalf("Cannot watch over unix socket: %v", err)
+	}
+	defer watcher.Close()
+	if err := client.Set("key", "value", ExpireNever); err != nil {
+		testing.Errorf("Unexpected error over unix socket: %v", err)
+	}
+	expectKeyEvent(testing, watcher, KeySet, "key")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := ShutdownServer(ctx, server); err != nil {
+		testing.Fatalf("Unexpected error on shutdown: %v", err)
+	}
+	for range addresses {
+		if err := <-served; err != http.ErrServerClosed {
+			testing.Errorf("Listeners are expected to stop on shutdown, got %v", err)
+		}
+	}
+	if _, err := os.Stat(config.UnixSocket); !os.IsNotExist(err) {
+		testing.Errorf("Socket is expected to be removed on shutdown: %v", err)
+	}
+}
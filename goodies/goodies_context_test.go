@@ -0,0 +1,104 @@
+package goodies
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientContextDeadline(testing *testing.T) {
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// connection close is noticed only once the body was read, as the goodies server does
+		io.ReadAll(r.Body)
+		<-r.Context().Done()
+	}))
+	defer hung.Close()
+
+	client := NewGoodiesClient(hung.URL).(ContextProvider)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	_, err := client.GetContext(ctx, "key")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		testing.Errorf("Expected deadline error, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		testing.Errorf("Request was not aborted on deadline, took %v", elapsed)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := client.SetContext(cancelled, "key", "value", ExpireNever); !errors.Is(err, context.Canceled) {
+		testing.Errorf("Expected cancellation error, got %v", err)
+	}
+	if _, err := client.(PubSubProvider).PublishContext(cancelled, "channel", "message"); !errors.Is(err, context.Canceled) {
+		testing.Errorf("Expected cancellation error on publish, got %v", err)
+	}
+	if _, err := client.(ReplicationProvider).RoleContext(cancelled); !errors.Is(err, context.Canceled) {
+		testing.Errorf("Expected cancellation error on role, got %v", err)
+	}
+}
+
+// lateTransport Answers successfully once the request context is done
+type lateTransport struct{}
+
+func (lateTransport) Process(req CommandRequest, res *CommandResponse) error {
+	return lateTransport{}.ProcessContext(context.Background(), req, res)
+}
+
+func (lateTransport) ProcessContext(ctx context.Context, req CommandRequest, res *CommandResponse) error {
+	<-ctx.Done()
+	*res = createOkResult("value")
+	return nil
+}
+
+func TestClientContextLateResponse(testing *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	val, err := goodiesClient{lateTransport{}}.GetContext(ctx, "key")
+	if err != nil || val != "value" {
+		testing.Errorf("Response received is expected to be returned despite the deadline: %v %v", val, err)
+	}
+}
+
+func TestContextPropagation(testing *testing.T) {
+	server := newTestRESTServer()
+	defer server.Close()
+
+	client := NewGoodiesClient(server.URL).(ContextProvider)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.ListPushContext(ctx, "list", "value"); err != nil {
+		testing.Fatalf("Unexpected error on push with context: %v", err)
+	}
+	if val, err := client.ListGetByIndexContext(ctx, "list", 0); err != nil || val != "value" {
+		testing.Errorf("Unexpected result of get with context: %v %v", val, err)
+	}
+
+	sharded := NewShardedProvider(DefaultVirtualNodes)
+	sharded.AddNode("remote", client)
+	sharded.AddNode("local", NewGoodiesStorage(ExpireNever))
+	for _, key := range []string{"a", "b", "c", "d"} {
+		if err := sharded.SetContext(ctx, key, key, ExpireNever); err != nil {
+			testing.Fatalf("Unexpected error on sharded set with context: %v", err)
+		}
+	}
+	if keys, err := sharded.KeysContext(ctx); err != nil || len(keys) != 5 {
+		testing.Errorf("Unexpected sharded keys: %v %v", keys, err)
+	}
+
+	processor := NewGoodiesCommandsProcessor(NewGoodiesStorage(ExpireNever))
+	aborted, abort := context.WithCancel(context.Background())
+	abort()
+	res := processor.HandleCommand(CommandRequest{Name: "Set", Parameters: []string{"key", "value", "-1"}}.WithContext(aborted))
+	if res.Success {
+		testing.Error("Command of aborted request is not expected to be executed")
+	}
+	if res := processor.HandleCommand(CommandRequest{Name: "Get", Parameters: []string{"key"}}); res.Success {
+		testing.Errorf("Aborted command modified storage: %v", res.Result)
+	}
+}
@@ -0,0 +1,350 @@
+package goodies
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultDatabase Name of the database commands run against unless another one is selected
+	DefaultDatabase = "0"
+	// DatabaseHeader Request header selecting the database of commands, REST calls and watches
+	// Database field of CommandRequest takes precedence over it
+	DatabaseHeader = "X-Goodies-Database"
+)
+
+// DatabaseInfo Describes a logical database
+type DatabaseInfo struct {
+	Name          string
+	Keys          int
+	DefaultExpiry time.Duration
+}
+
+// DatabaseProvider Logical databases management interface implemented by the client returned from NewGoodiesClient
+// Databases are separate key spaces of a single server, persisted and replicated together
+type DatabaseProvider interface {
+	// Databases Returns all databases, the default one first
+	Databases() ([]DatabaseInfo, error)
+	// CreateDatabase Creates an empty database, ExpireDefault makes it use the default expiry of the server
+	CreateDatabase(name string, defaultExpiry time.Duration) error
+	// FlushDatabase Removes all items of the database
+	FlushDatabase(name string) error
+	// SwapDatabases Exchanges contents (and default expiries) of two databases, e.g. to publish a database
+	// filled in background
+	SwapDatabases(first string, second string) error
+}
+
+// databaseSet Databases created next to the default one, only the root storage (the default database) keeps them
+type databaseSet struct {
+	lock  sync.RWMutex
+	named map[string]*GoodiesStorage
+}
+
+// databaseSnapshot Persisted state of a database other than the default one
+type databaseSnapshot struct {
+	DefaultExpiry time.Duration
+	Items         map[string]goodiesItem
+	Locks         map[string]int64
+}
+
+// databases is implemented by storages keeping logical databases
+type databases interface {
+	Database(name string) (*GoodiesStorage, error)
+	CreateDatabase(name string, defaultExpiry time.Duration) error
+	FlushDatabase(name string) error
+	SwapDatabases(first string, second string) error
+	ListDatabases() []DatabaseInfo
+	namedDatabases() map[string]*GoodiesStorage
+}
+
+// Database Returns the database by name, the storage itself is the default database
+func (g *GoodiesStorage) Database(name string) (*GoodiesStorage, error) {
+	if name == "" || name == DefaultDatabase {
+		return g, nil
+	}
+	if g.databases == nil {
+		return nil, ErrNotFound{fmt.Sprintf("database %v", name)}
+	}
+	g.databases.lock.RLock()
+	defer g.databases.lock.RUnlock()
+	database, found := g.databases.named[name]
+	if !found {
+		return nil, ErrNotFound{fmt.Sprintf("database %v", name)}
+	}
+	return database, nil
+}
+
+func (g *GoodiesStorage) CreateDatabase(name string, defaultExpiry time.Duration) error {
+	if name == "" || name == DefaultDatabase {
+		return ErrCommandArgumentsMismatch{fmt.Sprintf("Database %q already exists", name)}
+	}
+	if g.databases == nil {
+		return ErrInternalError{"Databases can only be created in the default database"}
+	}
+	if defaultExpiry == ExpireDefault {
+		defaultExpiry = g.DefaultExpiry()
+	}
+	g.databases.lock.Lock()
+	defer g.databases.lock.Unlock()
+	if _, exists := g.databases.named[name]; exists {
+		return ErrCommandArgumentsMismatch{fmt.Sprintf("Database %q already exists", name)}
+	}
+	g.databases.named[name] = newGoodiesDatabase(defaultExpiry)
+	return nil
+}
+
+// newGoodiesDatabase Creates a database other than the default one
+func newGoodiesDatabase(defaultExpiry time.Duration) *GoodiesStorage {
+	database := NewGoodiesStorage(defaultExpiry)
+	database.databases = nil
+	return database
+}
+
+func (g *GoodiesStorage) FlushDatabase(name string) error {
+	database, err := g.Database(name)
+	if err != nil {
+		return err
+	}
+	return database.FlushAll()
+}
+
+func (g *GoodiesStorage) SwapDatabases(first string, second string) error {
+	a, err := g.Database(first)
+	if err != nil {
+		return err
+	}
+	b, err := g.Database(second)
+	if err != nil {
+		return err
+	}
+	if a == b {
+		return nil
+	}
+	// the default database is always locked first, the others by name, so concurrent swaps cannot deadlock
+	if b == g || (a != g && second < first) {
+		a, b = b, a
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	a.storage, b.storage = b.storage, a.storage
+	a.defaultExpiry, b.defaultExpiry = b.defaultExpiry, a.defaultExpiry
+	// every key of both databases changed from the point of view of their watchers
+	for key := range a.storage {
+		a.emit(KeyUpdated, key)
+		b.emit(KeyUpdated, key)
+	}
+	for key := range b.storage {
+		a.emit(KeyUpdated, key)
+		b.emit(KeyUpdated, key)
+	}
+	return nil
+}
+
+// ListDatabases Returns all databases, the default one first and the others by name
+func (g *GoodiesStorage) ListDatabases() []DatabaseInfo {
+	keys, _ := g.DbSize()
+	infos := []DatabaseInfo{{Name: DefaultDatabase, Keys: keys, DefaultExpiry: g.DefaultExpiry()}}
+	if g.databases == nil {
+		return infos
+	}
+	g.databases.lock.RLock()
+	defer g.databases.lock.RUnlock()
+	for name, database := range g.databases.named {
+		keys, _ := database.DbSize()
+		infos = append(infos, DatabaseInfo{Name: name, Keys: keys, DefaultExpiry: database.DefaultExpiry()})
+	}
+	sort.Slice(infos[1:], func(i, j int) bool { return infos[i+1].Name < infos[j+1].Name })
+	return infos
+}
+
+// namedDatabases Returns databases other than the default one by name
+func (g *GoodiesStorage) namedDatabases() map[string]*GoodiesStorage {
+	named := make(map[string]*GoodiesStorage)
+	if g.databases == nil {
+		return named
+	}
+	g.databases.lock.RLock()
+	defer g.databases.lock.RUnlock()
+	for name, database := range g.databases.named {
+		named[name] = database
+	}
+	return named
+}
+
+// writeDatabases Encodes databases other than the default one after its items, while the default one is locked
+func (g *GoodiesStorage) writeDatabases(encoder *gob.Encoder) error {
+	snapshots := make(map[string]databaseSnapshot)
+	if g.databases != nil {
+		g.databases.lock.RLock()
+		defer g.databases.lock.RUnlock()
+		names := make([]string, 0, len(g.databases.named))
+		for name := range g.databases.named {
+			names = append(names, name)
+		}
+		// locked in the order used by SwapDatabases
+		sort.Strings(names)
+		for _, name := range names {
+			database := g.databases.named[name]
+			database.lock.RLock()
+			defer database.lock.RUnlock()
+			snapshots[name] = databaseSnapshot{DefaultExpiry: database.defaultExpiry, Items: database.storage, Locks: database.state.Locks}
+		}
+	}
+	return encoder.Encode(snapshots)
+}
+
+// load Replaces databases with the loaded ones, existing databases keep their watchers
+func (set *databaseSet) load(loaded map[string]*GoodiesStorage) {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	for name, database := range set.named {
+		if _, kept := loaded[name]; !kept {
+			database.lock.Lock()
+			database.internalReplaceItems(make(map[string]goodiesItem))
+			database.lock.Unlock()
+			delete(set.named, name)
+		}
+	}
+	for name, database := range loaded {
+		existing, found := set.named[name]
+		if !found {
+			set.named[name] = database
+			continue
+		}
+		existing.lock.Lock()
+		existing.defaultExpiry = database.defaultExpiry
+		existing.state.Locks = database.state.Locks
+		existing.internalReplaceItems(database.storage)
+		existing.lock.Unlock()
+	}
+}
+
+// readDatabases Decodes databases written by writeDatabases, snapshots written before databases existed have none
+func readDatabases(decoder *gob.Decoder) (map[string]*GoodiesStorage, error) {
+	var snapshots map[string]databaseSnapshot
+	if err := decoder.Decode(&snapshots); err != nil && err != io.EOF {
+		return nil, err
+	}
+	named := make(map[string]*GoodiesStorage, len(snapshots))
+	for name, snapshot := range snapshots {
+		database := newGoodiesDatabase(snapshot.DefaultExpiry)
+		if snapshot.Items != nil {
+			database.storage = snapshot.Items
+		}
+		database.state.Locks = snapshot.Locks
+		named[name] = database
+	}
+	return named, nil
+}
+
+func databaseListCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 0 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"DatabaseList command is expected to have no arguments"})
+	}
+	set, ok := storage.(databases)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support databases"})
+	}
+	data, err := json.Marshal(set.ListDatabases())
+	if err != nil {
+		return createErrorResult(ErrTransformation{err.Error()})
+	}
+	return createOkResult(string(data))
+}
+
+func databaseCreateCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 2 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"DatabaseCreate command is expected to have 2 arguments (name, defaultExpiry(TTL))"})
+	}
+	set, ok := storage.(databases)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support databases"})
+	}
+	ttl, err := parseTTL(command.Parameters[1])
+	if err != nil {
+		return createErrorResult(err)
+	}
+	if err := set.CreateDatabase(command.Parameters[0], ttl); err != nil {
+		return createErrorResult(err)
+	}
+	return createOkResult("")
+}
+
+func databaseFlushCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 1 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"DatabaseFlush command is expected to have 1 argument (name)"})
+	}
+	set, ok := storage.(databases)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support databases"})
+	}
+	if err := set.FlushDatabase(command.Parameters[0]); err != nil {
+		return createErrorResult(err)
+	}
+	return createOkResult("")
+}
+
+func databaseSwapCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 2 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"DatabaseSwap command is expected to have 2 arguments (first, second)"})
+	}
+	set, ok := storage.(databases)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support databases"})
+	}
+	if err := set.SwapDatabases(command.Parameters[0], command.Parameters[1]); err != nil {
+		return createErrorResult(err)
+	}
+	return createOkResult("")
+}
+
+func (c goodiesClient) Databases() ([]DatabaseInfo, error) {
+	res := internalProcess(CommandRequest{Name: "DatabaseList"}, c)
+	if !res.Success {
+		return nil, res.Err
+	}
+	var infos []DatabaseInfo
+	if err := json.Unmarshal([]byte(res.Result), &infos); err != nil {
+		return nil, ErrTransformation{err.Error()}
+	}
+	return infos, nil
+}
+
+func (c goodiesClient) CreateDatabase(name string, defaultExpiry time.Duration) error {
+	res := internalProcess(CommandRequest{Name: "DatabaseCreate", Parameters: []string{name, ttlAsString(defaultExpiry)}}, c)
+	if !res.Success {
+		return res.Err
+	}
+	return nil
+}
+
+func (c goodiesClient) FlushDatabase(name string) error {
+	res := internalProcess(CommandRequest{Name: "DatabaseFlush", Parameters: []string{name}}, c)
+	if !res.Success {
+		return res.Err
+	}
+	return nil
+}
+
+func (c goodiesClient) SwapDatabases(first string, second string) error {
+	res := internalProcess(CommandRequest{Name: "DatabaseSwap", Parameters: []string{first, second}}, c)
+	if !res.Success {
+		return res.Err
+	}
+	return nil
+}
+
+// WithDatabase Runs commands and watches of the client against the named database
+// Near cache (WithNearCache) is only kept for the default database
+func WithDatabase(name string) ClientOption {
+	return func(options *clientOptions) {
+		options.database = name
+	}
+}
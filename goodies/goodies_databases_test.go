@@ -0,0 +1,116 @@
+package goodies
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDatabasesSelection(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	server := httptest.NewServer(newGoodiesHTTPHandler(storage))
+	defer server.Close()
+	admin := NewGoodiesClient(server.URL).(DatabaseProvider)
+	if err := admin.CreateDatabase("reports", time.Hour); err != nil {
+		testing.Fatalf("Unexpected error on create: %v", err)
+	}
+	if err := admin.CreateDatabase("reports", time.Hour); err == nil {
+		testing.Error("Existing database is not expected to be created again")
+	}
+
+	main := NewGoodiesClient(server.URL)
+	reports := NewGoodiesClient(server.URL, WithDatabase("reports"))
+	main.Set("key", "main", ExpireNever)
+	reports.Set("key", "reports", ExpireNever)
+	if val, _ := main.Get("key"); val != "main" {
+		testing.Errorf("Default database is expected to keep its value, got %v", val)
+	}
+	if val, _ := reports.Get("key"); val != "reports" {
+		testing.Errorf("Selected database is expected to keep its value, got %v", val)
+	}
+	if status, body := doREST(testing, "GET", server.URL+"/keys/key", "", map[string]string{DatabaseHeader: "reports"}); status != 200 || body != "reports" {
+		testing.Errorf("Database is expected to be selected by header: %v %v", status, body)
+	}
+	if _, err := NewGoodiesClient(server.URL, WithDatabase("missing")).Get("key"); err == nil {
+		testing.Error("Missing database is expected to be reported")
+	} else if _, notFound := err.(ErrNotFound); !notFound {
+		testing.Errorf("Expected ErrNotFound for missing database, got %v", err)
+	}
+
+	if err := admin.SwapDatabases(DefaultDatabase, "reports"); err != nil {
+		testing.Errorf("Unexpected error on swap: %v", err)
+	}
+	if val, _ := main.Get("key"); val != "reports" {
+		testing.Errorf("Swapped content is expected in the default database, got %v", val)
+	}
+	infos, err := admin.Databases()
+	if err != nil || len(infos) != 2 || infos[0].Name != DefaultDatabase || infos[0].DefaultExpiry != time.Hour || infos[1].Name != "reports" {
+		testing.Errorf("Unexpected databases: %+v %v", infos, err)
+	}
+	if err := admin.FlushDatabase("reports"); err != nil {
+		testing.Errorf("Unexpected error on flush: %v", err)
+	}
+	if _, err := reports.Get("key"); err == nil {
+		testing.Error("Flushed database is expected to be empty")
+	}
+	if val, _ := main.Get("key"); val != "reports" {
+		testing.Errorf("Flush is not expected to touch other databases, got %v", val)
+	}
+	reports.Set("key", "reports", ExpireNever)
+	if err := reports.(AdminProvider).FlushAll(); err != nil {
+		testing.Errorf("Unexpected error on flush all: %v", err)
+	}
+	_, mainErr := main.Get("key")
+	_, reportsErr := reports.Get("key")
+	if mainErr == nil || reportsErr == nil {
+		testing.Error("FlushAll is expected to empty every database whichever is selected")
+	}
+}
+
+func TestDatabasesSnapshot(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	storage.CreateDatabase("sessions", time.Minute)
+	sessions, _ := storage.Database("sessions")
+	sessions.Set("token", "secret", ExpireNever)
+	storage.Set("key", "value", ExpireNever)
+
+	var snapshot bytes.Buffer
+	storage.writeSnapshot(&snapshot)
+	restored := NewGoodiesStorage(ExpireNever)
+	if err := restored.loadSnapshot(&snapshot); err != nil {
+		testing.Fatalf("Unexpected error on snapshot load: %v", err)
+	}
+	restoredSessions, err := restored.Database("sessions")
+	if err != nil || restoredSessions.DefaultExpiry() != time.Minute {
+		testing.Fatalf("Database is expected to be restored with its settings: %v", err)
+	}
+	if val, _ := restoredSessions.Get("token"); val != "secret" {
+		testing.Errorf("Database items are expected to be restored, got %v", val)
+	}
+
+	// snapshots written before databases existed hold items only
+	var legacy bytes.Buffer
+	encodeSnapshot(&legacy, map[string]goodiesItem{"old": newItemWithExpiry("value", 0)})
+	if err := restored.loadSnapshot(&legacy); err != nil {
+		testing.Fatalf("Legacy snapshot is expected to load: %v", err)
+	}
+	if val, _ := restored.Get("old"); val != "value" {
+		testing.Errorf("Legacy items are expected to be loaded, got %v", val)
+	}
+	if infos := restored.ListDatabases(); len(infos) != 1 {
+		testing.Errorf("Legacy snapshot is not expected to have databases: %+v", infos)
+	}
+}
+
+func TestDatabasesCleanup(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	storage.CreateDatabase("sessions", ExpireNever)
+	sessions, _ := storage.Database("sessions")
+	sessions.Set("session", "value", time.Millisecond)
+	watcher, _ := sessions.Watch("")
+	defer watcher.Close()
+	<-time.After(5 * time.Millisecond)
+	storage.cleanupOutdated()
+	expectKeyEvent(testing, watcher, KeyExpired, "session")
+}
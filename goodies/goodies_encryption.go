@@ -0,0 +1,141 @@
+package goodies
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// encryptedSnapshotMagic Starts encrypted snapshots, followed by the key id length, key id, nonce and sealed snapshot
+	encryptedSnapshotMagic = "GOODIES-AESGCM1"
+	// EncryptionKeySize Size of encryption keys (AES-256)
+	EncryptionKeySize = 32
+)
+
+// EncryptionKeys Keys of snapshot encryption, snapshots are encrypted by the current key and decrypted by the key
+// they were encrypted with, so keys are rotated by adding a new current key and keeping the old ones until
+// the next snapshot is saved
+type EncryptionKeys struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+// ParseEncryptionKeys Parses keys written as id:base64 entries separated by new lines or commas,
+// the first entry is the current key (e.g. "2024-06:<base64 of 32 random bytes>,2024-01:<...>")
+func ParseEncryptionKeys(text string) (*EncryptionKeys, error) {
+	keys := &EncryptionKeys{Keys: make(map[string][]byte)}
+	for _, entry := range strings.FieldsFunc(text, func(r rune) bool { return r == '\n' || r == '\r' || r == ',' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		id, encoded, found := strings.Cut(entry, ":")
+		if !found || id == "" || len(id) > 255 {
+			return nil, ErrInvalidConfig{"encryption key is expected to be written as id:base64"}
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil || len(key) != EncryptionKeySize {
+			return nil, ErrInvalidConfig{fmt.Sprintf("encryption key %v is expected to be %v bytes encoded as base64", id, EncryptionKeySize)}
+		}
+		if _, duplicate := keys.Keys[id]; duplicate {
+			return nil, ErrInvalidConfig{fmt.Sprintf("encryption key %v is listed twice", id)}
+		}
+		if keys.Current == "" {
+			keys.Current = id
+		}
+		keys.Keys[id] = key
+	}
+	if keys.Current == "" {
+		return nil, ErrInvalidConfig{"no encryption key found"}
+	}
+	return keys, nil
+}
+
+// LoadEncryptionKeys Returns keys of the persistence config, nil if snapshots are not encrypted
+func LoadEncryptionKeys(config PersistenceConfig) (*EncryptionKeys, error) {
+	switch {
+	case config.EncryptionKeyFile != "":
+		data, err := os.ReadFile(config.EncryptionKeyFile)
+		if err != nil {
+			return nil, ErrInvalidConfig{fmt.Sprintf("encryption key file: %v", err)}
+		}
+		return ParseEncryptionKeys(string(data))
+	case config.EncryptionKeys != "":
+		return ParseEncryptionKeys(config.EncryptionKeys)
+	}
+	return nil, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealSnapshot Encrypts the snapshot by the current key
+func (k *EncryptionKeys) sealSnapshot(snapshot []byte) ([]byte, error) {
+	gcm, err := newGCM(k.Keys[k.Current])
+	if err != nil {
+		return nil, err
+	}
+	header := encryptedSnapshotHeader(k.Current)
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := append(append(header, nonce...), gcm.Seal(nil, nonce, snapshot, header)...)
+	return sealed, nil
+}
+
+// encryptedSnapshotHeader Returns the header of the snapshot, it is authenticated together with the content
+func encryptedSnapshotHeader(id string) []byte {
+	header := append([]byte(encryptedSnapshotMagic), byte(len(id)))
+	return append(header, id...)
+}
+
+// openSnapshot Returns the plain snapshot of data read from a snapshot file, plain snapshots are returned as they are
+// and get encrypted by the next save
+func openSnapshot(data []byte, keys *EncryptionKeys) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(encryptedSnapshotMagic)) {
+		return data, nil
+	}
+	rest := data[len(encryptedSnapshotMagic):]
+	if len(rest) == 0 || len(rest) < 1+int(rest[0]) {
+		return nil, ErrEncryption{"encrypted snapshot is truncated"}
+	}
+	id := string(rest[1 : 1+int(rest[0])])
+	if keys == nil {
+		return nil, ErrEncryption{fmt.Sprintf("snapshot is encrypted with key %v but no encryption key is configured", id)}
+	}
+	key, found := keys.Keys[id]
+	if !found {
+		return nil, ErrEncryption{fmt.Sprintf("snapshot is encrypted with key %v which is not configured", id)}
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, ErrEncryption{err.Error()}
+	}
+	header := encryptedSnapshotHeader(id)
+	sealed := data[len(header):]
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrEncryption{"encrypted snapshot is truncated"}
+	}
+	snapshot, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], header)
+	if err != nil {
+		return nil, ErrEncryption{fmt.Sprintf("snapshot cannot be decrypted with key %v, the key is wrong or the file is corrupted", id)}
+	}
+	return snapshot, nil
+}
+
+// SetEncryptionKeys Changes keys the next snapshots are encrypted with, nil saves them plain
+func (p Persister) SetEncryptionKeys(keys *EncryptionKeys) {
+	p.keys.Store(keys)
+}
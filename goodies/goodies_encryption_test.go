@@ -0,0 +1,130 @@
+package goodies
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestEncryptionKey(testing *testing.T) string {
+	key := make([]byte, EncryptionKeySize)
+	if _, err := rand.Read(key); err != nil {
+		testing.Fatalf("Cannot generate key: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func openEncrypted(testing *testing.T, filename string, keys string) (StoppableProvider, error) {
+	var parsed *EncryptionKeys
+	if keys != "" {
+		var err error
+		if parsed, err = ParseEncryptionKeys(keys); err != nil {
+			testing.Fatalf("Cannot parse keys: %v", err)
+		}
+	}
+	return OpenGoodiesPersistedStorage(ExpireNever, filename, time.Hour, parsed)
+}
+
+func TestEncryptedSnapshotKeys(testing *testing.T) {
+	filename := filepath.Join(testing.TempDir(), "goodies.dat")
+	first := "first:" + newTestEncryptionKey(testing)
+
+	storage, err := openEncrypted(testing, filename, first)
+	if err != nil {
+		testing.Fatalf("Unexpected error on open: %v", err)
+	}
+	storage.Set("session", "token-value", ExpireNever)
+	storage.Stop()
+	data, _ := os.ReadFile(filename)
+	if !bytes.HasPrefix(data, []byte(encryptedSnapshotMagic)) || bytes.Contains(data, []byte("token-value")) {
+		testing.Fatal("Snapshot is expected to be encrypted")
+	}
+
+	for _, keys := range []string{"", "first:" + newTestEncryptionKey(testing), "other:" + newTestEncryptionKey(testing)} {
+		if _, err := openEncrypted(testing, filename, keys); err == nil {
+			testing.Errorf("Snapshot is not expected to be opened with keys %q", keys)
+		} else if _, encryption := err.(ErrEncryption); !encryption {
+			testing.Errorf("Expected ErrEncryption with keys %q, got %v", keys, err)
+		}
+	}
+	// storage without keys starts empty and keeps the encrypted snapshot
+	plain := NewGoodiesPersistedStorage(ExpireNever, filename, time.Hour)
+	if _, err := plain.Get("session"); err == nil {
+		testing.Error("Storage without keys is not expected to read the encrypted snapshot")
+	}
+	if err := plain.(Persister).SaveSnapshot(); err == nil {
+		testing.Error("Snapshot which was not loaded is not expected to be overwritten")
+	}
+	plain.Stop()
+
+	// rotation: the new key is current, the old one still reads the snapshot
+	second := "second:" + newTestEncryptionKey(testing)
+	storage, err = openEncrypted(testing, filename, second+"\n"+first)
+	if err != nil {
+		testing.Fatalf("Old key is expected to decrypt the snapshot: %v", err)
+	}
+	if val, err := storage.Get("session"); err != nil || val != "token-value" {
+		testing.Errorf("Unexpected value after rotation: %v %v", val, err)
+	}
+	storage.Stop()
+	storage, err = openEncrypted(testing, filename, second)
+	if err != nil {
+		testing.Fatalf("Snapshot is expected to be encrypted by the new key on save: %v", err)
+	}
+	storage.Stop()
+}
+
+func TestEncryptedSnapshotFromPlain(testing *testing.T) {
+	filename := filepath.Join(testing.TempDir(), "goodies.dat")
+	plain := NewGoodiesPersistedStorage(ExpireNever, filename, time.Hour)
+	plain.Set("key", "value", ExpireNever)
+	plain.Stop()
+
+	keys := "k:" + newTestEncryptionKey(testing)
+	storage, err := openEncrypted(testing, filename, keys)
+	if err != nil {
+		testing.Fatalf("Plain snapshot is expected to be loaded: %v", err)
+	}
+	if val, err := storage.Get("key"); err != nil || val != "value" {
+		testing.Errorf("Unexpected value from plain snapshot: %v %v", val, err)
+	}
+	storage.Stop()
+	if data, _ := os.ReadFile(filename); !bytes.HasPrefix(data, []byte(encryptedSnapshotMagic)) {
+		testing.Error("Plain snapshot is expected to be encrypted by the next save")
+	}
+
+	// keys removed at runtime make the next snapshot plain again
+	storage, _ = openEncrypted(testing, filename, keys)
+	storage.(Persister).SetEncryptionKeys(nil)
+	storage.Stop()
+	if _, err := openEncrypted(testing, filename, ""); err != nil {
+		testing.Errorf("Snapshot saved without keys is expected to be plain: %v", err)
+	}
+}
+
+func TestParseEncryptionKeys(testing *testing.T) {
+	key := newTestEncryptionKey(testing)
+	keys, err := ParseEncryptionKeys(fmt.Sprintf("# rotated monthly\nnew:%v\nold:%v\n", key, key))
+	if err != nil || keys.Current != "new" || len(keys.Keys) != 2 {
+		testing.Errorf("Unexpected keys: %+v %v", keys, err)
+	}
+	for _, invalid := range []string{"", "nokey", "short:" + base64.StdEncoding.EncodeToString([]byte("short")), "a:" + key + ",a:" + key} {
+		if _, err := ParseEncryptionKeys(invalid); err == nil {
+			testing.Errorf("Keys %q are expected to be invalid", invalid)
+		}
+	}
+
+	config := DefaultServerConfig()
+	config.Persistence.EncryptionKeys = "k:" + key
+	config.Persistence.Path = filepath.Join(testing.TempDir(), "goodies.dat")
+	os.WriteFile(config.Persistence.Path, []byte(encryptedSnapshotMagic+"\x01x"+strings.Repeat("0", 40)), 0600)
+	if _, _, err := NewGoodiesConfiguredServer(config); err == nil {
+		testing.Error("Server is not expected to start from a snapshot it cannot decrypt")
+	}
+}
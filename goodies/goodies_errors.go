@@ -65,6 +65,116 @@ func (e ErrTransformation) Error() string {
 	return fmt.Sprintf("ErrTransformation: %v", e.str)
 }
 
+// ErrReadOnly Indicates a write command was sent to a read-only follower
+type ErrReadOnly struct {
+	str string
+}
+
+func (e ErrReadOnly) Error() string {
+	return fmt.Sprintf("ErrReadOnly: %v", e.str)
+}
+
+// ErrMoved Indicates the key slot is served by another cluster node, clients should update their slot map
+type ErrMoved struct {
+	Slot    int
+	Address string
+}
+
+func (e ErrMoved) Error() string {
+	return fmt.Sprintf("ErrMoved: Key slot is served by another node: %v %v", e.Slot, e.Address)
+}
+
+// ErrAsk Indicates the key slot is being migrated and the key has to be requested once from another node
+type ErrAsk struct {
+	Slot    int
+	Address string
+}
+
+func (e ErrAsk) Error() string {
+	return fmt.Sprintf("ErrAsk: Key slot is being migrated: %v %v", e.Slot, e.Address)
+}
+
+// ErrCircuitOpen Indicates the client stopped sending commands to a failing server for a while
+type ErrCircuitOpen struct {
+	str string
+}
+
+func (e ErrCircuitOpen) Error() string {
+	return fmt.Sprintf("ErrCircuitOpen: %v", e.str)
+}
+
+// ErrLocked Indicates the lock is held by another owner
+type ErrLocked struct {
+	str string
+}
+
+func (e ErrLocked) Error() string {
+	return fmt.Sprintf("ErrLocked: %v", e.str)
+}
+
+// ErrLockNotHeld Indicates the lease expired or the lock was acquired by another owner
+type ErrLockNotHeld struct {
+	str string
+}
+
+func (e ErrLockNotHeld) Error() string {
+	return fmt.Sprintf("ErrLockNotHeld: %v", e.str)
+}
+
+// ErrInvalidConfig Indicates invalid server configuration
+type ErrInvalidConfig struct {
+	str string
+}
+
+func (e ErrInvalidConfig) Error() string {
+	return fmt.Sprintf("ErrInvalidConfig: %v", e.str)
+}
+
+// ErrQuotaExceeded Indicates the command would exceed the quota of the namespace of its key
+type ErrQuotaExceeded struct {
+	str string
+}
+
+func (e ErrQuotaExceeded) Error() string {
+	return fmt.Sprintf("ErrQuotaExceeded: %v", e.str)
+}
+
+// ErrOutOfMemory Indicates the command would exceed the memory limit of the server and nothing can be evicted
+type ErrOutOfMemory struct {
+	str string
+}
+
+func (e ErrOutOfMemory) Error() string {
+	return fmt.Sprintf("ErrOutOfMemory: %v", e.str)
+}
+
+// ErrUnauthorized Indicates missing or invalid credentials
+type ErrUnauthorized struct {
+	str string
+}
+
+func (e ErrUnauthorized) Error() string {
+	return fmt.Sprintf("ErrUnauthorized: %v", e.str)
+}
+
+// ErrForbidden Indicates the authenticated identity is not allowed to run the command or access the key
+type ErrForbidden struct {
+	str string
+}
+
+func (e ErrForbidden) Error() string {
+	return fmt.Sprintf("ErrForbidden: %v", e.str)
+}
+
+// ErrEncryption Indicates an encrypted snapshot cannot be decrypted, e.g. by a wrong or missing key
+type ErrEncryption struct {
+	str string
+}
+
+func (e ErrEncryption) Error() string {
+	return fmt.Sprintf("ErrEncryption: %v", e.str)
+}
+
 func ErrorFromString(str string) error {
 	switch {
 	case strings.HasPrefix(str, "ErrDictKeyNotFound"):
@@ -83,6 +193,32 @@ func ErrorFromString(str string) error {
 		return ErrUnknownCommand{getParameter(str)}
 	case strings.HasPrefix(str, "ErrTransformation"):
 		return ErrTransformation{getParameter(str)}
+	case strings.HasPrefix(str, "ErrReadOnly"):
+		return ErrReadOnly{getParameter(str)}
+	case strings.HasPrefix(str, "ErrLockNotHeld"):
+		return ErrLockNotHeld{getParameter(str)}
+	case strings.HasPrefix(str, "ErrLocked"):
+		return ErrLocked{getParameter(str)}
+	case strings.HasPrefix(str, "ErrInvalidConfig"):
+		return ErrInvalidConfig{getParameter(str)}
+	case strings.HasPrefix(str, "ErrQuotaExceeded"):
+		return ErrQuotaExceeded{getParameter(str)}
+	case strings.HasPrefix(str, "ErrOutOfMemory"):
+		return ErrOutOfMemory{getParameter(str)}
+	case strings.HasPrefix(str, "ErrUnauthorized"):
+		return ErrUnauthorized{getParameter(str)}
+	case strings.HasPrefix(str, "ErrForbidden"):
+		return ErrForbidden{getParameter(str)}
+	case strings.HasPrefix(str, "ErrEncryption"):
+		return ErrEncryption{getParameter(str)}
+	case strings.HasPrefix(str, "ErrCircuitOpen"):
+		return ErrCircuitOpen{getParameter(str)}
+	case strings.HasPrefix(str, "ErrMoved"):
+		slot, address := getRedirect(str)
+		return ErrMoved{slot, address}
+	case strings.HasPrefix(str, "ErrAsk"):
+		slot, address := getRedirect(str)
+		return ErrAsk{slot, address}
 	default:
 		return ErrInternalError{fmt.Sprintf("UNKNOWN ERROR RECEIVED: %v", str)}
 	}
@@ -91,3 +227,11 @@ func ErrorFromString(str string) error {
 func getParameter(str string) string {
 	return str[strings.LastIndex(str, ": ")+2:]
 }
+
+// getRedirect Parses "<slot> <address>" parameter of redirect errors
+func getRedirect(str string) (int, string) {
+	var slot int
+	var address string
+	fmt.Sscan(getParameter(str), &slot, &address)
+	return slot, address
+}
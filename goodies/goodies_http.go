@@ -2,60 +2,173 @@ package goodies
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 )
 
+// unixSocketScheme Prefix of addresses of servers listening on a unix socket, followed by the socket path
+const unixSocketScheme = "unix://"
+
 type GoodiesHttpCommandClient struct {
 	address    string
 	serializer RequestResponseSerialiser
 	client     http.Client
+	// socket Path of the unix socket connections are dialled to, empty for network addresses
+	socket string
+	// database Database selected for commands not selecting one themselves and for streams
+	database    string
+	credentials Credentials
 }
 
-func NewGoodiesClient(address string) Provider {
-	return goodiesClient{NewGoodiesHttpCommandClient(address)}
+// NewGoodiesClient Creates a client of the goodies server, by default commands are neither retried nor
+// circuit broken nor cached (see WithRetryPolicy, WithCircuitBreaker and WithNearCache)
+func NewGoodiesClient(address string, options ...ClientOption) Provider {
+	return goodiesClient{withClientOptions(NewGoodiesHttpCommandClient(address), options)}
 }
 
-func NewGoodiesHttpCommandClient(address string) GoodiesHttpCommandClient {
-	client := http.Client{}
+// NewGoodiesHttpCommandClient Creates a transport of commands to the server address, https addresses are connected
+// with the TLS configuration if one is given, unix://path addresses through the unix socket
+func NewGoodiesHttpCommandClient(address string, tlsConfig ...*tls.Config) GoodiesHttpCommandClient {
+	var config *tls.Config
+	if len(tlsConfig) > 0 {
+		config = tlsConfig[0]
+	}
+	var socket string
+	if strings.HasPrefix(address, unixSocketScheme) {
+		// requests name a placeholder host, connections go to the socket regardless of it
+		socket, address = strings.TrimPrefix(address, unixSocketScheme), "http://unix"
+	}
+	client := httpClient(config, socket)
 	ser := jsonRequestResponseSerialiser{}
-	return GoodiesHttpCommandClient{address, ser, client}
+	return GoodiesHttpCommandClient{address: address, serializer: ser, client: client, socket: socket}
 }
 
 func NewGoodiesHttpServer(port string, defTtl time.Duration, storage string, persistInterval time.Duration) *http.Server {
 	g := NewGoodiesPersistedStorage(defTtl, storage, persistInterval)
-	commandProcessor := NewGoodiesCommandsProcessor(g)
-	serialiser := jsonRequestResponseSerialiser{}
-	handler := goodiesHTTPServer{commandProcessor, serialiser}
+	handler := newGoodiesHTTPHandler(g)
 	server := &http.Server{
 		Addr:    ":" + port,
-		Handler: &handler}
+		Handler: handler}
+	server.RegisterOnShutdown(handler.closeStreams)
 	return server
 }
 
 type goodiesHTTPServer struct {
 	commandProcessor CommandProcesser
 	serializer       RequestResponseSerialiser
+	pubsub           *PubSub
+	storage          Provider
+	replication      *replication
+	tracking         *tracking
+	memory           *memoryLimit
+	auth             *authenticator
+	// closing is closed once the server shuts down to end long-lived event streams, closeStreams closes it
+	// and stops executing scheduled commands
+	closing      chan struct{}
+	closeStreams func()
+}
+
+func newGoodiesHTTPHandler(storage Provider) *goodiesHTTPServer {
+	pubsub := NewPubSub()
+	processor := newGoodiesCommandProcessor(storage, pubsub)
+	// the server runs commands scheduled before a restart, closeStreams stops the scheduler
+	processor.startScheduler()
+	closing := make(chan struct{})
+	var closeOnce sync.Once
+	return &goodiesHTTPServer{
+		commandProcessor: processor,
+		serializer:       jsonRequestResponseSerialiser{},
+		pubsub:           pubsub,
+		storage:          storage,
+		replication:      processor.replication,
+		tracking:         processor.tracking,
+		memory:           processor.memory,
+		auth:             newAuthenticator(),
+		closing:          closing,
+		closeStreams: func() {
+			closeOnce.Do(func() {
+				close(closing)
+				processor.stop()
+			})
+		},
+	}
 }
 
 func (s *goodiesHTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	identity, err := s.auth.authenticate(r)
+	if err != nil {
+		s.writeUnauthorized(w, r, err)
+		return
+	}
+	if identity != "" {
+		r = r.WithContext(withIdentity(r.Context(), identity))
+	}
+	switch r.URL.Path {
+	case subscribePath:
+		if s.authorizeStream(w, r) {
+			s.serveSubscribe(w, r)
+		}
+		return
+	case watchPath:
+		s.serveWatch(w, r)
+		return
+	case replicationPath:
+		if s.authorizeStream(w, r) {
+			s.serveReplication(w, r)
+		}
+		return
+	case trackingPath:
+		if s.authorizeStream(w, r) {
+			s.serveTracking(w, r)
+		}
+		return
+	}
+	if isRESTPath(r.URL.Path) {
+		s.serveREST(w, r)
+		return
+	}
 	data, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		panic("Cannot read incoming request")
 	}
-	w.Write(s.serveCommandBytes(data))
+	w.Write(s.serveCommandBytes(r.Context(), data, r.Header.Get(DatabaseHeader)))
+}
+
+// isCommandPath Reports if the path is served as a serialised command rather than REST or an event stream
+func isCommandPath(path string) bool {
+	switch path {
+	case subscribePath, watchPath, replicationPath, trackingPath:
+		return false
+	}
+	return !isRESTPath(path)
 }
 
 func (tr GoodiesHttpCommandClient) Process(req CommandRequest, res *CommandResponse) error {
+	return tr.ProcessContext(context.Background(), req, res)
+}
+
+// ProcessContext Sends the command aborting the request once ctx is done
+func (tr GoodiesHttpCommandClient) ProcessContext(ctx context.Context, req CommandRequest, res *CommandResponse) error {
+	if req.Database == "" {
+		req.Database = tr.database
+	}
 	data, err := tr.serializer.SerialiseRequest(req)
 	if err != nil {
 		return err
 	}
 
-	httpRequest, err := http.NewRequest("POST", tr.address, bytes.NewReader(data))
+	httpRequest, err := http.NewRequestWithContext(ctx, "POST", tr.address, bytes.NewReader(data))
+	if err != nil {
+		return ErrInternalError{err.Error()}
+	}
 	httpRequest.Header.Set("Content-Type", "application/json")
+	tr.credentials.authorize(httpRequest)
 
 	resp, err := tr.client.Do(httpRequest)
 	if err != nil {
@@ -63,21 +176,25 @@ func (tr GoodiesHttpCommandClient) Process(req CommandRequest, res *CommandRespo
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
+	// rejected credentials come as a command response carrying ErrUnauthorized
+	if resp.StatusCode != 200 && resp.StatusCode != http.StatusUnauthorized {
 		return ErrInternalError{fmt.Sprintf("Conectivity issue: %v", resp.Status)}
 	}
 	body, _ := ioutil.ReadAll(resp.Body)
 	return tr.serializer.DeserialiseResponse(body, res)
 }
 
-func (s goodiesHTTPServer) serveCommandBytes(reqData []byte) []byte {
+func (s goodiesHTTPServer) serveCommandBytes(ctx context.Context, reqData []byte, database string) []byte {
 	var req CommandRequest
 	var res CommandResponse
 	err := s.serializer.DeserialiseRequest(reqData, &req)
 	if err != nil {
 		res = CommandResponse{false, "", err}
 	} else {
-		res = s.commandProcessor.HandleCommand(req)
+		if req.Database == "" {
+			req.Database = database
+		}
+		res = s.commandProcessor.HandleCommand(req.WithContext(ctx))
 	}
 
 	data, err := s.serializer.SerialiseResponse(res)
@@ -0,0 +1,235 @@
+package goodies
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	mathrand "math/rand"
+	"sync"
+	"time"
+)
+
+// loaderLockSuffix Suffix of lock names used to load a key by a single instance
+const loaderLockSuffix = ":loading"
+
+// LoadFunc Computes the value of a missing key (e.g. reads it from a database)
+type LoadFunc func(ctx context.Context, key string) (string, error)
+
+// LoaderConfig Configures GetOrLoad behaviour
+type LoaderConfig struct {
+	// TTL Time a loaded value is fresh
+	TTL time.Duration
+	// StaleTTL Time a value is still served after TTL passed while it is reloaded in background
+	// Values are kept for TTL+StaleTTL rounded up to whole seconds
+	StaleTTL time.Duration
+	// Beta Aggressiveness of early probabilistic refresh of fresh values, 0 disables it and 1 is a good default
+	// The slower load is, the earlier refresh is likely to happen
+	Beta float64
+	// LockTTL Enables server-side lock so only one instance loads a key, it should exceed load duration
+	// Provider has to implement LockProvider
+	LockTTL time.Duration
+	// LockWait Time instances not holding the lock wait for the value before loading it themselves
+	LockWait time.Duration
+}
+
+// Loader Cache-aside helper loading missing values once no matter how many callers miss concurrently
+// Values are stored in an envelope keeping their freshness, so loaded keys should be read through the loader
+type Loader struct {
+	provider Provider
+	load     LoadFunc
+	config   LoaderConfig
+	flights  flightGroup
+}
+
+// loaderEntry Envelope of a loaded value, Delta is the duration of the load used for early refresh
+type loaderEntry struct {
+	Value      string
+	FreshUntil int64
+	Delta      int64
+}
+
+// NewLoader Creates a loader over the provider
+func NewLoader(provider Provider, load LoadFunc, config LoaderConfig) *Loader {
+	return &Loader{provider: provider, load: load, config: config, flights: flightGroup{calls: make(map[string]*flight)}}
+}
+
+// GetOrLoad Returns cached value of the key loading it on miss
+// Stale values (and fresh ones picked for early refresh) are returned right away while reloaded in background
+func (l *Loader) GetOrLoad(ctx context.Context, key string) (string, error) {
+	data, err := l.provider.Get(key)
+	if err != nil {
+		if _, notFound := err.(ErrNotFound); !notFound {
+			return "", err
+		}
+	}
+	var entry loaderEntry
+	if err == nil && json.Unmarshal([]byte(data), &entry) == nil {
+		if l.needsRefresh(entry) {
+			go l.flights.do(context.Background(), key, func() (string, error) {
+				refreshCtx, cancel := l.loadContext(context.Background())
+				defer cancel()
+				return l.loadAndStore(refreshCtx, key)
+			})
+		}
+		return entry.Value, nil
+	}
+	return l.flights.do(ctx, key, func() (string, error) {
+		loadCtx, cancel := l.loadContext(ctx)
+		defer cancel()
+		return l.loadAndStore(loadCtx, key)
+	})
+}
+
+// loadContext Returns context of a load shared by callers, so it is not cancelled with the caller starting it
+// but it is bounded by the time the value is served for
+func (l *Loader) loadContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := context.WithoutCancel(ctx)
+	if l.config.TTL+l.config.StaleTTL <= 0 {
+		return context.WithCancel(detached)
+	}
+	return context.WithTimeout(detached, l.config.TTL+l.config.StaleTTL)
+}
+
+// needsRefresh Reports stale entries and picks fresh ones for early refresh (XFetch),
+// probability grows as expiry approaches
+func (l *Loader) needsRefresh(entry loaderEntry) bool {
+	now := time.Now().UnixNano()
+	if now >= entry.FreshUntil {
+		return true
+	}
+	if l.config.Beta <= 0 || entry.Delta <= 0 {
+		return false
+	}
+	gap := -float64(entry.Delta) * l.config.Beta * math.Log(1-mathrand.Float64())
+	return float64(now)+gap >= float64(entry.FreshUntil)
+}
+
+// loadAndStore Loads the value (under server-side lock if configured) and stores it in the envelope
+// If another instance holds the lock its value is awaited for up to LockWait before loading anyway
+func (l *Loader) loadAndStore(ctx context.Context, key string) (string, error) {
+	if l.config.LockTTL > 0 {
+		release, acquired, err := l.lock(key)
+		if err != nil {
+			return "", err
+		}
+		if acquired {
+			defer release()
+		} else if value, loaded := l.waitForValue(ctx, key); loaded {
+			return value, nil
+		}
+	}
+
+	started := time.Now()
+	value, err := l.load(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	finished := time.Now()
+	data, err := json.Marshal(loaderEntry{
+		Value:      value,
+		FreshUntil: finished.Add(l.config.TTL).UnixNano(),
+		Delta:      int64(finished.Sub(started)),
+	})
+	if err != nil {
+		return "", ErrTransformation{err.Error()}
+	}
+	if err := l.provider.Set(key, string(data), l.storedTTL()); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// storedTTL Returns ttl of stored envelopes rounded up to whole seconds, as clients send ttls in seconds
+// and a shorter one would be sent as 0 (never expiring)
+func (l *Loader) storedTTL() time.Duration {
+	ttl := l.config.TTL + l.config.StaleTTL
+	if truncated := ttl.Truncate(time.Second); ttl > 0 && truncated < ttl {
+		return truncated + time.Second
+	}
+	return ttl
+}
+
+// lock Tries to acquire short lock of the key
+func (l *Loader) lock(key string) (release func(), acquired bool, err error) {
+	locks, ok := l.provider.(LockProvider)
+	if !ok {
+		return nil, false, ErrInternalError{"Provider doesn't support locks"}
+	}
+	lease, err := locks.AcquireLock(key+loaderLockSuffix, l.config.LockTTL)
+	if _, locked := err.(ErrLocked); locked {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return func() { locks.ReleaseLock(lease) }, true, nil
+}
+
+// waitForValue Polls for the value loaded by the instance holding the lock
+func (l *Loader) waitForValue(ctx context.Context, key string) (string, bool) {
+	deadline := time.Now().Add(l.config.LockWait)
+	interval := l.config.LockWait / 20
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	for time.Now().Before(deadline) {
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return "", false
+		}
+		data, err := l.provider.Get(key)
+		var entry loaderEntry
+		if err == nil && json.Unmarshal([]byte(data), &entry) == nil {
+			return entry.Value, true
+		}
+	}
+	return "", false
+}
+
+// flightGroup Deduplicates concurrent calls by key, later callers receive result of the running call
+type flightGroup struct {
+	lock  sync.Mutex
+	calls map[string]*flight
+}
+
+type flight struct {
+	done  chan struct{}
+	value string
+	err   error
+}
+
+// do Runs fn unless a call of the key is running already and waits for its result
+// Every caller stops waiting once its own ctx is done, the call itself keeps running for the others
+func (g *flightGroup) do(ctx context.Context, key string, fn func() (string, error)) (string, error) {
+	g.lock.Lock()
+	call, running := g.calls[key]
+	if !running {
+		call = &flight{done: make(chan struct{})}
+		g.calls[key] = call
+		go g.run(key, call, fn)
+	}
+	g.lock.Unlock()
+
+	select {
+	case <-call.done:
+		return call.value, call.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// run Executes the call, a panic of fn is returned to the callers as an error
+func (g *flightGroup) run(key string, call *flight, fn func() (string, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			call.value, call.err = "", ErrInternalError{fmt.Sprintf("Load of %v failed: %v", key, r)}
+		}
+		g.lock.Lock()
+		delete(g.calls, key)
+		g.lock.Unlock()
+		close(call.done)
+	}()
+	call.value, call.err = fn()
+}
@@ -0,0 +1,131 @@
+package goodies
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingLoad Returns load function producing "<key>-<number of the load>" after delay
+func countingLoad(loads *atomic.Int32, delay time.Duration) LoadFunc {
+	return func(ctx context.Context, key string) (string, error) {
+		count := loads.Add(1)
+		time.Sleep(delay)
+		return key + "-" + strconv.Itoa(int(count)), nil
+	}
+}
+
+func TestLoaderCoalescesLoads(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	var loads atomic.Int32
+	// two instances sharing the server, deduplicated by the server-side lock
+	config := LoaderConfig{TTL: time.Minute, LockTTL: time.Second, LockWait: time.Second}
+	loaders := []*Loader{
+		NewLoader(storage, countingLoad(&loads, 50*time.Millisecond), config),
+		NewLoader(storage, countingLoad(&loads, 50*time.Millisecond), config),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(loader *Loader) {
+			defer wg.Done()
+			if val, err := loader.GetOrLoad(context.Background(), "user"); err != nil || val != "user-1" {
+				testing.Errorf("Unexpected loaded value: %v %v", val, err)
+			}
+		}(loaders[i%2])
+	}
+	wg.Wait()
+	if loads.Load() != 1 {
+		testing.Errorf("Expected a single load, got %v", loads.Load())
+	}
+	if _, err := storage.AcquireLock("user"+loaderLockSuffix, time.Second); err != nil {
+		testing.Errorf("Load lock is expected to be released: %v", err)
+	}
+}
+
+func TestLoaderStaleWhileRevalidate(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	var loads atomic.Int32
+	loader := NewLoader(storage, countingLoad(&loads, 0), LoaderConfig{TTL: 50 * time.Millisecond, StaleTTL: time.Minute})
+
+	loader.GetOrLoad(context.Background(), "key")
+	time.Sleep(60 * time.Millisecond)
+	if val, err := loader.GetOrLoad(context.Background(), "key"); err != nil || val != "key-1" {
+		testing.Errorf("Stale value is expected to be served while revalidating: %v %v", val, err)
+	}
+	waitFor(testing, "background refresh", func() bool {
+		val, err := loader.GetOrLoad(context.Background(), "key")
+		return err == nil && val != "key-1"
+	})
+}
+
+func TestLoaderEarlyRefresh(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	var loads atomic.Int32
+	// huge beta makes refresh of a fresh value practically certain
+	loader := NewLoader(storage, countingLoad(&loads, 5*time.Millisecond), LoaderConfig{TTL: time.Minute, Beta: 1e6})
+
+	loader.GetOrLoad(context.Background(), "key")
+	if val, _ := loader.GetOrLoad(context.Background(), "key"); val != "key-1" {
+		testing.Errorf("Fresh value is expected to be returned, got %v", val)
+	}
+	waitFor(testing, "early refresh", func() bool {
+		return loads.Load() >= 2
+	})
+
+	lazy := NewLoader(NewGoodiesStorage(ExpireNever), countingLoad(&loads, 5*time.Millisecond), LoaderConfig{TTL: time.Minute})
+	before := loads.Load()
+	for i := 0; i < 10; i++ {
+		lazy.GetOrLoad(context.Background(), "key")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if loads.Load() != before+1 {
+		testing.Errorf("Fresh values are not expected to be refreshed without beta, loads: %v", loads.Load()-before)
+	}
+}
+
+func TestLoaderSharedLoad(testing *testing.T) {
+	var loads atomic.Int32
+	loader := NewLoader(NewGoodiesStorage(ExpireNever), countingLoad(&loads, 50*time.Millisecond), LoaderConfig{TTL: time.Minute})
+	cancelled, cancel := context.WithCancel(context.Background())
+	first := make(chan error)
+	go func() {
+		_, err := loader.GetOrLoad(cancelled, "key")
+		first <- err
+	}()
+	waitFor(testing, "load start", func() bool { return loads.Load() == 1 })
+	cancel()
+	if err := <-first; err != context.Canceled {
+		testing.Errorf("Cancelled caller is expected to stop waiting, got %v", err)
+	}
+	if val, err := loader.GetOrLoad(context.Background(), "key"); err != nil || val != "key-1" {
+		testing.Errorf("Load is expected to go on for other callers: %v %v", val, err)
+	}
+
+	panicking := NewLoader(NewGoodiesStorage(ExpireNever), func(ctx context.Context, key string) (string, error) {
+		panic("broken")
+	}, LoaderConfig{TTL: time.Minute})
+	if _, err := panicking.GetOrLoad(context.Background(), "key"); err == nil {
+		testing.Error("Panicking load is expected to return an error")
+	}
+}
+
+func TestLoaderTTLOverClient(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	server := httptest.NewServer(newGoodiesHTTPHandler(storage))
+	defer server.Close()
+	var loads atomic.Int32
+	loader := NewLoader(NewGoodiesClient(server.URL), countingLoad(&loads, 0), LoaderConfig{TTL: 300 * time.Millisecond})
+	if _, err := loader.GetOrLoad(context.Background(), "key"); err != nil {
+		testing.Fatalf("Unexpected error on load: %v", err)
+	}
+	expiry := storage.storage["key"].Expiry
+	if expiry == 0 || time.Until(time.Unix(0, expiry)) > time.Second {
+		testing.Errorf("Ttl shorter than a second is expected to be rounded up to one, expires at %v", expiry)
+	}
+}
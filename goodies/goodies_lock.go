@@ -0,0 +1,288 @@
+package goodies
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	mathrand "math/rand"
+	"strconv"
+	"time"
+)
+
+const (
+	// lockWaitMinInterval First pause between acquisition attempts of a blocking acquire, doubled on every attempt
+	lockWaitMinInterval = 5 * time.Millisecond
+	// lockWaitMaxInterval Longest pause between acquisition attempts of a blocking acquire
+	lockWaitMaxInterval = 200 * time.Millisecond
+)
+
+func init() {
+	gob.Register(lockItem{})
+}
+
+// Lease Ownership of a lock
+// Token is a fencing token: it grows with every acquisition, so resources protected by the lock can
+// reject writes of a holder whose lease expired meanwhile (it holds a smaller token than the current one)
+type Lease struct {
+	Name  string
+	Owner string
+	Token int64
+}
+
+// LockProvider Distributed lock interface implemented by GoodiesStorage and the client returned from NewGoodiesClient
+// Held locks share the key space with other items and expire with their leases, fencing counters are kept
+// in the server state, so they keep growing after locks are released, expired, removed or overwritten
+type LockProvider interface {
+	// AcquireLock Acquires the lock for ttl, returns ErrLocked if it is held by someone else
+	AcquireLock(name string, ttl time.Duration) (Lease, error)
+	// RenewLock Extends the lease to ttl from now, returns ErrLockNotHeld if the lease is no longer valid
+	RenewLock(lease Lease, ttl time.Duration) error
+	// ReleaseLock Releases the lock, returns ErrLockNotHeld if the lease is no longer valid
+	ReleaseLock(lease Lease) error
+}
+
+// AcquireLockWait Retries acquiring the lock until it succeeds, timeout passes (ErrLocked) or ctx is done
+func AcquireLockWait(ctx context.Context, locks LockProvider, name string, ttl time.Duration, timeout time.Duration) (Lease, error) {
+	deadline := time.Now().Add(timeout)
+	interval := lockWaitMinInterval
+	for {
+		lease, err := locks.AcquireLock(name, ttl)
+		if _, locked := err.(ErrLocked); !locked {
+			return lease, err
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return Lease{}, err
+		}
+		pause := interval/2 + time.Duration(mathrand.Int63n(int64(interval/2)))
+		if pause > remaining {
+			pause = remaining
+		}
+		select {
+		case <-time.After(pause):
+		case <-ctx.Done():
+			return Lease{}, ctx.Err()
+		}
+		if interval *= 2; interval > lockWaitMaxInterval {
+			interval = lockWaitMaxInterval
+		}
+	}
+}
+
+// lockItem Stored state of a held lock, it is removed once released
+type lockItem struct {
+	Owner      string
+	Token      int64
+	LeaseUntil int64
+}
+
+// locker is implemented by storages executing lock commands atomically
+type locker interface {
+	acquireLock(name string, owner string, ttl time.Duration) (int64, error)
+	renewLock(name string, owner string, ttl time.Duration) error
+	releaseLock(name string, owner string) error
+}
+
+func newOwnerToken() string {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		panic("Cannot generate owner token")
+	}
+	return hex.EncodeToString(token)
+}
+
+func (g *GoodiesStorage) AcquireLock(name string, ttl time.Duration) (Lease, error) {
+	owner := newOwnerToken()
+	token, err := g.acquireLock(name, owner, ttl)
+	if err != nil {
+		return Lease{}, err
+	}
+	return Lease{name, owner, token}, nil
+}
+
+func (g *GoodiesStorage) RenewLock(lease Lease, ttl time.Duration) error {
+	return g.renewLock(lease.Name, lease.Owner, ttl)
+}
+
+func (g *GoodiesStorage) ReleaseLock(lease Lease) error {
+	return g.releaseLock(lease.Name, lease.Owner)
+}
+
+// internalGetLock Returns lock state, zero state if it doesn't exist
+func (g *GoodiesStorage) internalGetLock(name string) (lockItem, error) {
+	value, found := g.internalGet(name)
+	if !found {
+		return lockItem{}, nil
+	}
+	state, ok := value.(lockItem)
+	if !ok {
+		return lockItem{}, ErrTypeMismatch{fmt.Sprintf("Item %v is not a lock", name)}
+	}
+	return state, nil
+}
+
+// internalFence Raises the fencing counter of the lock to token, returns the current counter
+// Must be called under write lock
+func (g *GoodiesStorage) internalFence(name string, token int64) int64 {
+	if g.state.Locks == nil {
+		g.state.Locks = make(map[string]int64)
+	}
+	if token > g.state.Locks[name] {
+		g.state.Locks[name] = token
+	}
+	return g.state.Locks[name]
+}
+
+// acquireLock Acquires the lock for the owner, acquiring a lock held by the same owner extends its lease
+func (g *GoodiesStorage) acquireLock(name string, owner string, ttl time.Duration) (int64, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.internalExpire(name)
+	state, err := g.internalGetLock(name)
+	if err != nil {
+		return 0, err
+	}
+	held := state.Owner != "" && !checkExpiry(state.LeaseUntil)
+	if held && state.Owner != owner {
+		return 0, ErrLocked{fmt.Sprintf("Lock %v is held by another owner", name)}
+	}
+	if !held {
+		// items holding locks might have been restored without the counter (e.g. by replication)
+		state.Token = g.internalFence(name, state.Token) + 1
+		g.internalFence(name, state.Token)
+	}
+	state.Owner, state.LeaseUntil = owner, getExpiry(ttl, g.defaultExpiry)
+	g.storage[name] = newItemWithExpiry(state, state.LeaseUntil)
+	g.emit(KeySet, name)
+	return state.Token, nil
+}
+
+func (g *GoodiesStorage) renewLock(name string, owner string, ttl time.Duration) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	state, err := g.internalGetLock(name)
+	if err != nil {
+		return err
+	}
+	if state.Owner != owner || checkExpiry(state.LeaseUntil) {
+		return ErrLockNotHeld{fmt.Sprintf("Lease of lock %v is not valid", name)}
+	}
+	state.LeaseUntil = getExpiry(ttl, g.defaultExpiry)
+	g.storage[name] = newItemWithExpiry(state, state.LeaseUntil)
+	g.emit(KeyUpdated, name)
+	return nil
+}
+
+func (g *GoodiesStorage) releaseLock(name string, owner string) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	state, err := g.internalGetLock(name)
+	if err != nil {
+		return err
+	}
+	if state.Owner != owner || checkExpiry(state.LeaseUntil) {
+		return ErrLockNotHeld{fmt.Sprintf("Lease of lock %v is not valid", name)}
+	}
+	g.internalFence(name, state.Token)
+	g.internalRemove(name)
+	g.emit(KeyRemoved, name)
+	return nil
+}
+
+// parseLockTTL Parses lease ttl, it is sent in milliseconds as leases are usually short
+func parseLockTTL(s string) (time.Duration, error) {
+	millis, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || millis <= 0 {
+		return 0, ErrCommandArgumentsMismatch{"Lock ttl is expected to be a positive integer (milliseconds)"}
+	}
+	return time.Duration(millis) * time.Millisecond, nil
+}
+
+func lockTTLAsString(ttl time.Duration) string {
+	return strconv.FormatInt(ttl.Milliseconds(), 10)
+}
+
+func lockAcquireCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 3 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"LockAcquire command is expected to have 3 arguments (name, owner, ttl(INT MILLISECONDS))"})
+	}
+	locker, ok := storage.(locker)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support locks"})
+	}
+	ttl, err := parseLockTTL(command.Parameters[2])
+	if err != nil {
+		return createErrorResult(err)
+	}
+	token, err := locker.acquireLock(command.Parameters[0], command.Parameters[1], ttl)
+	if err != nil {
+		return createErrorResult(err)
+	}
+	return createOkResult(strconv.FormatInt(token, 10))
+}
+
+func lockRenewCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 3 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"LockRenew command is expected to have 3 arguments (name, owner, ttl(INT MILLISECONDS))"})
+	}
+	locker, ok := storage.(locker)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support locks"})
+	}
+	ttl, err := parseLockTTL(command.Parameters[2])
+	if err != nil {
+		return createErrorResult(err)
+	}
+	if err = locker.renewLock(command.Parameters[0], command.Parameters[1], ttl); err != nil {
+		return createErrorResult(err)
+	}
+	return createOkResult("")
+}
+
+func lockReleaseCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 2 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"LockRelease command is expected to have 2 arguments (name, owner)"})
+	}
+	locker, ok := storage.(locker)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support locks"})
+	}
+	if err := locker.releaseLock(command.Parameters[0], command.Parameters[1]); err != nil {
+		return createErrorResult(err)
+	}
+	return createOkResult("")
+}
+
+func (c goodiesClient) AcquireLock(name string, ttl time.Duration) (Lease, error) {
+	owner := newOwnerToken()
+	req := CommandRequest{Name: "LockAcquire", Parameters: []string{name, owner, lockTTLAsString(ttl)}}
+	res := internalProcess(req, c)
+	if !res.Success {
+		return Lease{}, res.Err
+	}
+	token, err := strconv.ParseInt(res.Result, 10, 64)
+	if err != nil {
+		return Lease{}, ErrTransformation{err.Error()}
+	}
+	return Lease{name, owner, token}, nil
+}
+
+func (c goodiesClient) RenewLock(lease Lease, ttl time.Duration) error {
+	req := CommandRequest{Name: "LockRenew", Parameters: []string{lease.Name, lease.Owner, lockTTLAsString(ttl)}}
+	res := internalProcess(req, c)
+	if !res.Success {
+		return res.Err
+	}
+	return nil
+}
+
+func (c goodiesClient) ReleaseLock(lease Lease) error {
+	req := CommandRequest{Name: "LockRelease", Parameters: []string{lease.Name, lease.Owner}}
+	res := internalProcess(req, c)
+	if !res.Success {
+		return res.Err
+	}
+	return nil
+}
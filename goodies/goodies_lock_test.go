@@ -0,0 +1,134 @@
+package goodies
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStorageLock(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	first, err := storage.AcquireLock("resource", time.Minute)
+	if err != nil || first.Token != 1 {
+		testing.Fatalf("Unexpected result of first acquire: %+v %v", first, err)
+	}
+	if _, err := storage.AcquireLock("resource", time.Minute); err == nil {
+		testing.Fatal("Held lock is not expected to be acquired")
+	} else if _, locked := err.(ErrLocked); !locked {
+		testing.Errorf("Expected ErrLocked, got %v", err)
+	}
+
+	stranger := Lease{Name: "resource", Owner: "stranger", Token: first.Token}
+	if _, notHeld := storage.RenewLock(stranger, time.Minute).(ErrLockNotHeld); !notHeld {
+		testing.Error("Lock is not expected to be renewed by another owner")
+	}
+	if _, notHeld := storage.ReleaseLock(stranger).(ErrLockNotHeld); !notHeld {
+		testing.Error("Lock is not expected to be released by another owner")
+	}
+	if err := storage.RenewLock(first, time.Minute); err != nil {
+		testing.Errorf("Unexpected error on renew: %v", err)
+	}
+	if err := storage.ReleaseLock(first); err != nil {
+		testing.Errorf("Unexpected error on release: %v", err)
+	}
+	if err := storage.ReleaseLock(first); err == nil {
+		testing.Error("Released lease is not expected to be valid")
+	}
+
+	second, err := storage.AcquireLock("resource", 20*time.Millisecond)
+	if err != nil || second.Token != 2 {
+		testing.Fatalf("Unexpected result of acquire after release: %+v %v", second, err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	third, err := storage.AcquireLock("resource", time.Minute)
+	if err != nil || third.Token != 3 {
+		testing.Fatalf("Expired lease is expected to be taken over: %+v %v", third, err)
+	}
+	if err := storage.RenewLock(second, time.Minute); err == nil {
+		testing.Error("Expired lease is not expected to be renewed")
+	}
+
+	// fencing counter survives restarts
+	var snapshot bytes.Buffer
+	storage.writeSnapshot(&snapshot)
+	restored := NewGoodiesStorage(ExpireNever)
+	if err := restored.loadSnapshot(&snapshot); err != nil {
+		testing.Fatalf("Unexpected error on snapshot load: %v", err)
+	}
+	restored.ReleaseLock(third)
+	if fourth, err := restored.AcquireLock("resource", time.Minute); err != nil || fourth.Token != 4 {
+		testing.Errorf("Fencing token is expected to keep growing after restore: %+v %v", fourth, err)
+	}
+}
+
+func TestLockFlushAll(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	first, _ := storage.AcquireLock("resource", time.Minute)
+	storage.Set("key", "value", ExpireNever)
+	storage.FlushAll()
+	if _, err := storage.Get("key"); err == nil {
+		testing.Error("Items are expected to be flushed")
+	}
+	if _, notHeld := storage.ReleaseLock(first).(ErrLockNotHeld); !notHeld {
+		testing.Error("Flushed lock is expected to be released")
+	}
+	if second, err := storage.AcquireLock("resource", time.Minute); err != nil || second.Token <= first.Token {
+		testing.Errorf("Fencing token is expected to keep growing after flush: %+v %v", second, err)
+	}
+}
+
+func TestLockFencingCounter(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	first, _ := storage.AcquireLock("resource", time.Minute)
+	storage.ReleaseLock(first)
+	if keys, _ := storage.Keys(); len(keys) != 0 {
+		testing.Errorf("Released lock is expected to be removed: %v", keys)
+	}
+	second, _ := storage.AcquireLock("resource", time.Minute)
+	storage.Remove("resource")
+	third, err := storage.AcquireLock("resource", time.Minute)
+	if err != nil || third.Token <= second.Token {
+		testing.Errorf("Fencing token is expected to keep growing after remove: %+v %v", third, err)
+	}
+	storage.Set("resource", "value", ExpireNever)
+	if _, err := storage.AcquireLock("resource", time.Minute); err == nil {
+		testing.Error("Item which is not a lock is not expected to be acquired")
+	}
+	storage.Remove("resource")
+	if fourth, err := storage.AcquireLock("resource", time.Minute); err != nil || fourth.Token <= third.Token {
+		testing.Errorf("Fencing token is expected to keep growing after overwrite: %+v %v", fourth, err)
+	}
+}
+
+func TestClientLockWait(testing *testing.T) {
+	server := httptest.NewServer(newGoodiesHTTPHandler(NewGoodiesStorage(ExpireNever)))
+	defer server.Close()
+	first := NewGoodiesClient(server.URL).(LockProvider)
+	second := NewGoodiesClient(server.URL).(LockProvider)
+
+	lease, err := first.AcquireLock("job", time.Minute)
+	if err != nil {
+		testing.Fatalf("Unexpected error on acquire: %v", err)
+	}
+	if _, err := AcquireLockWait(context.Background(), second, "job", time.Minute, 30*time.Millisecond); err == nil {
+		testing.Fatal("Blocking acquire is expected to time out while lock is held")
+	} else if _, locked := err.(ErrLocked); !locked {
+		testing.Errorf("Expected ErrLocked on timeout, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		first.ReleaseLock(lease)
+	}()
+	next, err := AcquireLockWait(context.Background(), second, "job", time.Minute, 5*time.Second)
+	if err != nil || next.Token != lease.Token+1 {
+		testing.Errorf("Blocking acquire didn't get released lock: %+v %v", next, err)
+	}
+	if err := first.RenewLock(lease, time.Minute); err == nil {
+		testing.Error("Old owner is not expected to renew lock taken by another owner")
+	} else if _, notHeld := err.(ErrLockNotHeld); !notHeld {
+		testing.Errorf("Expected ErrLockNotHeld through client, got %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package goodies
+
+import (
+	"fmt"
+	"sync"
+)
+
+const (
+	// MemoryPolicyNoEviction Writes exceeding the memory limit are rejected with ErrOutOfMemory
+	MemoryPolicyNoEviction = "noeviction"
+	// MemoryPolicyAllKeysRandom Random keys of any database are evicted to make room for writes, locks are never evicted
+	MemoryPolicyAllKeysRandom = "allkeys-random"
+)
+
+// MemoryConfig Configures the memory limit of the server, sizes of items are estimated the way quotas measure them
+type MemoryConfig struct {
+	// MaxBytes Limit of the items of all databases, 0 means unlimited
+	MaxBytes int64 `json:"maxBytes"`
+	// Policy Handling of writes exceeding the limit (MemoryPolicyNoEviction or MemoryPolicyAllKeysRandom)
+	Policy string `json:"policy"`
+}
+
+func (c MemoryConfig) validate() error {
+	if c.MaxBytes < 0 {
+		return ErrInvalidConfig{"memory maxBytes cannot be negative"}
+	}
+	switch c.Policy {
+	case MemoryPolicyNoEviction, MemoryPolicyAllKeysRandom:
+	default:
+		return ErrInvalidConfig{fmt.Sprintf("unknown memory policy %q (expected %v or %v)", c.Policy, MemoryPolicyNoEviction, MemoryPolicyAllKeysRandom)}
+	}
+	return nil
+}
+
+// evictor is implemented by storages able to free memory on their own
+type evictor interface {
+	// evictRandom Removes a random item other than a lock or the kept key, returns false if there is none
+	evictRandom(keep string) (string, bool)
+}
+
+func (g *GoodiesStorage) evictRandom(keep string) (string, bool) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	// iteration over a map starts at a random item
+	for key, item := range g.storage {
+		if _, lock := item.Value.(lockItem); lock || key == keep {
+			continue
+		}
+		g.internalRemove(key)
+		if checkExpiry(item.Expiry) {
+			g.emit(KeyExpired, key)
+		} else {
+			g.emit(KeyEvicted, key)
+		}
+		return key, true
+	}
+	return "", false
+}
+
+// memoryLimit Enforces the memory limit of the command processor over all databases, lock guards config and
+// usage map only (usages are locked on their own like the ones of quotas)
+type memoryLimit struct {
+	lock   sync.Mutex
+	config MemoryConfig
+	usage  map[string]*namespaceUsage
+}
+
+func newMemoryLimit() *memoryLimit {
+	return &memoryLimit{config: MemoryConfig{Policy: MemoryPolicyNoEviction}, usage: make(map[string]*namespaceUsage)}
+}
+
+// configure Applies the limit, databases are observed once a write is limited
+func (m *memoryLimit) configure(config MemoryConfig) {
+	m.lock.Lock()
+	m.config = config
+	var stopped map[string]*namespaceUsage
+	if config.MaxBytes == 0 {
+		stopped, m.usage = m.usage, make(map[string]*namespaceUsage)
+	}
+	m.lock.Unlock()
+	// cancelled without the lock, as cancelling waits for the storage
+	for _, usage := range stopped {
+		usage.cancel()
+	}
+}
+
+// observe Starts observing databases which are not observed yet and stops observing removed ones
+// root is the default database, storage the one addressed by the command
+func (m *memoryLimit) observe(root Provider, database string, storage Provider) {
+	current := map[string]Provider{DefaultDatabase: root, database: storage}
+	if set, ok := root.(databases); ok {
+		for name, named := range set.namedDatabases() {
+			current[name] = named
+		}
+	}
+	m.lock.Lock()
+	var stopped []*namespaceUsage
+	for name, usage := range m.usage {
+		if current[name] != usage.storage {
+			stopped = append(stopped, usage)
+			delete(m.usage, name)
+		}
+	}
+	missing := make(map[string]Provider)
+	for name, provider := range current {
+		if _, found := m.usage[name]; !found {
+			missing[name] = provider
+		}
+	}
+	m.lock.Unlock()
+	for _, usage := range stopped {
+		usage.cancel()
+	}
+	for name, provider := range missing {
+		observable, ok := provider.(sizeObservable)
+		if !ok {
+			continue
+		}
+		observed := &namespaceUsage{storage: provider, sizes: make(map[string]int64)}
+		observed.cancel = observable.observeSizes("", observed.set)
+		m.lock.Lock()
+		if _, found := m.usage[name]; found {
+			// observed concurrently
+			m.lock.Unlock()
+			observed.cancel()
+			continue
+		}
+		m.usage[name] = observed
+		m.lock.Unlock()
+	}
+}
+
+// bytes Returns memory used by all observed databases and the size of the key in the addressed one
+func (m *memoryLimit) bytes(database string, key string) (total int64, current int64, counted bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for name, usage := range m.usage {
+		usage.lock.Lock()
+		total += usage.bytes
+		if name == database {
+			current, counted = usage.sizes[key]
+		}
+		usage.lock.Unlock()
+	}
+	return total, current, counted
+}
+
+// evict Evicts a random key of any observed database but the written one, returns the Remove replicating it
+func (m *memoryLimit) evict(database string, key string) (CommandRequest, bool) {
+	m.lock.Lock()
+	storages := make(map[string]Provider, len(m.usage))
+	for name, usage := range m.usage {
+		storages[name] = usage.storage
+	}
+	m.lock.Unlock()
+	for name, storage := range storages {
+		evictor, ok := storage.(evictor)
+		if !ok {
+			continue
+		}
+		keep := ""
+		if name == database {
+			keep = key
+		}
+		if evicted, ok := evictor.evictRandom(keep); ok {
+			return CommandRequest{Name: "Remove", Parameters: []string{evicted}, Database: name}, true
+		}
+	}
+	return CommandRequest{}, false
+}
+
+// reserve Returns ErrOutOfMemory if the command would grow memory over the limit, under MemoryPolicyAllKeysRandom
+// keys are evicted until it fits instead, the evicted keys are returned as Remove commands replicating the eviction
+// Concurrent writes are checked independently, so together they can exceed the limit slightly
+func (m *memoryLimit) reserve(req CommandRequest, root Provider, storage Provider) ([]CommandRequest, error) {
+	m.lock.Lock()
+	config := m.config
+	m.lock.Unlock()
+	growing := mutatingCommands[req.Name] && !releasingCommands[req.Name]
+	if config.MaxBytes == 0 || !growing || !keyedCommands[req.Name] || len(req.Parameters) == 0 {
+		return nil, nil
+	}
+	if _, ok := storage.(sizeObservable); !ok {
+		return nil, nil
+	}
+	database := normaliseDatabase(req.Database)
+	m.observe(root, database, storage)
+	key := req.Parameters[0]
+	var evicted []CommandRequest
+	for {
+		total, current, counted := m.bytes(database, key)
+		written := writtenSize(req, current, counted)
+		if total-current+written <= config.MaxBytes {
+			return evicted, nil
+		}
+		// evicting everything else wouldn't make room for an item over the limit on its own
+		if config.Policy != MemoryPolicyAllKeysRandom || written > config.MaxBytes {
+			return evicted, ErrOutOfMemory{fmt.Sprintf("Command %v exceeds the memory limit of %v bytes", req.Name, config.MaxBytes)}
+		}
+		remove, ok := m.evict(database, key)
+		if !ok {
+			return evicted, ErrOutOfMemory{fmt.Sprintf("Command %v exceeds the memory limit of %v bytes and nothing can be evicted", req.Name, config.MaxBytes)}
+		}
+		evicted = append(evicted, remove)
+	}
+}
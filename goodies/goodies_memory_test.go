@@ -0,0 +1,70 @@
+package goodies
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMemoryLimitNoEviction(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	processor := newGoodiesCommandProcessor(storage, NewPubSub())
+	processor.memory.configure(MemoryConfig{MaxBytes: 20, Policy: MemoryPolicyNoEviction})
+
+	set := func(key string, value string) CommandResponse {
+		return processor.HandleCommand(CommandRequest{Name: "Set", Parameters: []string{key, value, "-1"}})
+	}
+	if res := set("a", strings.Repeat("x", 9)); !res.Success {
+		testing.Errorf("Unexpected error within the limit: %v", res.Err)
+	}
+	res := set("b", strings.Repeat("x", 10))
+	if _, full := res.Err.(ErrOutOfMemory); !full {
+		testing.Errorf("Expected ErrOutOfMemory over the limit, got %+v", res)
+	}
+	if res := set("a", strings.Repeat("x", 19)); !res.Success {
+		testing.Errorf("Replaced value is expected to be discounted: %v", res.Err)
+	}
+	if res := processor.HandleCommand(CommandRequest{Name: "Remove", Parameters: []string{"a"}}); !res.Success {
+		testing.Errorf("Removals are expected to be allowed at the limit: %v", res.Err)
+	}
+	if res := set("b", strings.Repeat("x", 10)); !res.Success {
+		testing.Errorf("Removal is expected to free memory: %v", res.Err)
+	}
+}
+
+func TestMemoryLimitEviction(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	storage.CreateDatabase("staging", ExpireNever)
+	staging, _ := storage.Database("staging")
+	staging.Set("old", strings.Repeat("x", 7), ExpireNever)
+	storage.AcquireLock("lock", 0)
+	watcher, _ := staging.Watch("")
+	defer watcher.Close()
+	processor := newGoodiesCommandProcessor(storage, NewPubSub())
+	lock, _ := storage.internalGetLock("lock")
+	limit := int64(len("lock")) + itemValueSize(lock) + 40
+	processor.memory.configure(MemoryConfig{MaxBytes: limit, Policy: MemoryPolicyAllKeysRandom})
+
+	res := processor.HandleCommand(CommandRequest{Name: "Set", Parameters: []string{"new", strings.Repeat("x", 30), "-1"}})
+	if !res.Success {
+		testing.Fatalf("Unexpected error on eviction: %v", res.Err)
+	}
+	expectKeyEvent(testing, watcher, KeyEvicted, "old")
+	if _, err := storage.Get("new"); err != nil {
+		testing.Errorf("Written key is expected to be kept: %v", err)
+	}
+	if _, err := storage.internalGetLock("lock"); err != nil || len(storage.storage) != 2 {
+		testing.Errorf("Locks are expected to survive eviction: %v %v", storage.storage, err)
+	}
+	entries, _, _ := processor.replication.entriesSince(0)
+	if len(entries) != 2 || entries[0].Command.Name != "Remove" || entries[0].Command.Database != "staging" {
+		testing.Errorf("Eviction is expected to be replicated before the write: %+v", entries)
+	}
+
+	res = processor.HandleCommand(CommandRequest{Name: "Set", Parameters: []string{"huge", strings.Repeat("x", int(limit)), "-1"}})
+	if _, full := res.Err.(ErrOutOfMemory); !full {
+		testing.Errorf("Expected ErrOutOfMemory for an item over the limit, got %+v", res)
+	}
+	if _, err := storage.Get("new"); err != nil {
+		testing.Errorf("Nothing is expected to be evicted for an item over the limit: %v", err)
+	}
+}
@@ -1,18 +1,38 @@
 package goodies
 
 import (
+	"bytes"
 	"encoding/gob"
 	"fmt"
+	"io"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+func init() {
+	// item values are stored as interface{} so non basic value types have to be known to gob
+	gob.Register(map[string]string{})
+}
+
 // Persister type performing reccurent persists
 type Persister struct {
 	*GoodiesStorage
 	stop     chan bool
+	done     chan struct{}
 	filename string
-	interval time.Duration
+	interval *atomic.Int64
+	// intervalChanged Signals the persister to apply the latest interval, a pending signal is enough for any
+	// number of changes, so setting the interval never waits for the persister
+	intervalChanged chan struct{}
+	// saving serialises snapshots taken by the timer and by Save commands
+	saving   *sync.Mutex
+	lastSave *atomic.Int64
+	// keys Encryption keys of snapshots, nil saves them plain
+	keys *atomic.Pointer[EncryptionKeys]
+	// unloaded Why the existing snapshot was not loaded, such a snapshot is never overwritten
+	unloaded error
 }
 
 type StoppableProvider interface {
@@ -21,43 +41,107 @@ type StoppableProvider interface {
 }
 
 //NewGoodiesPersistedStorage Creates an instance of persisted goodies storage
+// If the snapshot exists but cannot be loaded (e.g. it is encrypted, see OpenGoodiesPersistedStorage) the error
+// is logged and the storage starts empty without ever saving, so the snapshot is kept for recovery
 func NewGoodiesPersistedStorage(ttl time.Duration, filename string, persistenceInterval time.Duration) StoppableProvider {
+	persisted, err := newPersister(ttl, filename, persistenceInterval, nil)
+	if err != nil {
+		fmt.Printf("Snapshot %v is kept and not saved over, storage starts empty: %v\n", filename, err)
+		persisted.unloaded = err
+	}
+	go persisted.runPersister()
+	return persisted
+}
+
+// OpenGoodiesPersistedStorage Creates an instance of persisted goodies storage, snapshots are encrypted by keys
+// unless they are nil
+// Unlike NewGoodiesPersistedStorage it returns an error instead of starting empty if the snapshot exists
+// but cannot be loaded (e.g. ErrEncryption for a wrong key)
+func OpenGoodiesPersistedStorage(ttl time.Duration, filename string, persistenceInterval time.Duration, keys *EncryptionKeys) (StoppableProvider, error) {
+	persisted, err := newPersister(ttl, filename, persistenceInterval, keys)
+	if err != nil {
+		return nil, err
+	}
+	go persisted.runPersister()
+	return persisted, nil
+}
+
+// newPersister Creates persisted storage loaded from the snapshot (if it exists), the returned error
+// tells why it was not loaded
+func newPersister(ttl time.Duration, filename string, persistenceInterval time.Duration, keys *EncryptionKeys) (Persister, error) {
 	storage := NewGoodiesStorage(ttl)
 
 	persisted := Persister{
-		GoodiesStorage: storage,
-		stop:           make(chan bool),
-		filename:       filename,
-		interval:       persistenceInterval,
+		GoodiesStorage:  storage,
+		stop:            make(chan bool),
+		done:            make(chan struct{}),
+		filename:        filename,
+		interval:        &atomic.Int64{},
+		intervalChanged: make(chan struct{}, 1),
+		saving:          &sync.Mutex{},
+		lastSave:        &atomic.Int64{},
+		keys:            &atomic.Pointer[EncryptionKeys]{},
 	}
+	persisted.interval.Store(int64(persistenceInterval))
+	persisted.keys.Store(keys)
 	if filename == "" {
 		panic("Filename cannot be empty")
 	}
 
-	initialStorage := make(map[string]goodiesItem)
-	_ = persisted.Load(&initialStorage)
-	persisted.storage = initialStorage
-	go persisted.runPersister()
-	return persisted
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return persisted, nil
+	}
+	if err != nil {
+		return persisted, ErrInternalError{fmt.Sprintf("Snapshot %v not loaded: %v", filename, err)}
+	}
+	snapshot, err := openSnapshot(data, keys)
+	if err != nil {
+		return persisted, err
+	}
+	if err := storage.loadSnapshot(bytes.NewReader(snapshot)); err != nil {
+		return persisted, err
+	}
+	return persisted, nil
 }
 
 //Stop method is a nice way to clearly stop the cache
+// Returns once the final snapshot is saved
 func (p Persister) Stop() {
 	p.stop <- true
+	<-p.done
+}
+
+// PersistInterval Returns the interval between snapshots
+func (p Persister) PersistInterval() time.Duration {
+	return time.Duration(p.interval.Load())
+}
+
+// SetPersistInterval Changes the interval between snapshots, the next one is taken interval from now
+func (p Persister) SetPersistInterval(interval time.Duration) {
+	p.interval.Store(int64(interval))
+	select {
+	case p.intervalChanged <- struct{}{}:
+	default:
+	}
 }
 
 func (p *Persister) runPersister() {
-	persistTrigger := time.NewTicker(p.interval)
+	defer close(p.done)
+	persistTrigger := time.NewTicker(p.PersistInterval())
+	defer persistTrigger.Stop()
 	for {
 		select {
+		case <-p.intervalChanged:
+			persistTrigger.Reset(p.PersistInterval())
 		case <-persistTrigger.C:
 			p.cleanupOutdated()
-			if err := p.Save(p.getBlob()); err != nil {
+			if err := p.persist(); err != nil {
 				fmt.Printf("Backup not saved %v\n", err)
 			}
 		case <-p.stop:
 			p.cleanupOutdated()
-			if err := p.Save(p.getBlob()); err != nil {
+			if err := p.persist(); err != nil {
 				fmt.Printf("Backup not saved %v\n", err)
 			}
 			return
@@ -69,8 +153,7 @@ func (p *Persister) runPersister() {
 func (p *Persister) Load(data interface{}) error {
 	file, err := os.Open(p.filename)
 	if err == nil {
-		decoder := gob.NewDecoder(file)
-		err = decoder.Decode(data)
+		err = decodeSnapshot(file, data)
 	}
 	file.Close()
 	return err
@@ -80,9 +163,155 @@ func (p *Persister) Load(data interface{}) error {
 func (p *Persister) Save(data interface{}) error {
 	file, err := os.Create(p.filename)
 	if err == nil {
-		encoder := gob.NewEncoder(file)
-		err = encoder.Encode(data)
+		err = encodeSnapshot(file, data)
 	}
 	file.Close()
 	return err
 }
+
+// SaveSnapshot Saves the snapshot right away, waiting for a save in progress first
+func (p Persister) SaveSnapshot() error {
+	return p.persist()
+}
+
+// BackgroundSave Starts saving the snapshot, returns ErrInternalError if a save is in progress already
+func (p Persister) BackgroundSave() error {
+	if !p.saving.TryLock() {
+		return ErrInternalError{"Snapshot save is already in progress"}
+	}
+	go func() {
+		defer p.saving.Unlock()
+		if err := p.writeFile(); err != nil {
+			fmt.Printf("Backup not saved %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// LastSave Returns time of the last successful save, zero time if nothing was saved since start
+func (p Persister) LastSave() time.Time {
+	if saved := p.lastSave.Load(); saved != 0 {
+		return time.Unix(0, saved)
+	}
+	return time.Time{}
+}
+
+// persist Saves a consistent snapshot of items replacing file storage only once it is fully written
+func (p *Persister) persist() error {
+	p.saving.Lock()
+	defer p.saving.Unlock()
+	return p.writeFile()
+}
+
+// writeFile Writes the snapshot, has to be called while holding saving
+func (p *Persister) writeFile() error {
+	if p.unloaded != nil {
+		return ErrInternalError{fmt.Sprintf("Snapshot %v was not loaded, so it is not overwritten: %v", p.filename, p.unloaded)}
+	}
+	tmp := p.filename + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = p.writeEncrypted(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, p.filename); err != nil {
+		return err
+	}
+	p.lastSave.Store(time.Now().UnixNano())
+	return nil
+}
+
+// writeEncrypted Writes the snapshot encrypted by the current key, plain if there are no keys
+func (p *Persister) writeEncrypted(w io.Writer) error {
+	keys := p.keys.Load()
+	if keys == nil {
+		return p.writeSnapshot(w)
+	}
+	// GCM authenticates the snapshot as a whole, so it is sealed in memory
+	var snapshot bytes.Buffer
+	if err := p.writeSnapshot(&snapshot); err != nil {
+		return err
+	}
+	sealed, err := keys.sealSnapshot(snapshot.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(sealed)
+	return err
+}
+
+// snapshotter is implemented by storages able to take and restore consistent snapshots
+type snapshotter interface {
+	writeSnapshot(w io.Writer) error
+	loadSnapshot(r io.Reader) error
+}
+
+// encodeSnapshot Writes blob in the format shared by persistence and replication
+func encodeSnapshot(w io.Writer, data interface{}) error {
+	return gob.NewEncoder(w).Encode(data)
+}
+
+// decodeSnapshot Reads blob written by encodeSnapshot
+func decodeSnapshot(r io.Reader, data interface{}) error {
+	return gob.NewDecoder(r).Decode(data)
+}
+
+// serverState State of the server kept by the default database next to its items, out of reach of commands
+// addressing keys or databases as a whole (e.g. FlushAll, DatabaseSwap)
+// It is encoded with the snapshot, so it is persisted and sent to followers on full synchronisation
+// Locks holds fencing counters of locks by name, named databases keep their own ones in their snapshots
+type serverState struct {
+	Schedule scheduleItem
+	Quotas   []Quota
+	ACLs     map[string]ACL
+	Locks    map[string]int64
+}
+
+// writeSnapshot Encodes all items consistently (no writes happen while encoding)
+// Items of the default database are followed by the other databases and the server state
+func (g *GoodiesStorage) writeSnapshot(w io.Writer) error {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	encoder := gob.NewEncoder(w)
+	if err := encoder.Encode(&g.storage); err != nil {
+		return err
+	}
+	if err := g.writeDatabases(encoder); err != nil {
+		return err
+	}
+	return encoder.Encode(&g.state)
+}
+
+// loadSnapshot Replaces all items (and databases) with the ones encoded by writeSnapshot
+// Databases are loaded in place, so their watchers are notified about every key loaded or removed
+func (g *GoodiesStorage) loadSnapshot(r io.Reader) error {
+	items := make(map[string]goodiesItem)
+	decoder := gob.NewDecoder(r)
+	if err := decoder.Decode(&items); err != nil {
+		return ErrTransformation{err.Error()}
+	}
+	named, err := readDatabases(decoder)
+	if err != nil {
+		return ErrTransformation{err.Error()}
+	}
+	// snapshots written before the server state was kept have none
+	var state serverState
+	if err := decoder.Decode(&state); err != nil && err != io.EOF {
+		return ErrTransformation{err.Error()}
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.state = state
+	g.internalReplaceItems(items)
+	if g.databases != nil {
+		g.databases.load(named)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package goodies
 
 import (
+	"context"
 	"time"
 )
 
@@ -9,6 +10,9 @@ const (
 	ExpireNever time.Duration = -1
 	//ExpireDefault Use this value to use default cache expiration
 	ExpireDefault time.Duration = -2
+
+	//DefaultCommandTimeout Limit of a client command sent without a context deadline
+	DefaultCommandTimeout = 30 * time.Second
 )
 
 // CommandProcessor generic interface implementing transport prototocol for a client
@@ -16,6 +20,12 @@ type CommandProcessor interface {
 	Process(CommandRequest, *CommandResponse) error
 }
 
+// ContextCommandProcessor transport able to abort a command once ctx is done
+type ContextCommandProcessor interface {
+	CommandProcessor
+	ProcessContext(context.Context, CommandRequest, *CommandResponse) error
+}
+
 // Provider generic client interface combining all available methods
 // ttl can be passed as usual time.Duration or as predefined constants(ExpireNever/ExpireDefault)
 type Provider interface {
@@ -36,3 +46,99 @@ type Provider interface {
 	DictHasKey(key string, dictKey string) (bool, error)
 	SetExpiry(key string, ttl time.Duration) error
 }
+
+// ContextProvider Provider variant accepting a context, implemented by clients returned from NewGoodiesClient
+// Cancelling ctx aborts the request, the server stops processing commands of aborted requests where possible
+type ContextProvider interface {
+	Provider
+
+	SetContext(ctx context.Context, key string, value string, ttl time.Duration) error
+	GetContext(ctx context.Context, key string) (string, error)
+	UpdateContext(ctx context.Context, key string, value string, ttl time.Duration) error
+	RemoveContext(ctx context.Context, key string) error
+	KeysContext(ctx context.Context) ([]string, error)
+
+	ListPushContext(ctx context.Context, key string, value string) error
+	ListLenContext(ctx context.Context, key string) (int, error)
+	ListRemoveIndexContext(ctx context.Context, key string, index int) error
+	ListRemoveValueContext(ctx context.Context, key string, value string) error
+	ListGetByIndexContext(ctx context.Context, key string, index int) (string, error)
+	DictSetContext(ctx context.Context, key string, dictKey string, value string) error
+	DictGetContext(ctx context.Context, key string, dictKey string) (string, error)
+	DictRemoveContext(ctx context.Context, key string, dictKey string) error
+	DictHasKeyContext(ctx context.Context, key string, dictKey string) (bool, error)
+	SetExpiryContext(ctx context.Context, key string, ttl time.Duration) error
+}
+
+// asContextProvider Returns provider itself if it supports contexts, otherwise wraps it ignoring contexts
+func asContextProvider(provider Provider) ContextProvider {
+	if contextProvider, ok := provider.(ContextProvider); ok {
+		return contextProvider
+	}
+	return contextlessProvider{provider}
+}
+
+// contextlessProvider Adapts local providers, their operations don't block so there is nothing to cancel
+type contextlessProvider struct {
+	Provider
+}
+
+func (p contextlessProvider) SetContext(ctx context.Context, key string, value string, ttl time.Duration) error {
+	return p.Set(key, value, ttl)
+}
+
+func (p contextlessProvider) GetContext(ctx context.Context, key string) (string, error) {
+	return p.Get(key)
+}
+
+func (p contextlessProvider) UpdateContext(ctx context.Context, key string, value string, ttl time.Duration) error {
+	return p.Update(key, value, ttl)
+}
+
+func (p contextlessProvider) RemoveContext(ctx context.Context, key string) error {
+	return p.Remove(key)
+}
+
+func (p contextlessProvider) KeysContext(ctx context.Context) ([]string, error) {
+	return p.Keys()
+}
+
+func (p contextlessProvider) ListPushContext(ctx context.Context, key string, value string) error {
+	return p.ListPush(key, value)
+}
+
+func (p contextlessProvider) ListLenContext(ctx context.Context, key string) (int, error) {
+	return p.ListLen(key)
+}
+
+func (p contextlessProvider) ListRemoveIndexContext(ctx context.Context, key string, index int) error {
+	return p.ListRemoveIndex(key, index)
+}
+
+func (p contextlessProvider) ListRemoveValueContext(ctx context.Context, key string, value string) error {
+	return p.ListRemoveValue(key, value)
+}
+
+func (p contextlessProvider) ListGetByIndexContext(ctx context.Context, key string, index int) (string, error) {
+	return p.ListGetByIndex(key, index)
+}
+
+func (p contextlessProvider) DictSetContext(ctx context.Context, key string, dictKey string, value string) error {
+	return p.DictSet(key, dictKey, value)
+}
+
+func (p contextlessProvider) DictGetContext(ctx context.Context, key string, dictKey string) (string, error) {
+	return p.DictGet(key, dictKey)
+}
+
+func (p contextlessProvider) DictRemoveContext(ctx context.Context, key string, dictKey string) error {
+	return p.DictRemove(key, dictKey)
+}
+
+func (p contextlessProvider) DictHasKeyContext(ctx context.Context, key string, dictKey string) (bool, error) {
+	return p.DictHasKey(key, dictKey)
+}
+
+func (p contextlessProvider) SetExpiryContext(ctx context.Context, key string, ttl time.Duration) error {
+	return p.SetExpiry(key, ttl)
+}
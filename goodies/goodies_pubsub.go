@@ -0,0 +1,160 @@
+package goodies
+
+import (
+	"context"
+	"path"
+	"sync"
+)
+
+// subscriptionBufferSize Amount of messages kept for a slow subscriber before new ones are dropped
+const subscriptionBufferSize = 256
+
+// Message is a single message delivered to a subscription
+// Pattern is set only for messages received through a pattern subscription
+type Message struct {
+	Channel string
+	Pattern string
+	Payload string
+}
+
+// PubSubProvider Publish/subscribe interface implemented both in-process (PubSub)
+// and by the client returned from NewGoodiesClient
+// Patterns are glob expressions with the syntax of path.Match (e.g. "invalidate:*")
+type PubSubProvider interface {
+	Publish(channel string, message string) (int, error)
+	PublishContext(ctx context.Context, channel string, message string) (int, error)
+	Subscribe(channels ...string) (*Subscription, error)
+	PatternSubscribe(patterns ...string) (*Subscription, error)
+}
+
+// Subscription Stream of messages for subscribed channels or patterns
+// Messages channel is closed once subscription is closed or its source is gone (see Err)
+type Subscription struct {
+	messages    chan Message
+	once        sync.Once
+	unsubscribe func()
+	lock        sync.Mutex
+	err         error
+}
+
+func newSubscription() *Subscription {
+	return &Subscription{messages: make(chan Message, subscriptionBufferSize)}
+}
+
+// Messages Returns channel delivering published messages
+func (s *Subscription) Messages() <-chan Message {
+	return s.messages
+}
+
+// Close Unsubscribes from all channels and patterns
+func (s *Subscription) Close() {
+	s.once.Do(s.unsubscribe)
+}
+
+// Err Returns the reason the subscription stopped if it was not closed by the caller
+func (s *Subscription) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.err
+}
+
+func (s *Subscription) setErr(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.err = err
+}
+
+// PubSub In-process registry of channel and pattern subscribers
+type PubSub struct {
+	lock        sync.RWMutex
+	subscribers map[*Subscription]*subscriber
+}
+
+type subscriber struct {
+	channels map[string]bool
+	patterns []string
+}
+
+// NewPubSub Creates an empty subscribers registry
+func NewPubSub() *PubSub {
+	return &PubSub{subscribers: make(map[*Subscription]*subscriber)}
+}
+
+// Publish Sends message to all subscribers of the channel and returns amount of receivers
+// Messages are dropped for subscribers which are not keeping up with reading
+func (ps *PubSub) Publish(channel string, message string) (int, error) {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+	received := 0
+	for subscription, sub := range ps.subscribers {
+		msg, ok := sub.match(channel)
+		if !ok {
+			continue
+		}
+		msg.Payload = message
+		select {
+		case subscription.messages <- msg:
+			received++
+		default:
+		}
+	}
+	return received, nil
+}
+
+// PublishContext Same as Publish, in-process publishing never blocks so ctx is not used
+func (ps *PubSub) PublishContext(ctx context.Context, channel string, message string) (int, error) {
+	return ps.Publish(channel, message)
+}
+
+// Subscribe Creates a subscription for the exact channel names
+func (ps *PubSub) Subscribe(channels ...string) (*Subscription, error) {
+	return ps.subscribe(channels, nil), nil
+}
+
+// PatternSubscribe Creates a subscription for all channels matching any of glob patterns
+func (ps *PubSub) PatternSubscribe(patterns ...string) (*Subscription, error) {
+	if err := validatePatterns(patterns); err != nil {
+		return nil, err
+	}
+	return ps.subscribe(nil, patterns), nil
+}
+
+func validatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return ErrCommandArgumentsMismatch{"Malformed subscription pattern: " + pattern}
+		}
+	}
+	return nil
+}
+
+func (ps *PubSub) subscribe(channels []string, patterns []string) *Subscription {
+	sub := &subscriber{channels: make(map[string]bool, len(channels)), patterns: patterns}
+	for _, channel := range channels {
+		sub.channels[channel] = true
+	}
+	subscription := newSubscription()
+	subscription.unsubscribe = func() {
+		ps.lock.Lock()
+		defer ps.lock.Unlock()
+		delete(ps.subscribers, subscription)
+		close(subscription.messages)
+	}
+
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	ps.subscribers[subscription] = sub
+	return subscription
+}
+
+func (sub *subscriber) match(channel string) (Message, bool) {
+	if sub.channels[channel] {
+		return Message{Channel: channel}, true
+	}
+	for _, pattern := range sub.patterns {
+		if ok, _ := path.Match(pattern, channel); ok {
+			return Message{Channel: channel, Pattern: pattern}, true
+		}
+	}
+	return Message{}, false
+}
@@ -0,0 +1,73 @@
+package goodies
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func receiveMessage(testing *testing.T, subscription *Subscription) Message {
+	select {
+	case msg := <-subscription.Messages():
+		return msg
+	case <-time.After(time.Second):
+		testing.Fatal("Message was not delivered")
+	}
+	return Message{}
+}
+
+func TestPubSubInProcess(testing *testing.T) {
+	pubsub := NewPubSub()
+	exact, _ := pubsub.Subscribe("news")
+	pattern, err := pubsub.PatternSubscribe("invalidate:*")
+	if err != nil {
+		testing.Fatalf("Unexpected error on pattern subscribe: %v", err)
+	}
+
+	if received, _ := pubsub.Publish("news", "hello"); received != 1 {
+		testing.Errorf("Expected single receiver but message was received by %v", received)
+	}
+	if msg := receiveMessage(testing, exact); msg.Channel != "news" || msg.Payload != "hello" {
+		testing.Errorf("Unexpected message received: %v", msg)
+	}
+	pubsub.Publish("invalidate:user", "42")
+	if msg := receiveMessage(testing, pattern); msg.Pattern != "invalidate:*" || msg.Payload != "42" {
+		testing.Errorf("Unexpected pattern message received: %v", msg)
+	}
+
+	exact.Close()
+	if _, open := <-exact.Messages(); open {
+		testing.Error("Messages channel is expected to be closed after unsubscribe")
+	}
+	if received, _ := pubsub.Publish("news", "nobody listens"); received != 0 {
+		testing.Errorf("Closed subscription still receives messages")
+	}
+	if _, err := pubsub.PatternSubscribe("[broken"); err == nil {
+		testing.Error("Malformed pattern is expected to be rejected")
+	}
+}
+
+func TestPubSubOverHTTP(testing *testing.T) {
+	server := httptest.NewServer(newGoodiesHTTPHandler(NewGoodiesStorage(ExpireNever)))
+	defer server.Close()
+	client := NewGoodiesClient(server.URL).(PubSubProvider)
+
+	subscription, err := client.PatternSubscribe("cache:*")
+	if err != nil {
+		testing.Fatalf("Unexpected error on subscribe: %v", err)
+	}
+	received, err := client.Publish("cache:feature-flags", "changed")
+	if err != nil || received != 1 {
+		testing.Fatalf("Publish failed: %v, received by %v", err, received)
+	}
+	if msg := receiveMessage(testing, subscription); msg.Channel != "cache:feature-flags" || msg.Payload != "changed" {
+		testing.Errorf("Unexpected message received: %v", msg)
+	}
+
+	subscription.Close()
+	for range subscription.Messages() {
+	}
+	if subscription.Err() != nil {
+		testing.Errorf("Closed subscription reports an error: %v", subscription.Err())
+	}
+}
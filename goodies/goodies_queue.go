@@ -0,0 +1,457 @@
+package goodies
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// DeadLetterSuffix Suffix of the queue receiving jobs which ran out of attempts
+	DeadLetterSuffix = ":dead"
+	// DefaultQueueMaxAttempts Deliveries of a job before it is dead-lettered, unless configured otherwise
+	DefaultQueueMaxAttempts = 5
+)
+
+func init() {
+	gob.Register(queueItem{})
+}
+
+// QueueJob A job delivered to a worker, Attempts includes the current delivery
+type QueueJob struct {
+	ID       string
+	Payload  string
+	Attempts int
+}
+
+// QueueStats Sizes of a queue, Delayed jobs are not visible yet and InFlight jobs wait for ack
+type QueueStats struct {
+	Ready       int
+	Delayed     int
+	InFlight    int
+	Dead        int
+	MaxAttempts int
+}
+
+// QueueProvider Reliable queue interface implemented by GoodiesStorage and the client returned from NewGoodiesClient
+// A dequeued job stays in flight until it is acked, jobs not acked within the visibility timeout are delivered again.
+// Jobs delivered MaxAttempts times are moved to the queue named queue+DeadLetterSuffix, in cluster mode
+// queue names should be hashtags (e.g. "{jobs}") so the dead letter queue lives in the same slot
+type QueueProvider interface {
+	// Enqueue Adds a job visible after delay, returns its id
+	Enqueue(queue string, payload string, delay time.Duration) (string, error)
+	// Dequeue Takes the oldest visible job for visibility timeout, found is false if there is none
+	Dequeue(queue string, visibility time.Duration) (job QueueJob, found bool, err error)
+	// Ack Removes an in-flight job, returns ErrNotFound if it is not in flight (e.g. it was redelivered)
+	Ack(queue string, id string) error
+	// Nack Returns an in-flight job to the queue visible after delay (or dead-letters it)
+	Nack(queue string, id string, delay time.Duration) error
+	// SetQueueMaxAttempts Sets deliveries of a job before it is dead-lettered
+	SetQueueMaxAttempts(queue string, maxAttempts int) error
+	// QueueStats Returns sizes of the queue
+	QueueStats(queue string) (QueueStats, error)
+}
+
+// queueJob Stored job, VisibleAt is the time it can be delivered (or redelivered if it is in flight)
+type queueJob struct {
+	ID        string
+	Payload   string
+	Attempts  int
+	VisibleAt int64
+}
+
+// queueItem Stored state of a queue, Jobs are kept in enqueue order
+type queueItem struct {
+	Jobs        []queueJob
+	InFlight    map[string]queueJob
+	NextID      int64
+	MaxAttempts int
+}
+
+func newQueueItem() queueItem {
+	return queueItem{InFlight: make(map[string]queueJob), MaxAttempts: DefaultQueueMaxAttempts}
+}
+
+// internalGetQueue Returns queue state, empty queue if it doesn't exist
+// Jobs and InFlight are shared with the stored item, so they are modified only under write lock and the state
+// is stored back by internalStoreQueue
+func (g *GoodiesStorage) internalGetQueue(queue string) (queueItem, error) {
+	value, found := g.internalGet(queue)
+	if !found {
+		return newQueueItem(), nil
+	}
+	state, ok := value.(queueItem)
+	if !ok {
+		return queueItem{}, ErrTypeMismatch{fmt.Sprintf("Item %v is not a queue", queue)}
+	}
+	return state, nil
+}
+
+// internalRedeliver Returns in-flight jobs past their visibility timeout to the queue
+func (g *GoodiesStorage) internalRedeliver(queue string, state *queueItem, now int64) error {
+	// checked before any job is moved so the state is never left half modified
+	if _, err := g.internalGetQueue(queue + DeadLetterSuffix); err != nil {
+		return err
+	}
+	for id, job := range state.InFlight {
+		if job.VisibleAt <= now {
+			delete(state.InFlight, id)
+			if err := g.internalRequeue(queue, state, job, now); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// internalRequeue Puts the job back visible at now, or moves it to the dead letter queue
+func (g *GoodiesStorage) internalRequeue(queue string, state *queueItem, job queueJob, visibleAt int64) error {
+	if job.Attempts < state.MaxAttempts {
+		job.VisibleAt = visibleAt
+		state.Jobs = append(state.Jobs, job)
+		return nil
+	}
+	dead, err := g.internalGetQueue(queue + DeadLetterSuffix)
+	if err != nil {
+		return err
+	}
+	job.VisibleAt = 0
+	dead.Jobs = append(dead.Jobs, job)
+	g.storage[queue+DeadLetterSuffix] = newItemWithExpiry(dead, 0)
+	g.emit(KeyUpdated, queue+DeadLetterSuffix)
+	return nil
+}
+
+func (g *GoodiesStorage) internalStoreQueue(queue string, state queueItem) {
+	g.storage[queue] = newItemWithExpiry(state, 0)
+	g.emit(KeyUpdated, queue)
+}
+
+func (g *GoodiesStorage) Enqueue(queue string, payload string, delay time.Duration) (string, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.internalExpire(queue)
+	state, err := g.internalGetQueue(queue)
+	if err != nil {
+		return "", err
+	}
+	state.NextID++
+	id := strconv.FormatInt(state.NextID, 10)
+	state.Jobs = append(state.Jobs, queueJob{ID: id, Payload: payload, VisibleAt: time.Now().Add(delay).UnixNano()})
+	g.internalStoreQueue(queue, state)
+	return id, nil
+}
+
+func (g *GoodiesStorage) Dequeue(queue string, visibility time.Duration) (QueueJob, bool, error) {
+	if visibility <= 0 {
+		return QueueJob{}, false, ErrCommandArgumentsMismatch{"Visibility timeout is expected to be positive"}
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.internalExpire(queue)
+	if _, found := g.internalGet(queue); !found {
+		return QueueJob{}, false, nil
+	}
+	state, err := g.internalGetQueue(queue)
+	if err != nil {
+		return QueueJob{}, false, err
+	}
+	now := time.Now().UnixNano()
+	inFlight := len(state.InFlight)
+	if err := g.internalRedeliver(queue, &state, now); err != nil {
+		return QueueJob{}, false, err
+	}
+	next := -1
+	for i, job := range state.Jobs {
+		if job.VisibleAt <= now && (next < 0 || job.VisibleAt < state.Jobs[next].VisibleAt) {
+			next = i
+		}
+	}
+	if next < 0 {
+		if len(state.InFlight) != inFlight {
+			g.internalStoreQueue(queue, state)
+		}
+		return QueueJob{}, false, nil
+	}
+	job := state.Jobs[next]
+	state.Jobs = append(state.Jobs[:next], state.Jobs[next+1:]...)
+	job.Attempts++
+	job.VisibleAt = now + int64(visibility)
+	state.InFlight[job.ID] = job
+	g.internalStoreQueue(queue, state)
+	return QueueJob{ID: job.ID, Payload: job.Payload, Attempts: job.Attempts}, true, nil
+}
+
+func (g *GoodiesStorage) Ack(queue string, id string) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	state, err := g.internalGetQueue(queue)
+	if err != nil {
+		return err
+	}
+	job, found := state.InFlight[id]
+	if !found || job.VisibleAt <= time.Now().UnixNano() {
+		return ErrNotFound{fmt.Sprintf("%v job %v", queue, id)}
+	}
+	delete(state.InFlight, id)
+	g.internalStoreQueue(queue, state)
+	return nil
+}
+
+func (g *GoodiesStorage) Nack(queue string, id string, delay time.Duration) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	state, err := g.internalGetQueue(queue)
+	if err != nil {
+		return err
+	}
+	job, found := state.InFlight[id]
+	now := time.Now().UnixNano()
+	if !found || job.VisibleAt <= now {
+		return ErrNotFound{fmt.Sprintf("%v job %v", queue, id)}
+	}
+	if _, err := g.internalGetQueue(queue + DeadLetterSuffix); err != nil {
+		return err
+	}
+	delete(state.InFlight, id)
+	if err := g.internalRequeue(queue, &state, job, now+int64(delay)); err != nil {
+		return err
+	}
+	g.internalStoreQueue(queue, state)
+	return nil
+}
+
+func (g *GoodiesStorage) SetQueueMaxAttempts(queue string, maxAttempts int) error {
+	if maxAttempts < 1 {
+		return ErrCommandArgumentsMismatch{"Max attempts are expected to be positive"}
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.internalExpire(queue)
+	state, err := g.internalGetQueue(queue)
+	if err != nil {
+		return err
+	}
+	state.MaxAttempts = maxAttempts
+	g.internalStoreQueue(queue, state)
+	return nil
+}
+
+func (g *GoodiesStorage) QueueStats(queue string) (QueueStats, error) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	state, err := g.internalGetQueue(queue)
+	if err != nil {
+		return QueueStats{}, err
+	}
+	dead, err := g.internalGetQueue(queue + DeadLetterSuffix)
+	if err != nil {
+		return QueueStats{}, err
+	}
+	now := time.Now().UnixNano()
+	stats := QueueStats{Dead: len(dead.Jobs), MaxAttempts: state.MaxAttempts}
+	for _, job := range state.Jobs {
+		if job.VisibleAt <= now {
+			stats.Ready++
+		} else {
+			stats.Delayed++
+		}
+	}
+	// jobs past visibility timeout are counted as in flight until the next dequeue returns them
+	stats.InFlight = len(state.InFlight)
+	return stats, nil
+}
+
+// parseQueueDuration Parses delays and visibility timeouts sent in milliseconds
+func parseQueueDuration(s string) (time.Duration, error) {
+	millis, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || millis < 0 {
+		return 0, ErrCommandArgumentsMismatch{"Queue durations are expected to be non-negative integers (milliseconds)"}
+	}
+	return time.Duration(millis) * time.Millisecond, nil
+}
+
+func queueDurationAsString(d time.Duration) string {
+	return strconv.FormatInt(d.Milliseconds(), 10)
+}
+
+func queueEnqueueCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 3 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"QueueEnqueue command is expected to have 3 arguments (queue, payload, delay(INT MILLISECONDS))"})
+	}
+	queues, ok := storage.(QueueProvider)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support queues"})
+	}
+	delay, err := parseQueueDuration(command.Parameters[2])
+	if err != nil {
+		return createErrorResult(err)
+	}
+	id, err := queues.Enqueue(command.Parameters[0], command.Parameters[1], delay)
+	if err != nil {
+		return createErrorResult(err)
+	}
+	return createOkResult(id)
+}
+
+func queueDequeueCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 2 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"QueueDequeue command is expected to have 2 arguments (queue, visibility(INT MILLISECONDS))"})
+	}
+	queues, ok := storage.(QueueProvider)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support queues"})
+	}
+	visibility, err := parseQueueDuration(command.Parameters[1])
+	if err != nil {
+		return createErrorResult(err)
+	}
+	job, found, err := queues.Dequeue(command.Parameters[0], visibility)
+	if err != nil {
+		return createErrorResult(err)
+	}
+	if !found {
+		return createOkResult("")
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return createErrorResult(ErrTransformation{err.Error()})
+	}
+	return createOkResult(string(data))
+}
+
+func queueAckCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 2 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"QueueAck command is expected to have 2 arguments (queue, id)"})
+	}
+	queues, ok := storage.(QueueProvider)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support queues"})
+	}
+	if err := queues.Ack(command.Parameters[0], command.Parameters[1]); err != nil {
+		return createErrorResult(err)
+	}
+	return createOkResult("")
+}
+
+func queueNackCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 3 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"QueueNack command is expected to have 3 arguments (queue, id, delay(INT MILLISECONDS))"})
+	}
+	queues, ok := storage.(QueueProvider)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support queues"})
+	}
+	delay, err := parseQueueDuration(command.Parameters[2])
+	if err != nil {
+		return createErrorResult(err)
+	}
+	if err := queues.Nack(command.Parameters[0], command.Parameters[1], delay); err != nil {
+		return createErrorResult(err)
+	}
+	return createOkResult("")
+}
+
+func queueMaxAttemptsCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 2 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"QueueMaxAttempts command is expected to have 2 arguments (queue, maxAttempts(INT))"})
+	}
+	queues, ok := storage.(QueueProvider)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support queues"})
+	}
+	maxAttempts, err := strconv.Atoi(command.Parameters[1])
+	if err != nil {
+		return createErrorResult(ErrCommandArgumentsMismatch{"QueueMaxAttempts maxAttempts is expected to be an integer"})
+	}
+	if err := queues.SetQueueMaxAttempts(command.Parameters[0], maxAttempts); err != nil {
+		return createErrorResult(err)
+	}
+	return createOkResult("")
+}
+
+func queueStatsCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 1 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"QueueStats command is expected to have 1 argument (queue)"})
+	}
+	queues, ok := storage.(QueueProvider)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support queues"})
+	}
+	stats, err := queues.QueueStats(command.Parameters[0])
+	if err != nil {
+		return createErrorResult(err)
+	}
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return createErrorResult(ErrTransformation{err.Error()})
+	}
+	return createOkResult(string(data))
+}
+
+func (c goodiesClient) Enqueue(queue string, payload string, delay time.Duration) (string, error) {
+	req := CommandRequest{Name: "QueueEnqueue", Parameters: []string{queue, payload, queueDurationAsString(delay)}}
+	res := internalProcess(req, c)
+	if !res.Success {
+		return "", res.Err
+	}
+	return res.Result, nil
+}
+
+func (c goodiesClient) Dequeue(queue string, visibility time.Duration) (QueueJob, bool, error) {
+	req := CommandRequest{Name: "QueueDequeue", Parameters: []string{queue, queueDurationAsString(visibility)}}
+	res := internalProcess(req, c)
+	if !res.Success {
+		return QueueJob{}, false, res.Err
+	}
+	if res.Result == "" {
+		return QueueJob{}, false, nil
+	}
+	var job QueueJob
+	if err := json.Unmarshal([]byte(res.Result), &job); err != nil {
+		return QueueJob{}, false, ErrTransformation{err.Error()}
+	}
+	return job, true, nil
+}
+
+func (c goodiesClient) Ack(queue string, id string) error {
+	req := CommandRequest{Name: "QueueAck", Parameters: []string{queue, id}}
+	res := internalProcess(req, c)
+	if !res.Success {
+		return res.Err
+	}
+	return nil
+}
+
+func (c goodiesClient) Nack(queue string, id string, delay time.Duration) error {
+	req := CommandRequest{Name: "QueueNack", Parameters: []string{queue, id, queueDurationAsString(delay)}}
+	res := internalProcess(req, c)
+	if !res.Success {
+		return res.Err
+	}
+	return nil
+}
+
+func (c goodiesClient) SetQueueMaxAttempts(queue string, maxAttempts int) error {
+	req := CommandRequest{Name: "QueueMaxAttempts", Parameters: []string{queue, strconv.Itoa(maxAttempts)}}
+	res := internalProcess(req, c)
+	if !res.Success {
+		return res.Err
+	}
+	return nil
+}
+
+func (c goodiesClient) QueueStats(queue string) (QueueStats, error) {
+	req := CommandRequest{Name: "QueueStats", Parameters: []string{queue}}
+	res := internalProcess(req, c)
+	if !res.Success {
+		return QueueStats{}, res.Err
+	}
+	var stats QueueStats
+	if err := json.Unmarshal([]byte(res.Result), &stats); err != nil {
+		return QueueStats{}, ErrTransformation{err.Error()}
+	}
+	return stats, nil
+}
@@ -0,0 +1,89 @@
+package goodies
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStorageQueue(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	if _, found, err := storage.Dequeue("jobs", time.Second); found || err != nil {
+		testing.Errorf("Missing queue is expected to be empty: %v %v", found, err)
+	}
+	first, _ := storage.Enqueue("jobs", "first", 0)
+	storage.Enqueue("jobs", "delayed", time.Hour)
+	storage.Enqueue("jobs", "second", 0)
+	if stats, _ := storage.QueueStats("jobs"); stats != (QueueStats{Ready: 2, Delayed: 1, MaxAttempts: DefaultQueueMaxAttempts}) {
+		testing.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	job, found, err := storage.Dequeue("jobs", time.Minute)
+	if err != nil || !found || job.ID != first || job.Payload != "first" || job.Attempts != 1 {
+		testing.Fatalf("Unexpected dequeued job: %+v %v %v", job, found, err)
+	}
+	if err := storage.Ack("jobs", job.ID); err != nil {
+		testing.Errorf("Unexpected error on ack: %v", err)
+	}
+	if _, notFound := storage.Ack("jobs", job.ID).(ErrNotFound); !notFound {
+		testing.Error("Acked job is not expected to be acked again")
+	}
+
+	job, _, _ = storage.Dequeue("jobs", time.Minute)
+	storage.Nack("jobs", job.ID, 0)
+	if again, _, _ := storage.Dequeue("jobs", time.Minute); again.ID != job.ID || again.Attempts != 2 {
+		testing.Errorf("Nacked job is expected to be delivered again: %+v", again)
+	}
+	if _, found, _ := storage.Dequeue("jobs", time.Minute); found {
+		testing.Error("Delayed job is not expected to be delivered")
+	}
+	if stats, _ := storage.QueueStats("jobs"); stats.InFlight != 1 || stats.Delayed != 1 {
+		testing.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	// queues are persisted with the snapshot
+	var snapshot bytes.Buffer
+	storage.writeSnapshot(&snapshot)
+	restored := NewGoodiesStorage(ExpireNever)
+	if err := restored.loadSnapshot(&snapshot); err != nil {
+		testing.Fatalf("Unexpected error on snapshot load: %v", err)
+	}
+	if stats, _ := restored.QueueStats("jobs"); stats.InFlight != 1 || stats.Delayed != 1 {
+		testing.Errorf("Queue is expected to survive restore: %+v", stats)
+	}
+}
+
+func TestQueueRedeliveryAndDeadLetter(testing *testing.T) {
+	server := httptest.NewServer(newGoodiesHTTPHandler(NewGoodiesStorage(ExpireNever)))
+	defer server.Close()
+	queues := NewGoodiesClient(server.URL).(QueueProvider)
+	if err := queues.SetQueueMaxAttempts("jobs", 2); err != nil {
+		testing.Fatalf("Unexpected error on configuration: %v", err)
+	}
+	id, err := queues.Enqueue("jobs", "payload", 0)
+	if err != nil {
+		testing.Fatalf("Unexpected error on enqueue: %v", err)
+	}
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		job, found, err := queues.Dequeue("jobs", 20*time.Millisecond)
+		if err != nil || !found || job.ID != id || job.Attempts != attempt {
+			testing.Fatalf("Job is expected to be delivered again after visibility timeout: %+v %v %v", job, found, err)
+		}
+		time.Sleep(30 * time.Millisecond)
+		if _, notFound := queues.Ack("jobs", id).(ErrNotFound); !notFound {
+			testing.Error("Job past visibility timeout is not expected to be acked")
+		}
+	}
+	if _, found, _ := queues.Dequeue("jobs", time.Second); found {
+		testing.Error("Job out of attempts is not expected to be delivered")
+	}
+	stats, err := queues.QueueStats("jobs")
+	if err != nil || stats != (QueueStats{Dead: 1, MaxAttempts: 2}) {
+		testing.Errorf("Unexpected stats: %+v %v", stats, err)
+	}
+	if dead, found, _ := queues.Dequeue("jobs"+DeadLetterSuffix, time.Second); !found || dead.Payload != "payload" {
+		testing.Errorf("Job is expected in the dead letter queue: %+v", dead)
+	}
+}
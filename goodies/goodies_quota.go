@@ -0,0 +1,441 @@
+package goodies
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Quota Limits of a namespace, the keys of Database starting with Prefix (empty prefix limits the whole database)
+// Zero limits are not enforced. Writes of new keys are rejected once MaxKeys is reached and writes of
+// any key once MaxBytes is reached, removals are always allowed. MaxOpsPerSecond counts commands of any
+// kind addressing a key of the namespace
+type Quota struct {
+	Database        string
+	Prefix          string
+	MaxKeys         int
+	MaxBytes        int64
+	MaxOpsPerSecond int
+}
+
+// QuotaUsage Quota with resources used by its namespace, Ops are the commands of the current second
+type QuotaUsage struct {
+	Quota
+	Keys  int
+	Bytes int64
+	Ops   int
+}
+
+// QuotaProvider Quota management interface implemented by the client returned from NewGoodiesClient
+type QuotaProvider interface {
+	// SetQuota Creates or replaces the quota of the namespace
+	SetQuota(quota Quota) error
+	// RemoveQuota Removes the quota of the namespace, returns ErrNotFound if there is none
+	RemoveQuota(database string, prefix string) error
+	// Quotas Returns all quotas with current usage
+	Quotas() ([]QuotaUsage, error)
+}
+
+// releasingCommands Keyed writes which only free resources, these are not rejected by keys and bytes limits
+var releasingCommands = map[string]bool{
+	"Remove":          true,
+	"ListRemoveIndex": true,
+	"ListRemoveValue": true,
+	"DictRemove":      true,
+	"SetExpiry":       true,
+	"LockRelease":     true,
+	"QueueAck":        true,
+}
+
+// quotaStore is implemented by storages keeping quota definitions
+type quotaStore interface {
+	setQuota(quota Quota) error
+	removeQuota(database string, prefix string) error
+	listQuotas() []Quota
+}
+
+// sizeObservable is implemented by storages reporting sizes of items as they change
+type sizeObservable interface {
+	// observeSizes Reports sizes of existing keys with the prefix and then every change of them (exists is false
+	// once a key is gone) until cancelled, update is called under storage write lock so it must not call the storage
+	observeSizes(prefix string, update func(key string, size int64, exists bool)) (cancel func())
+}
+
+func normaliseDatabase(name string) string {
+	if name == "" {
+		return DefaultDatabase
+	}
+	return name
+}
+
+func (g *GoodiesStorage) listQuotas() []Quota {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	// quotas are replaced as a whole, never modified in place
+	return g.state.Quotas
+}
+
+func (g *GoodiesStorage) setQuota(quota Quota) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	replaced := make([]Quota, 0, len(g.state.Quotas)+1)
+	for _, existing := range g.state.Quotas {
+		if existing.Database != quota.Database || existing.Prefix != quota.Prefix {
+			replaced = append(replaced, existing)
+		}
+	}
+	g.state.Quotas = append(replaced, quota)
+	return nil
+}
+
+func (g *GoodiesStorage) removeQuota(database string, prefix string) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	remaining := make([]Quota, 0, len(g.state.Quotas))
+	for _, existing := range g.state.Quotas {
+		if existing.Database != database || existing.Prefix != prefix {
+			remaining = append(remaining, existing)
+		}
+	}
+	if len(remaining) == len(g.state.Quotas) {
+		return ErrNotFound{fmt.Sprintf("quota of %v:%v*", database, prefix)}
+	}
+	g.state.Quotas = remaining
+	return nil
+}
+
+// itemValueSize Estimates memory used by an item value
+func itemValueSize(value interface{}) int64 {
+	switch typed := value.(type) {
+	case string:
+		return int64(len(typed))
+	case []string:
+		var size int64
+		for _, element := range typed {
+			size += int64(len(element))
+		}
+		return size
+	case map[string]string:
+		var size int64
+		for key, element := range typed {
+			size += int64(len(key) + len(element))
+		}
+		return size
+	}
+	// structured items (queues, locks, limiters) are rare enough to be measured by their encoding
+	data, _ := json.Marshal(value)
+	return int64(len(data))
+}
+
+// sizeObserver Receives sizes of the keys with the prefix, see sizeObservable
+type sizeObserver struct {
+	prefix string
+	update func(key string, size int64, exists bool)
+}
+
+func (g *GoodiesStorage) observeSizes(prefix string, update func(key string, size int64, exists bool)) func() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	observer := &sizeObserver{prefix, update}
+	if g.observers == nil {
+		g.observers = make(map[*sizeObserver]bool)
+	}
+	g.observers[observer] = true
+	for key, item := range g.storage {
+		if strings.HasPrefix(key, prefix) && !checkExpiry(item.Expiry) {
+			update(key, int64(len(key))+itemValueSize(item.Value), true)
+		}
+	}
+	return func() {
+		g.lock.Lock()
+		defer g.lock.Unlock()
+		delete(g.observers, observer)
+	}
+}
+
+// notifyObservers Reports the current size of the changed key, must be called under write lock
+func (g *GoodiesStorage) notifyObservers(key string) {
+	if len(g.observers) == 0 {
+		return
+	}
+	item, exists := g.storage[key]
+	size := int64(-1)
+	for observer := range g.observers {
+		if !strings.HasPrefix(key, observer.prefix) {
+			continue
+		}
+		if exists && size < 0 {
+			size = int64(len(key)) + itemValueSize(item.Value)
+		}
+		observer.update(key, size, exists)
+	}
+}
+
+// quotaNamespace Identifies usage of a quota
+type quotaNamespace struct {
+	database string
+	prefix   string
+}
+
+// namespaceUsage Resources used by a namespace, sizes are kept up to date by the observed storage
+// lock is taken by the storage reporting sizes, so it is never held while calling the storage
+type namespaceUsage struct {
+	lock    sync.Mutex
+	storage Provider
+	cancel  func()
+	sizes   map[string]int64
+	bytes   int64
+	second  int64
+	ops     int
+}
+
+func (u *namespaceUsage) set(key string, size int64, exists bool) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.bytes -= u.sizes[key]
+	if exists {
+		u.sizes[key] = size
+		u.bytes += size
+	} else {
+		delete(u.sizes, key)
+	}
+}
+
+// quotas Enforces quotas of the command processor, lock guards usage map only
+type quotas struct {
+	lock  sync.Mutex
+	usage map[quotaNamespace]*namespaceUsage
+}
+
+func newQuotas() *quotas {
+	return &quotas{usage: make(map[quotaNamespace]*namespaceUsage)}
+}
+
+// namespace Returns usage of the quota, starting to observe the storage unless it is observed already
+// Storages not reporting sizes are limited by MaxOpsPerSecond only
+func (q *quotas) namespace(quota Quota, storage Provider) *namespaceUsage {
+	namespace := quotaNamespace{quota.Database, quota.Prefix}
+	q.lock.Lock()
+	usage, found := q.usage[namespace]
+	q.lock.Unlock()
+	if found && usage.storage == storage {
+		return usage
+	}
+	observed := &namespaceUsage{storage: storage, cancel: func() {}, sizes: make(map[string]int64)}
+	if observable, ok := storage.(sizeObservable); ok {
+		observed.cancel = observable.observeSizes(quota.Prefix, observed.set)
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if usage, found := q.usage[namespace]; found {
+		if usage.storage == storage {
+			// observed concurrently
+			observed.cancel()
+			return usage
+		}
+		usage.cancel()
+	}
+	q.usage[namespace] = observed
+	return observed
+}
+
+// reset Stops observing the namespace, e.g. once its quota changed
+func (q *quotas) reset(database string, prefix string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if usage, found := q.usage[quotaNamespace{database, prefix}]; found {
+		usage.cancel()
+		delete(q.usage, quotaNamespace{database, prefix})
+	}
+}
+
+// matching Returns quotas of the namespaces the key of the command belongs to
+func matchingQuotas(definitions []Quota, req CommandRequest) []Quota {
+	if len(definitions) == 0 || !keyedCommands[req.Name] || len(req.Parameters) == 0 {
+		return nil
+	}
+	var matching []Quota
+	database := normaliseDatabase(req.Database)
+	for _, quota := range definitions {
+		if normaliseDatabase(quota.Database) == database && strings.HasPrefix(req.Parameters[0], quota.Prefix) {
+			matching = append(matching, quota)
+		}
+	}
+	return matching
+}
+
+// check Returns ErrQuotaExceeded if the command doesn't fit any of the quotas, otherwise counts the operation
+func (q *quotas) check(matching []Quota, req CommandRequest, storage Provider) error {
+	if len(matching) == 0 {
+		return nil
+	}
+	key := req.Parameters[0]
+	growing := mutatingCommands[req.Name] && !releasingCommands[req.Name]
+	// usages are observed before any is locked, as observing calls the storage
+	usages := make([]*namespaceUsage, len(matching))
+	for i, quota := range matching {
+		usages[i] = q.namespace(quota, storage)
+	}
+	for i, quota := range matching {
+		usage := usages[i]
+		usage.lock.Lock()
+		defer usage.lock.Unlock()
+		if second := time.Now().Unix(); second != usage.second {
+			usage.second, usage.ops = second, 0
+		}
+		if quota.MaxOpsPerSecond > 0 && usage.ops >= quota.MaxOpsPerSecond {
+			return ErrQuotaExceeded{fmt.Sprintf("%v:%v* exceeds %v ops/sec", normaliseDatabase(quota.Database), quota.Prefix, quota.MaxOpsPerSecond)}
+		}
+		if !growing {
+			continue
+		}
+		current, counted := usage.sizes[key]
+		if quota.MaxKeys > 0 && !counted && len(usage.sizes) >= quota.MaxKeys {
+			return ErrQuotaExceeded{fmt.Sprintf("%v:%v* exceeds %v keys", normaliseDatabase(quota.Database), quota.Prefix, quota.MaxKeys)}
+		}
+		if quota.MaxBytes > 0 && usage.bytes-current+writtenSize(req, current, counted) > quota.MaxBytes {
+			return ErrQuotaExceeded{fmt.Sprintf("%v:%v* exceeds %v bytes", normaliseDatabase(quota.Database), quota.Prefix, quota.MaxBytes)}
+		}
+	}
+	for _, usage := range usages {
+		usage.ops++
+	}
+	return nil
+}
+
+// writtenSize Estimates the size of the key once written by the command, current is its size if it is counted
+func writtenSize(req CommandRequest, current int64, counted bool) int64 {
+	key := req.Parameters[0]
+	if req.Name == "Set" || req.Name == "Update" {
+		if len(req.Parameters) < 2 {
+			return current
+		}
+		return int64(len(key) + len(req.Parameters[1]))
+	}
+	if !counted {
+		current = int64(len(key))
+	}
+	// values (list elements, dictionary keys and values, payloads) are added to the item
+	switch req.Name {
+	case "ListPush", "QueueEnqueue":
+		if len(req.Parameters) > 1 {
+			return current + int64(len(req.Parameters[1]))
+		}
+	case "DictSet":
+		if len(req.Parameters) > 2 {
+			return current + int64(len(req.Parameters[1])+len(req.Parameters[2]))
+		}
+	}
+	return current
+}
+
+// quotaDefinitions Returns quotas stored in the default database
+func (gcp *goodiesCommandProcessor) quotaDefinitions() []Quota {
+	store, ok := gcp.storage.(quotaStore)
+	if !ok {
+		return nil
+	}
+	return store.listQuotas()
+}
+
+func (gcp *goodiesCommandProcessor) quotaSetCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 1 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"QuotaSet command is expected to have 1 argument (quota(JSON))"})
+	}
+	store, ok := storage.(quotaStore)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support quotas"})
+	}
+	var quota Quota
+	if err := json.Unmarshal([]byte(command.Parameters[0]), &quota); err != nil {
+		return createErrorResult(ErrCommandArgumentsMismatch{fmt.Sprintf("QuotaSet quota is not valid: %v", err)})
+	}
+	if quota.MaxKeys < 0 || quota.MaxBytes < 0 || quota.MaxOpsPerSecond < 0 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"Quota limits cannot be negative"})
+	}
+	quota.Database = normaliseDatabase(quota.Database)
+	if err := store.setQuota(quota); err != nil {
+		return createErrorResult(err)
+	}
+	gcp.quotas.reset(quota.Database, quota.Prefix)
+	return createOkResult("")
+}
+
+func (gcp *goodiesCommandProcessor) quotaRemoveCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 2 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"QuotaRemove command is expected to have 2 arguments (database, prefix)"})
+	}
+	store, ok := storage.(quotaStore)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support quotas"})
+	}
+	database := normaliseDatabase(command.Parameters[0])
+	if err := store.removeQuota(database, command.Parameters[1]); err != nil {
+		return createErrorResult(err)
+	}
+	gcp.quotas.reset(database, command.Parameters[1])
+	return createOkResult("")
+}
+
+func (gcp *goodiesCommandProcessor) quotaUsageCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 0 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"QuotaUsage command is expected to have no arguments"})
+	}
+	definitions := gcp.quotaDefinitions()
+	usages := make([]QuotaUsage, 0, len(definitions))
+	for _, quota := range definitions {
+		database, err := gcp.database(CommandRequest{Database: quota.Database})
+		if err != nil {
+			// quota of a database which doesn't exist (yet) has nothing to count
+			usages = append(usages, QuotaUsage{Quota: quota})
+			continue
+		}
+		usage := gcp.quotas.namespace(quota, database)
+		usage.lock.Lock()
+		ops := usage.ops
+		if usage.second != time.Now().Unix() {
+			ops = 0
+		}
+		usages = append(usages, QuotaUsage{Quota: quota, Keys: len(usage.sizes), Bytes: usage.bytes, Ops: ops})
+		usage.lock.Unlock()
+	}
+	data, err := json.Marshal(usages)
+	if err != nil {
+		return createErrorResult(ErrTransformation{err.Error()})
+	}
+	return createOkResult(string(data))
+}
+
+func (c goodiesClient) SetQuota(quota Quota) error {
+	data, err := json.Marshal(quota)
+	if err != nil {
+		return ErrTransformation{err.Error()}
+	}
+	res := internalProcess(CommandRequest{Name: "QuotaSet", Parameters: []string{string(data)}}, c)
+	if !res.Success {
+		return res.Err
+	}
+	return nil
+}
+
+func (c goodiesClient) RemoveQuota(database string, prefix string) error {
+	res := internalProcess(CommandRequest{Name: "QuotaRemove", Parameters: []string{database, prefix}}, c)
+	if !res.Success {
+		return res.Err
+	}
+	return nil
+}
+
+func (c goodiesClient) Quotas() ([]QuotaUsage, error) {
+	res := internalProcess(CommandRequest{Name: "QuotaUsage"}, c)
+	if !res.Success {
+		return nil, res.Err
+	}
+	var usages []QuotaUsage
+	if err := json.Unmarshal([]byte(res.Result), &usages); err != nil {
+		return nil, ErrTransformation{err.Error()}
+	}
+	return usages, nil
+}
@@ -0,0 +1,153 @@
+package goodies
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuotaKeysAndBytes(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	server := httptest.NewServer(newGoodiesHTTPHandler(storage))
+	defer server.Close()
+	client := NewGoodiesClient(server.URL)
+	quotas := client.(QuotaProvider)
+	if err := quotas.SetQuota(Quota{Prefix: "tenant:", MaxKeys: 2, MaxBytes: 64}); err != nil {
+		testing.Fatalf("Unexpected error on set quota: %v", err)
+	}
+
+	if err := client.Set("tenant:a", "1", ExpireNever); err != nil {
+		testing.Errorf("Unexpected error within quota: %v", err)
+	}
+	if err := client.Set("tenant:b", "2", ExpireNever); err != nil {
+		testing.Errorf("Unexpected error within quota: %v", err)
+	}
+	err := client.Set("tenant:c", "3", ExpireNever)
+	if _, exceeded := err.(ErrQuotaExceeded); !exceeded {
+		testing.Errorf("Expected ErrQuotaExceeded for a key over MaxKeys, got %v", err)
+	}
+	if err := client.Set("other", "3", ExpireNever); err != nil {
+		testing.Errorf("Keys outside of the namespace are not expected to be limited: %v", err)
+	}
+	if err := client.Set("tenant:a", strings.Repeat("x", 64), ExpireNever); err == nil {
+		testing.Error("Write is expected to be rejected if its size doesn't fit MaxBytes")
+	}
+	if err := client.Set("tenant:a", strings.Repeat("x", 40), ExpireNever); err != nil {
+		testing.Errorf("Existing keys are expected to be writable under MaxKeys: %v", err)
+	}
+	if err := client.Set("tenant:b", strings.Repeat("y", 10), ExpireNever); err == nil {
+		testing.Error("Writes are expected to be rejected over MaxBytes")
+	}
+	if status, _ := doREST(testing, "PUT", server.URL+"/keys/tenant:b", strings.Repeat("y", 10), nil); status != 429 {
+		testing.Errorf("REST is expected to report exceeded quota as 429, got %v", status)
+	}
+
+	if err := client.Remove("tenant:a"); err != nil {
+		testing.Errorf("Removals are expected to be allowed over quota: %v", err)
+	}
+	if err := client.Set("tenant:c", "3", ExpireNever); err != nil {
+		testing.Errorf("Removal is expected to free the quota: %v", err)
+	}
+	usages, err := quotas.Quotas()
+	if err != nil || len(usages) != 1 {
+		testing.Fatalf("Unexpected usage: %+v %v", usages, err)
+	}
+	if usage := usages[0]; usage.Database != DefaultDatabase || usage.Keys != 2 || usage.Bytes != int64(len("tenant:b2tenant:c3")) {
+		testing.Errorf("Unexpected usage: %+v", usage)
+	}
+
+	if err := quotas.RemoveQuota("", "tenant:"); err != nil {
+		testing.Errorf("Unexpected error on remove quota: %v", err)
+	}
+	if err := client.Set("tenant:d", "4", ExpireNever); err != nil {
+		testing.Errorf("Removed quota is not expected to be enforced: %v", err)
+	}
+	if _, notFound := quotas.RemoveQuota("", "tenant:").(ErrNotFound); !notFound {
+		testing.Error("Removing a missing quota is expected to fail with ErrNotFound")
+	}
+}
+
+func TestQuotaOpsPerSecond(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	gcp := newGoodiesCommandProcessor(storage, NewPubSub())
+	res := gcp.HandleCommand(CommandRequest{Name: "DatabaseCreate", Parameters: []string{"reports", "-1"}})
+	if !res.Success {
+		testing.Fatalf("Unexpected error on create database: %v", res.Err)
+	}
+	res = gcp.HandleCommand(CommandRequest{Name: "QuotaSet", Parameters: []string{`{"Database":"reports","MaxOpsPerSecond":3}`}})
+	if !res.Success {
+		testing.Fatalf("Unexpected error on set quota: %v", res.Err)
+	}
+
+	// the window may roll over while the commands run, retry the burst in a fresh second then
+	for attempt := 0; ; attempt++ {
+		time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+		rejected := 0
+		for i := 0; i < 5; i++ {
+			res := gcp.HandleCommand(CommandRequest{Name: "Get", Parameters: []string{"key"}, Database: "reports"})
+			if _, exceeded := res.Err.(ErrQuotaExceeded); exceeded {
+				rejected++
+			}
+		}
+		if rejected == 2 {
+			break
+		}
+		if attempt == 2 {
+			testing.Fatalf("Expected 2 of 5 commands to be rejected, got %v", rejected)
+		}
+	}
+	if res := gcp.HandleCommand(CommandRequest{Name: "Get", Parameters: []string{"key"}}); res.Err != nil {
+		if _, exceeded := res.Err.(ErrQuotaExceeded); exceeded {
+			testing.Error("Quota of a database is not expected to limit other databases")
+		}
+	}
+}
+
+func TestQuotaPersisted(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	if err := storage.setQuota(Quota{Database: DefaultDatabase, Prefix: "p", MaxKeys: 1}); err != nil {
+		testing.Fatalf("Unexpected error on set quota: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := storage.writeSnapshot(&buf); err != nil {
+		testing.Fatalf("Unexpected error on snapshot: %v", err)
+	}
+	restored := NewGoodiesStorage(ExpireNever)
+	if err := restored.loadSnapshot(&buf); err != nil {
+		testing.Fatalf("Unexpected error on load: %v", err)
+	}
+	gcp := newGoodiesCommandProcessor(restored, NewPubSub())
+	gcp.HandleCommand(CommandRequest{Name: "Set", Parameters: []string{"p1", "v", "-1"}})
+	res := gcp.HandleCommand(CommandRequest{Name: "Set", Parameters: []string{"p2", "v", "-1"}})
+	if _, exceeded := res.Err.(ErrQuotaExceeded); !exceeded {
+		testing.Errorf("Restored quota is expected to be enforced, got %+v", res)
+	}
+}
+
+func TestQuotaTracksStorageChanges(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	gcp := newGoodiesCommandProcessor(storage, NewPubSub())
+	gcp.HandleCommand(CommandRequest{Name: "QuotaSet", Parameters: []string{`{"MaxKeys":1}`}})
+	gcp.HandleCommand(CommandRequest{Name: "ScheduleAdd", Parameters: []string{"4102444800000", `{"Name":"Remove","Parameters":["k"]}`}})
+	if res := gcp.HandleCommand(CommandRequest{Name: "Set", Parameters: []string{"short", "v", "-1"}}); !res.Success {
+		testing.Fatalf("Server state is not expected to count to the quota: %v", res.Err)
+	}
+	storage.SetExpiry("short", time.Millisecond)
+	<-time.After(5 * time.Millisecond)
+	storage.cleanupOutdated()
+	if res := gcp.HandleCommand(CommandRequest{Name: "Set", Parameters: []string{"other", "v", "-1"}}); !res.Success {
+		testing.Fatalf("Expired key is expected to free the quota: %v", res.Err)
+	}
+
+	// quotas are kept out of the key space, so neither flush nor swap drops them
+	gcp.HandleCommand(CommandRequest{Name: "FlushAll"})
+	gcp.HandleCommand(CommandRequest{Name: "DatabaseCreate", Parameters: []string{"staging", "-1"}})
+	gcp.HandleCommand(CommandRequest{Name: "DatabaseSwap", Parameters: []string{DefaultDatabase, "staging"}})
+	gcp.HandleCommand(CommandRequest{Name: "Set", Parameters: []string{"first", "v", "-1"}})
+	res := gcp.HandleCommand(CommandRequest{Name: "Set", Parameters: []string{"second", "v", "-1"}})
+	if _, exceeded := res.Err.(ErrQuotaExceeded); !exceeded {
+		testing.Errorf("Quota is expected to survive flush and swap, got %+v", res)
+	}
+}
@@ -0,0 +1,234 @@
+package goodies
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func init() {
+	gob.Register(tokenBucket{})
+	gob.Register(slidingLog{})
+}
+
+// RateLimitResult Outcome of a rate limited request
+// RetryAfter is the time until the next request would be allowed, it is 0 for allowed requests
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// RateLimitProvider Server-side rate limiting implemented by GoodiesStorage and the client returned from NewGoodiesClient
+// Every call is a single atomic command, limiter state is stored under key and shares the key space with other items
+type RateLimitProvider interface {
+	// AllowTokenBucket Takes a token from a bucket of limit tokens refilled evenly at limit tokens per window,
+	// so bursts up to limit are allowed
+	AllowTokenBucket(key string, limit int, window time.Duration) (RateLimitResult, error)
+	// AllowSlidingWindow Allows at most limit requests within any window long period (sliding window log)
+	AllowSlidingWindow(key string, limit int, window time.Duration) (RateLimitResult, error)
+}
+
+// tokenBucket Stored state of a token bucket
+type tokenBucket struct {
+	Tokens  float64
+	Updated int64
+}
+
+// slidingLog Stored times of requests allowed within the last window
+type slidingLog struct {
+	Times []int64
+}
+
+// rateLimiter is implemented by storages executing rate limit commands atomically
+type rateLimiter interface {
+	AllowTokenBucket(key string, limit int, window time.Duration) (RateLimitResult, error)
+	AllowSlidingWindow(key string, limit int, window time.Duration) (RateLimitResult, error)
+}
+
+func (g *GoodiesStorage) AllowTokenBucket(key string, limit int, window time.Duration) (RateLimitResult, error) {
+	if limit < 1 || window <= 0 {
+		return RateLimitResult{}, ErrCommandArgumentsMismatch{"Rate limit and window are expected to be positive"}
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.internalExpire(key)
+	now := time.Now().UnixNano()
+	bucket := tokenBucket{Tokens: float64(limit), Updated: now}
+	if value, found := g.internalGet(key); found {
+		stored, ok := value.(tokenBucket)
+		if !ok {
+			return RateLimitResult{}, ErrTypeMismatch{fmt.Sprintf("Item %v is not a token bucket", key)}
+		}
+		bucket = stored
+	}
+
+	perNano := float64(limit) / float64(window)
+	bucket.Tokens = math.Min(float64(limit), bucket.Tokens+float64(now-bucket.Updated)*perNano)
+	bucket.Updated = now
+	var result RateLimitResult
+	if bucket.Tokens >= 1 {
+		bucket.Tokens--
+		result = RateLimitResult{Allowed: true, Remaining: int(bucket.Tokens)}
+	} else {
+		result.RetryAfter = time.Duration(math.Ceil((1 - bucket.Tokens) / perNano))
+	}
+	// a bucket which is full again is not worth keeping
+	refilled := now + int64(math.Ceil((float64(limit)-bucket.Tokens)/perNano)) + 1
+	g.storage[key] = newItemWithExpiry(bucket, refilled)
+	g.emit(KeyUpdated, key)
+	return result, nil
+}
+
+func (g *GoodiesStorage) AllowSlidingWindow(key string, limit int, window time.Duration) (RateLimitResult, error) {
+	if limit < 1 || window <= 0 {
+		return RateLimitResult{}, ErrCommandArgumentsMismatch{"Rate limit and window are expected to be positive"}
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.internalExpire(key)
+	now := time.Now().UnixNano()
+	var log slidingLog
+	if value, found := g.internalGet(key); found {
+		stored, ok := value.(slidingLog)
+		if !ok {
+			return RateLimitResult{}, ErrTypeMismatch{fmt.Sprintf("Item %v is not a sliding window", key)}
+		}
+		log = stored
+	}
+
+	start := 0
+	for start < len(log.Times) && log.Times[start] <= now-int64(window) {
+		start++
+	}
+	times := append([]int64(nil), log.Times[start:]...)
+	var result RateLimitResult
+	if len(times) < limit {
+		times = append(times, now)
+		result = RateLimitResult{Allowed: true, Remaining: limit - len(times)}
+	} else {
+		result.RetryAfter = time.Duration(times[len(times)-limit] + int64(window) - now)
+	}
+	g.storage[key] = newItemWithExpiry(slidingLog{times}, times[len(times)-1]+int64(window))
+	g.emit(KeyUpdated, key)
+	return result, nil
+}
+
+func parseRateLimit(command CommandRequest) (int, time.Duration, error) {
+	limit, err := strconv.Atoi(command.Parameters[1])
+	if err != nil {
+		return 0, 0, ErrCommandArgumentsMismatch{fmt.Sprintf("%v limit is expected to be an integer", command.Name)}
+	}
+	millis, err := strconv.ParseInt(command.Parameters[2], 10, 64)
+	if err != nil {
+		return 0, 0, ErrCommandArgumentsMismatch{fmt.Sprintf("%v window is expected to be an integer (milliseconds)", command.Name)}
+	}
+	return limit, time.Duration(millis) * time.Millisecond, nil
+}
+
+func rateLimitCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 3 {
+		return createErrorResult(ErrCommandArgumentsMismatch{fmt.Sprintf("%v command is expected to have 3 arguments (key, limit(INT), window(INT MILLISECONDS))", command.Name)})
+	}
+	limiter, ok := storage.(rateLimiter)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support rate limiting"})
+	}
+	limit, window, err := parseRateLimit(command)
+	if err != nil {
+		return createErrorResult(err)
+	}
+	var result RateLimitResult
+	if command.Name == "RateLimitTokenBucket" {
+		result, err = limiter.AllowTokenBucket(command.Parameters[0], limit, window)
+	} else {
+		result, err = limiter.AllowSlidingWindow(command.Parameters[0], limit, window)
+	}
+	if err != nil {
+		return createErrorResult(err)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return createErrorResult(ErrTransformation{err.Error()})
+	}
+	return createOkResult(string(data))
+}
+
+func (c goodiesClient) AllowTokenBucket(key string, limit int, window time.Duration) (RateLimitResult, error) {
+	return c.rateLimit("RateLimitTokenBucket", key, limit, window)
+}
+
+func (c goodiesClient) AllowSlidingWindow(key string, limit int, window time.Duration) (RateLimitResult, error) {
+	return c.rateLimit("RateLimitSlidingWindow", key, limit, window)
+}
+
+func (c goodiesClient) rateLimit(name string, key string, limit int, window time.Duration) (RateLimitResult, error) {
+	req := CommandRequest{Name: name, Parameters: []string{key, strconv.Itoa(limit), strconv.FormatInt(window.Milliseconds(), 10)}}
+	res := internalProcess(req, c)
+	if !res.Success {
+		return RateLimitResult{}, res.Err
+	}
+	var result RateLimitResult
+	if err := json.Unmarshal([]byte(res.Result), &result); err != nil {
+		return RateLimitResult{}, ErrTransformation{err.Error()}
+	}
+	return result, nil
+}
+
+// RateLimit Describes the limit applied by RateLimitMiddleware
+type RateLimit struct {
+	Limit  int
+	Window time.Duration
+	// SlidingWindow Selects sliding window log instead of token bucket
+	SlidingWindow bool
+	// Prefix Prefix of limiter keys, e.g. "ratelimit:api:"
+	Prefix string
+	// Key Returns the limited identity (e.g. tenant) of a request, remote host is used if it is nil
+	Key func(r *http.Request) string
+}
+
+// RateLimitMiddleware Rejects requests over the limit with 429 Too Many Requests and Retry-After header
+// Requests are let through if the limiter fails, so goodies outage doesn't take the API down
+func RateLimitMiddleware(limiter RateLimitProvider, limit RateLimit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := limit.Prefix + rateLimitKey(r, limit.Key)
+			var result RateLimitResult
+			var err error
+			if limit.SlidingWindow {
+				result, err = limiter.AllowSlidingWindow(key, limit.Limit, limit.Window)
+			} else {
+				result, err = limiter.AllowTokenBucket(key, limit.Limit, limit.Window)
+			}
+			if err != nil {
+				fmt.Printf("Rate limiter failed, request is allowed: %v\n", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func rateLimitKey(r *http.Request, key func(r *http.Request) string) string {
+	if key != nil {
+		return key(r)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,71 @@
+package goodies
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStorageRateLimits(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	for i := 0; i < 3; i++ {
+		if result, err := storage.AllowTokenBucket("bucket", 3, time.Minute); err != nil || !result.Allowed || result.Remaining != 2-i {
+			testing.Errorf("Request %v is expected to be allowed: %+v %v", i, result, err)
+		}
+	}
+	if result, _ := storage.AllowTokenBucket("bucket", 3, time.Minute); result.Allowed || result.RetryAfter <= 0 || result.RetryAfter > 20*time.Second {
+		testing.Errorf("Empty bucket is expected to reject with retry after one refill: %+v", result)
+	}
+
+	for i := 0; i < 2; i++ {
+		if result, err := storage.AllowSlidingWindow("window", 2, 50*time.Millisecond); err != nil || !result.Allowed {
+			testing.Errorf("Request %v is expected to be allowed: %+v %v", i, result, err)
+		}
+	}
+	result, _ := storage.AllowSlidingWindow("window", 2, 50*time.Millisecond)
+	if result.Allowed || result.RetryAfter <= 0 || result.RetryAfter > 50*time.Millisecond {
+		testing.Errorf("Full window is expected to reject: %+v", result)
+	}
+	time.Sleep(result.RetryAfter + 5*time.Millisecond)
+	if result, _ := storage.AllowSlidingWindow("window", 2, 50*time.Millisecond); !result.Allowed {
+		testing.Errorf("Request is expected to be allowed once the window slides: %+v", result)
+	}
+
+	storage.Set("plain", "value", ExpireNever)
+	if _, err := storage.AllowTokenBucket("plain", 1, time.Second); err == nil {
+		testing.Error("Rate limiting a plain item is expected to fail")
+	}
+}
+
+func TestRateLimitMiddleware(testing *testing.T) {
+	server := httptest.NewServer(newGoodiesHTTPHandler(NewGoodiesStorage(ExpireNever)))
+	defer server.Close()
+	limiter := NewGoodiesClient(server.URL).(RateLimitProvider)
+	limit := RateLimit{Limit: 2, Window: time.Minute, Prefix: "api:", Key: func(r *http.Request) string {
+		return r.Header.Get("X-Tenant")
+	}}
+	handler := RateLimitMiddleware(limiter, limit)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func(tenant string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("X-Tenant", tenant)
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+	for i := 0; i < 2; i++ {
+		if code := serve("a").Code; code != http.StatusNoContent {
+			testing.Errorf("Request %v is expected to pass, got %v", i, code)
+		}
+	}
+	rejected := serve("a")
+	if rejected.Code != http.StatusTooManyRequests || rejected.Header().Get("Retry-After") == "" {
+		testing.Errorf("Request over the limit is expected to be rejected with Retry-After: %v %v", rejected.Code, rejected.Header())
+	}
+	if code := serve("b").Code; code != http.StatusNoContent {
+		testing.Errorf("Other tenant is expected to have its own limit, got %v", code)
+	}
+}
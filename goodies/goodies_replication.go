@@ -0,0 +1,459 @@
+package goodies
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	replicationPath = "/replication"
+
+	// replicationBacklogSize Amount of latest write commands kept for partial resynchronisation
+	replicationBacklogSize = 10000
+	// replicationPingInterval Interval of leader heartbeats sent to idle followers
+	replicationPingInterval = time.Second
+	// replicationTimeout Follower reconnects if nothing was received from leader for this long
+	replicationTimeout = 5 * replicationPingInterval
+	// replicationRetryInterval Pause between follower reconnection attempts
+	replicationRetryInterval = time.Second
+
+	// RoleLeader Role of a server accepting writes
+	RoleLeader = "leader"
+	// RoleFollower Role of a read-only server replicating a leader
+	RoleFollower = "follower"
+)
+
+// ReplicationInfo Describes replication state of a server
+// Offset is the number of write commands in the replication stream identified by ReplicationID
+type ReplicationInfo struct {
+	Role          string
+	Leader        string `json:",omitempty"`
+	Connected     bool
+	ReplicationID string
+	Offset        int64
+}
+
+// ReplicationProvider Replication management interface implemented by the client returned from NewGoodiesClient
+type ReplicationProvider interface {
+	// ReplicaOf Makes server a read-only follower of the leader address, empty address promotes it to leader
+	ReplicaOf(leader string) error
+	Role() (ReplicationInfo, error)
+	RoleContext(ctx context.Context) (ReplicationInfo, error)
+}
+
+// replicationEntry Single write command in the replication stream
+type replicationEntry struct {
+	Offset  int64
+	Command CommandRequest
+}
+
+// replicationSync Handshake sent by leader before streaming commands
+// Data contains storage snapshot (persistence encoding) in case of full synchronisation
+type replicationSync struct {
+	ReplicationID string
+	Offset        int64
+	Data          []byte `json:",omitempty"`
+}
+
+// replication Tracks replication stream of a server both as a leader and as a follower
+// lock serialises write commands with the backlog so snapshots always match the offset
+type replication struct {
+	lock    sync.Mutex
+	storage Provider
+	apply   func(CommandRequest) CommandResponse
+
+	id      string
+	offset  int64
+	backlog []replicationEntry
+	changed chan struct{}
+	// previous stream id and offset, it is still valid for partial resync up to that offset after promotion
+	prevID     string
+	prevOffset int64
+
+	leader    string
+	connected bool
+	stop      context.CancelFunc
+	// peer Credentials presented to the leader and to other nodes (e.g. migration targets), not guarded
+	// by lock as migrations read them while holding it
+	peer atomic.Pointer[Credentials]
+	// peerTLS TLS files of the server, its certificate is presented to other nodes and peer CAs verify them
+	peerTLS atomic.Pointer[tlsFiles]
+}
+
+func newReplication(storage Provider, apply func(CommandRequest) CommandResponse) *replication {
+	return &replication{
+		storage: storage,
+		apply:   apply,
+		id:      newReplicationID(),
+		changed: make(chan struct{}),
+	}
+}
+
+func newReplicationID() string {
+	id := make([]byte, 20)
+	if _, err := rand.Read(id); err != nil {
+		panic("Cannot generate replication id")
+	}
+	return hex.EncodeToString(id)
+}
+
+// write Executes a write command and appends the commands replicating it to the stream, followers reject writes
+// Commands are appended even if the write failed, as it might have changed something before (e.g. evicted keys)
+func (r *replication) write(handler func() (CommandResponse, []CommandRequest)) CommandResponse {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.leader != "" {
+		return createErrorResult(ErrReadOnly{fmt.Sprintf("Server is a follower of %v", r.leader)})
+	}
+	res, replicated := handler()
+	for _, req := range replicated {
+		r.appendEntry(replicationEntry{r.offset + 1, req})
+	}
+	return res
+}
+
+// effectCommands Commands depending on the clock of the server running them (leases, rate windows,
+// visibility timeouts), followers receive the resulting items instead of evaluating them again
+var effectCommands = map[string]bool{
+	"LockAcquire":            true,
+	"LockRenew":              true,
+	"LockRelease":            true,
+	"RateLimitTokenBucket":   true,
+	"RateLimitSlidingWindow": true,
+	"QueueEnqueue":           true,
+	"QueueDequeue":           true,
+	"QueueNack":              true,
+	"QueueAck":               true,
+}
+
+// replicatesEffect Reports if req has to be replicated by its effect, besides effectCommands these are
+// writes setting relative ttls (including the default one of created lists and dictionaries)
+// Must be called before req is executed
+func replicatesEffect(req CommandRequest, storage Provider) bool {
+	if _, ok := storage.(dumper); !ok || len(req.Parameters) == 0 {
+		return false
+	}
+	switch {
+	case effectCommands[req.Name]:
+		return true
+	case req.Name == "Set" || req.Name == "Update":
+		return len(req.Parameters) == 3 && req.Parameters[2] != ttlAsString(ExpireNever)
+	case req.Name == "SetExpiry":
+		return len(req.Parameters) == 2 && req.Parameters[1] != ttlAsString(ExpireNever)
+	case req.Name == "ListPush" || req.Name == "DictSet":
+		ttl := 2
+		if req.Name == "DictSet" {
+			ttl = 3
+		}
+		if len(req.Parameters) > ttl && req.Parameters[ttl] != ttlAsString(ExpireNever) {
+			return true
+		}
+		return !storageHasKey(storage, req.Parameters[0])
+	}
+	return false
+}
+
+// effects Returns commands restoring the items written by req as they are on the leader
+func effects(req CommandRequest, storage Provider) []CommandRequest {
+	dumper := storage.(dumper)
+	key := req.Parameters[0]
+	keys := []string{key}
+	if effectCommands[req.Name] && strings.HasPrefix(req.Name, "Queue") {
+		// jobs running out of attempts are moved to the dead-letter queue
+		keys = append(keys, key+DeadLetterSuffix)
+	}
+	replicated := make([]CommandRequest, 0, len(keys))
+	for _, written := range keys {
+		data, err := dumper.dump(written)
+		if err == nil {
+			replicated = append(replicated, CommandRequest{
+				Name:       "Restore",
+				Parameters: []string{written, base64.StdEncoding.EncodeToString(data)},
+				Database:   req.Database,
+			})
+		} else if written == key {
+			replicated = append(replicated, CommandRequest{Name: "Remove", Parameters: []string{written}, Database: req.Database})
+		}
+	}
+	return replicated
+}
+
+// appendEntry Adds an entry to the backlog waking up streaming followers
+// Must be called under lock
+func (r *replication) appendEntry(entry replicationEntry) {
+	r.offset = entry.Offset
+	r.backlog = append(r.backlog, entry)
+	if len(r.backlog) > 2*replicationBacklogSize {
+		r.backlog = append([]replicationEntry(nil), r.backlog[len(r.backlog)-replicationBacklogSize:]...)
+	}
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// canContinue Checks if follower at the offset of the stream id can be served from backlog
+// Must be called under lock
+func (r *replication) canContinue(id string, offset int64) bool {
+	if id == "" || (id != r.id && (id != r.prevID || offset > r.prevOffset)) || offset > r.offset {
+		return false
+	}
+	if len(r.backlog) == 0 {
+		return offset == r.offset
+	}
+	return offset >= r.backlog[0].Offset-1
+}
+
+// handshake Prepares either partial or full synchronisation for a follower
+func (r *replication) handshake(id string, offset int64) (replicationSync, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.canContinue(id, offset) {
+		return replicationSync{ReplicationID: r.id, Offset: offset}, nil
+	}
+	snapshotter, ok := r.storage.(snapshotter)
+	if !ok {
+		return replicationSync{}, ErrInternalError{"Storage doesn't support snapshots"}
+	}
+	var data bytes.Buffer
+	if err := snapshotter.writeSnapshot(&data); err != nil {
+		return replicationSync{}, ErrTransformation{err.Error()}
+	}
+	return replicationSync{ReplicationID: r.id, Offset: r.offset, Data: data.Bytes()}, nil
+}
+
+// entriesSince Returns entries after the offset and a channel closed on next append
+// ok is false when the offset is no longer in the backlog
+func (r *replication) entriesSince(offset int64) (entries []replicationEntry, changed chan struct{}, ok bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if offset == r.offset {
+		return nil, r.changed, true
+	}
+	if len(r.backlog) == 0 || offset < r.backlog[0].Offset-1 {
+		return nil, nil, false
+	}
+	start := int(offset - r.backlog[0].Offset + 1)
+	return append([]replicationEntry(nil), r.backlog[start:]...), r.changed, true
+}
+
+func (r *replication) info() ReplicationInfo {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	info := ReplicationInfo{Role: RoleLeader, ReplicationID: r.id, Offset: r.offset}
+	if r.leader != "" {
+		info.Role, info.Leader, info.Connected = RoleFollower, r.leader, r.connected
+	}
+	return info
+}
+
+// setPeerCredentials Changes credentials presented to other nodes, a follower uses them once it reconnects
+func (r *replication) setPeerCredentials(credentials Credentials) {
+	r.peer.Store(&credentials)
+}
+
+func (r *replication) peerCredentials() Credentials {
+	if credentials := r.peer.Load(); credentials != nil {
+		return *credentials
+	}
+	return Credentials{}
+}
+
+// peerClient Returns a transport to another node presenting peer credentials and the server certificate
+func (r *replication) peerClient(address string) GoodiesHttpCommandClient {
+	var config *tls.Config
+	if files := r.peerTLS.Load(); files != nil {
+		config = files.peerConfig()
+	}
+	client := NewGoodiesHttpCommandClient(address, config)
+	client.credentials = r.peerCredentials()
+	return client
+}
+
+// replicaOf Starts following the leader or promotes the server if leader is empty
+func (r *replication) replicaOf(leader string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.stop != nil {
+		r.stop()
+		r.stop = nil
+	}
+	if leader == "" {
+		if r.leader != "" {
+			// writes accepted from now on diverge from the old stream
+			r.prevID, r.prevOffset = r.id, r.offset
+			r.id = newReplicationID()
+		}
+		r.leader, r.connected = "", false
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r.leader, r.connected, r.stop = leader, false, cancel
+	go r.follow(ctx, leader)
+}
+
+// follow Keeps replicating from the leader until ctx is cancelled, reconnecting on failures
+func (r *replication) follow(ctx context.Context, leader string) {
+	for {
+		// created for every connection, so it uses credentials and certificates reloaded in the meantime
+		err := r.syncFrom(ctx, r.peerClient(leader))
+		r.lock.Lock()
+		if ctx.Err() == nil {
+			r.connected = false
+		}
+		r.lock.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		fmt.Printf("Replication from %v interrupted: %v\n", leader, err)
+		select {
+		case <-time.After(replicationRetryInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// syncFrom Requests synchronisation from the leader and applies streamed commands
+func (r *replication) syncFrom(ctx context.Context, client GoodiesHttpCommandClient) error {
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	watchdog := time.AfterFunc(replicationTimeout, cancel)
+	defer watchdog.Stop()
+
+	r.lock.Lock()
+	query := url.Values{"id": {r.id}, "offset": {strconv.FormatInt(r.offset, 10)}}
+	r.lock.Unlock()
+	resp, err := client.openStream(streamCtx, replicationPath, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var applyErr error
+	err = readSSE(resp.Body, func(event string, data []byte) bool {
+		watchdog.Reset(replicationTimeout)
+		switch event {
+		case "sync":
+			var sync replicationSync
+			if applyErr = json.Unmarshal(data, &sync); applyErr == nil {
+				applyErr = r.synchronise(ctx, sync)
+			}
+		case "command":
+			var entry replicationEntry
+			if applyErr = json.Unmarshal(data, &entry); applyErr == nil {
+				applyErr = r.applyEntry(ctx, entry)
+			}
+		}
+		return applyErr == nil
+	})
+	if applyErr != nil {
+		return applyErr
+	}
+	return err
+}
+
+// synchronise Applies leader handshake loading the snapshot if it was sent
+func (r *replication) synchronise(ctx context.Context, sync replicationSync) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if sync.Data != nil {
+		snapshotter, ok := r.storage.(snapshotter)
+		if !ok {
+			return ErrInternalError{"Storage doesn't support snapshots"}
+		}
+		if err := snapshotter.loadSnapshot(bytes.NewReader(sync.Data)); err != nil {
+			return err
+		}
+		r.backlog = nil
+	} else if sync.ReplicationID != r.id {
+		// leader continues our stream under a new id (e.g. it was promoted)
+		r.prevID, r.prevOffset = r.id, r.offset
+	}
+	r.id, r.offset, r.connected = sync.ReplicationID, sync.Offset, true
+	return nil
+}
+
+// applyEntry Executes a replicated command keeping it in own backlog for chained followers and promotion
+func (r *replication) applyEntry(ctx context.Context, entry replicationEntry) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if entry.Offset != r.offset+1 {
+		return ErrInternalError{fmt.Sprintf("Replication stream gap: expected offset %v, received %v", r.offset+1, entry.Offset)}
+	}
+	// failed commands are replicated only if they succeeded on leader so result is ignored
+	r.apply(entry.Command)
+	r.appendEntry(entry)
+	return nil
+}
+
+// serveReplication Streams synchronisation and write commands to a follower
+// e.g. GET /replication?id=<replication id>&offset=<last applied offset>
+func (s *goodiesHTTPServer) serveReplication(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	offset, err := strconv.ParseInt(query.Get("offset"), 10, 64)
+	if err != nil {
+		offset = -1
+	}
+	sync, err := s.replication.handshake(query.Get("id"), offset)
+	if err != nil {
+		http.Error(w, err.Error(), statusForError(err))
+		return
+	}
+	stream, err := newSSEStream(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := stream.Send("sync", sync); err != nil {
+		return
+	}
+
+	ping := time.NewTicker(replicationPingInterval)
+	defer ping.Stop()
+	next := sync.Offset
+	for {
+		entries, changed, ok := s.replication.entriesSince(next)
+		if !ok {
+			// follower fell behind the backlog, it will reconnect for a full synchronisation
+			return
+		}
+		for _, entry := range entries {
+			if err := stream.Send("command", entry); err != nil {
+				return
+			}
+			next = entry.Offset
+		}
+		if len(entries) > 0 {
+			continue
+		}
+		select {
+		case <-changed:
+		case <-ping.C:
+			if err := stream.Send("ping", next); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package goodies
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func waitFor(testing *testing.T, description string, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			testing.Fatalf("Timed out waiting for %v", description)
+		}
+		<-time.After(10 * time.Millisecond)
+	}
+}
+
+func TestReplicationFullSyncAndStream(testing *testing.T) {
+	leaderServer := httptest.NewServer(newGoodiesHTTPHandler(NewGoodiesStorage(ExpireNever)))
+	defer leaderServer.Close()
+	followerServer := httptest.NewServer(newGoodiesHTTPHandler(NewGoodiesStorage(ExpireNever)))
+	defer followerServer.Close()
+	leader := NewGoodiesClient(leaderServer.URL)
+	follower := NewGoodiesClient(followerServer.URL)
+
+	leader.Set("before", "snapshot", ExpireNever)
+	leader.DictSet("dict", "field", "value")
+	if err := follower.(ReplicationProvider).ReplicaOf(leaderServer.URL); err != nil {
+		testing.Fatalf("Unexpected error on ReplicaOf: %v", err)
+	}
+	waitFor(testing, "full synchronisation", func() bool {
+		val, err := follower.DictGet("dict", "field")
+		return err == nil && val == "value"
+	})
+
+	leader.ListPush("list", "streamed")
+	waitFor(testing, "streamed command", func() bool {
+		val, err := follower.ListGetByIndex("list", 0)
+		return err == nil && val == "streamed"
+	})
+
+	if err := follower.Set("write", "rejected", ExpireNever); err == nil {
+		testing.Error("Follower is expected to be read-only")
+	} else if _, ok := err.(ErrReadOnly); !ok {
+		testing.Errorf("Expected ErrReadOnly but received: %v", err)
+	}
+
+	info, err := follower.(ReplicationProvider).Role()
+	leaderInfo, _ := leader.(ReplicationProvider).Role()
+	if err != nil || info.Role != RoleFollower || !info.Connected || info.Offset != leaderInfo.Offset {
+		testing.Errorf("Unexpected follower state %+v, leader %+v (%v)", info, leaderInfo, err)
+	}
+
+	follower.(ReplicationProvider).ReplicaOf("")
+	if err := follower.Set("write", "accepted", ExpireNever); err != nil {
+		testing.Errorf("Promoted follower rejects writes: %v", err)
+	}
+}
+
+func TestReplicationPartialResync(testing *testing.T) {
+	leader := newReplication(NewGoodiesStorage(ExpireNever), nil)
+	for i := 0; i < 3; i++ {
+		leader.write(func() (CommandResponse, []CommandRequest) {
+			return createOkResult(""), []CommandRequest{{Name: "Set", Parameters: []string{"key", "value", "-1"}}}
+		})
+	}
+
+	if sync, _ := leader.handshake(leader.id, 1); sync.Data != nil || sync.Offset != 1 {
+		testing.Errorf("Expected partial resync from offset 1 but received %+v", sync)
+	}
+	if entries, _, ok := leader.entriesSince(1); !ok || len(entries) != 2 || entries[0].Offset != 2 {
+		testing.Errorf("Unexpected backlog entries: %v", entries)
+	}
+	if sync, _ := leader.handshake("unknown", 1); sync.Data == nil || sync.Offset != 3 {
+		testing.Errorf("Expected full resync for unknown stream but received %+v", sync)
+	}
+	if sync, _ := leader.handshake(leader.id, 5); sync.Data == nil {
+		testing.Error("Expected full resync for offset ahead of leader")
+	}
+
+	previous := leader.id
+	leader.leader = "http://old-leader/"
+	leader.replicaOf("")
+	if sync, _ := leader.handshake(previous, 2); sync.Data != nil || sync.ReplicationID == previous {
+		testing.Errorf("Promoted follower is expected to continue previous stream under new id: %+v", sync)
+	}
+}
+
+func TestReplicationOfClockDependentCommands(testing *testing.T) {
+	leaderStorage := NewGoodiesStorage(ExpireNever)
+	leaderServer := httptest.NewServer(newGoodiesHTTPHandler(leaderStorage))
+	defer leaderServer.Close()
+	followerStorage := NewGoodiesStorage(ExpireNever)
+	followerServer := httptest.NewServer(newGoodiesHTTPHandler(followerStorage))
+	defer followerServer.Close()
+	leader := NewGoodiesClient(leaderServer.URL)
+	follower := NewGoodiesClient(followerServer.URL)
+	if err := follower.(ReplicationProvider).ReplicaOf(leaderServer.URL); err != nil {
+		testing.Fatalf("Unexpected error on ReplicaOf: %v", err)
+	}
+	defer follower.(ReplicationProvider).ReplicaOf("")
+	waitFor(testing, "follower connection", func() bool {
+		info, err := follower.(ReplicationProvider).Role()
+		return err == nil && info.Connected
+	})
+
+	leader.Set("session", "value", time.Hour)
+	leader.(RateLimitProvider).AllowTokenBucket("api", 10, time.Minute)
+	leader.(QueueProvider).Enqueue("jobs", "payload", 0)
+	leader.(QueueProvider).Enqueue("jobs", "acked", 0)
+	leader.(QueueProvider).Dequeue("jobs", time.Minute)
+	if job, _, _ := leader.(QueueProvider).Dequeue("jobs", time.Minute); job.ID != "" {
+		leader.(QueueProvider).Ack("jobs", job.ID)
+	}
+	lease, _ := leader.(LockProvider).AcquireLock("released", time.Minute)
+	leader.(LockProvider).ReleaseLock(lease)
+	leader.(LockProvider).AcquireLock("held", time.Minute)
+	// followers evaluating the commands with their own clock would end up with different items
+	for _, key := range []string{"session", "api", "jobs", "held"} {
+		expected, _ := leaderStorage.dump(key)
+		waitFor(testing, "replicated "+key, func() bool {
+			replicated, _ := followerStorage.dump(key)
+			return bytes.Equal(replicated, expected)
+		})
+	}
+	if _, err := followerStorage.dump("released"); err == nil {
+		testing.Error("Released lock is expected to be removed on the follower")
+	}
+}
@@ -0,0 +1,279 @@
+package goodies
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// TTLHeader Request header carrying ttl (in seconds or ExpireDefault/ExpireNever as -2/-1) for REST calls
+	TTLHeader = "X-Goodies-Ttl"
+
+	restKeysPrefix  = "/keys"
+	restListsPrefix = "/lists"
+	restDictsPrefix = "/dicts"
+
+	// restMaxBodySize Largest request body (value) accepted by REST calls
+	restMaxBodySize = 16 << 20
+)
+
+// restResult describes how successful command result should be written back to REST client
+type restResult int
+
+const (
+	restNoContent restResult = iota
+	restText
+	restExistence
+	restJSON
+)
+
+// restCall is a REST request translated into a goodies command
+type restCall struct {
+	command CommandRequest
+	result  restResult
+}
+
+// isRESTPath Checks whether request path belongs to REST resources rather than to command endpoint
+func isRESTPath(path string) bool {
+	for _, prefix := range []string{restKeysPrefix, restListsPrefix, restDictsPrefix} {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// serveREST Serves resource oriented API:
+// /keys, /keys/{key}, /lists/{key}, /lists/{key}/{index}, /dicts/{key}, /dicts/{key}/{field}
+// Lists are read as JSON arrays and appended to by POST, they cannot be replaced by PUT
+func (s *goodiesHTTPServer) serveREST(w http.ResponseWriter, r *http.Request) {
+	segments, err := splitRESTPath(r.URL.EscapedPath())
+	if err != nil {
+		writeRESTError(w, ErrCommandArgumentsMismatch{err.Error()})
+		return
+	}
+	var body string
+	if r.Method == http.MethodPut || r.Method == http.MethodPost {
+		data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, restMaxBodySize))
+		if _, tooLarge := err.(*http.MaxBytesError); tooLarge {
+			http.Error(w, fmt.Sprintf("Request body exceeds %v bytes", restMaxBodySize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			writeRESTError(w, ErrInternalError{"Cannot read incoming request"})
+			return
+		}
+		body = string(data)
+	}
+
+	var call *restCall
+	var allowed string
+	switch segments[0] {
+	case restKeysPrefix[1:]:
+		call, allowed, err = keysRESTCall(r, segments[1:], body)
+	case restListsPrefix[1:]:
+		call, allowed, err = listsRESTCall(r, segments[1:], body)
+	case restDictsPrefix[1:]:
+		call, allowed, err = dictsRESTCall(r, segments[1:], body)
+	}
+	if err != nil {
+		writeRESTError(w, err)
+		return
+	}
+	if call == nil {
+		if allowed == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Allow", allowed)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	call.command.Database = r.Header.Get(DatabaseHeader)
+	res := s.commandProcessor.HandleCommand(call.command.WithContext(r.Context()))
+	writeRESTResult(w, call.result, res)
+}
+
+func keysRESTCall(r *http.Request, params []string, body string) (*restCall, string, error) {
+	switch len(params) {
+	case 0:
+		if r.Method != http.MethodGet {
+			return nil, "GET", nil
+		}
+		return &restCall{command: CommandRequest{Name: "Keys", Parameters: []string{}}, result: restJSON}, "", nil
+	case 1:
+		key := params[0]
+		switch r.Method {
+		case http.MethodGet:
+			return &restCall{command: CommandRequest{Name: "Get", Parameters: []string{key}}, result: restText}, "", nil
+		case http.MethodPut:
+			ttl, err := restTTL(r)
+			if err != nil {
+				return nil, "", err
+			}
+			if ttl == "" {
+				ttl = ttlAsString(ExpireDefault)
+			}
+			name := "Set"
+			if r.Header.Get("If-Match") == "*" {
+				// Only existing string values are replaced when client asks for it explicitly
+				name = "Update"
+			}
+			return &restCall{command: CommandRequest{Name: name, Parameters: []string{key, body, ttl}}}, "", nil
+		case http.MethodDelete:
+			return &restCall{command: CommandRequest{Name: "Remove", Parameters: []string{key}}}, "", nil
+		}
+		return nil, "GET, PUT, DELETE", nil
+	}
+	return nil, "", nil
+}
+
+func listsRESTCall(r *http.Request, params []string, body string) (*restCall, string, error) {
+	switch len(params) {
+	case 1:
+		key := params[0]
+		switch r.Method {
+		case http.MethodGet:
+			return &restCall{command: CommandRequest{Name: "ListGetAll", Parameters: []string{key}}, result: restJSON}, "", nil
+		case http.MethodPost:
+			return withRESTExpiry(r, &restCall{command: CommandRequest{Name: "ListPush", Parameters: []string{key, body}}})
+		case http.MethodDelete:
+			if values, ok := r.URL.Query()["value"]; ok {
+				return &restCall{command: CommandRequest{Name: "ListRemoveValue", Parameters: []string{key, values[0]}}}, "", nil
+			}
+			return &restCall{command: CommandRequest{Name: "Remove", Parameters: []string{key}}}, "", nil
+		}
+		return nil, "GET, POST, DELETE", nil
+	case 2:
+		key, index := params[0], params[1]
+		if i, err := strconv.Atoi(index); err != nil || i < 0 {
+			return nil, "", ErrCommandArgumentsMismatch{"List index is expected to be a non-negative integer"}
+		}
+		switch r.Method {
+		case http.MethodGet:
+			return &restCall{command: CommandRequest{Name: "ListGetByIndex", Parameters: []string{key, index}}, result: restText}, "", nil
+		case http.MethodDelete:
+			return &restCall{command: CommandRequest{Name: "ListRemoveIndex", Parameters: []string{key, index}}}, "", nil
+		}
+		return nil, "GET, DELETE", nil
+	}
+	return nil, "", nil
+}
+
+func dictsRESTCall(r *http.Request, params []string, body string) (*restCall, string, error) {
+	switch len(params) {
+	case 1:
+		if r.Method != http.MethodDelete {
+			return nil, "DELETE", nil
+		}
+		return &restCall{command: CommandRequest{Name: "Remove", Parameters: []string{params[0]}}}, "", nil
+	case 2:
+		key, field := params[0], params[1]
+		switch r.Method {
+		case http.MethodGet:
+			return &restCall{command: CommandRequest{Name: "DictGet", Parameters: []string{key, field}}, result: restText}, "", nil
+		case http.MethodHead:
+			return &restCall{command: CommandRequest{Name: "DictHasKey", Parameters: []string{key, field}}, result: restExistence}, "", nil
+		case http.MethodPut:
+			return withRESTExpiry(r, &restCall{command: CommandRequest{Name: "DictSet", Parameters: []string{key, field, body}}})
+		case http.MethodDelete:
+			return &restCall{command: CommandRequest{Name: "DictRemove", Parameters: []string{key, field}}}, "", nil
+		}
+		return nil, "GET, HEAD, PUT, DELETE", nil
+	}
+	return nil, "", nil
+}
+
+// withRESTExpiry Passes ttl header to the command if it was supplied, so the write and the expiry are atomic
+func withRESTExpiry(r *http.Request, call *restCall) (*restCall, string, error) {
+	ttl, err := restTTL(r)
+	if err != nil {
+		return nil, "", err
+	}
+	if ttl != "" {
+		call.command.Parameters = append(call.command.Parameters, ttl)
+	}
+	return call, "", nil
+}
+
+// restTTL Returns ttl header value validated to be understood by command handlers
+func restTTL(r *http.Request) (string, error) {
+	ttl := r.Header.Get(TTLHeader)
+	if ttl == "" {
+		return "", nil
+	}
+	if _, err := parseTTL(ttl); err != nil {
+		return "", err
+	}
+	return ttl, nil
+}
+
+func splitRESTPath(escapedPath string) ([]string, error) {
+	var segments []string
+	for _, segment := range strings.Split(strings.Trim(escapedPath, "/"), "/") {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, unescaped)
+	}
+	return segments, nil
+}
+
+func writeRESTResult(w http.ResponseWriter, result restResult, res CommandResponse) {
+	if !res.Success {
+		writeRESTError(w, res.Err)
+		return
+	}
+	switch result {
+	case restText:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(res.Result))
+	case restExistence:
+		if res.Result != "1" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case restJSON:
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(res.Result))
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeRESTError(w http.ResponseWriter, err error) {
+	if err == nil {
+		err = ErrInternalError{"Command failed without an error"}
+	}
+	http.Error(w, err.Error(), statusForError(err))
+}
+
+// statusForError Maps goodies typed errors to HTTP status codes
+func statusForError(err error) int {
+	switch err.(type) {
+	case ErrNotFound, ErrDictKeyNotFound:
+		return http.StatusNotFound
+	case ErrTypeMismatch, *ErrTypeMismatch:
+		return http.StatusConflict
+	case ErrCommandArgumentsMismatch, ErrUnknownCommand, ErrTransformation:
+		return http.StatusBadRequest
+	case ErrReadOnly, ErrForbidden:
+		return http.StatusForbidden
+	case ErrLocked, ErrLockNotHeld:
+		return http.StatusConflict
+	case ErrMoved, ErrAsk:
+		return http.StatusMisdirectedRequest
+	case ErrUnauthorized:
+		return http.StatusUnauthorized
+	case ErrQuotaExceeded:
+		return http.StatusTooManyRequests
+	case ErrOutOfMemory:
+		return http.StatusInsufficientStorage
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,154 @@
+package goodies
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func newTestRESTServer() *httptest.Server {
+	return httptest.NewServer(newGoodiesHTTPHandler(NewGoodiesStorage(ExpireNever)))
+}
+
+func doREST(testing *testing.T, method string, url string, body string, headers map[string]string) (int, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		testing.Fatalf("Cannot create request: %v", err)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		testing.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, strings.TrimSpace(string(data))
+}
+
+func TestRESTKeys(testing *testing.T) {
+	server := newTestRESTServer()
+	defer server.Close()
+
+	if status, _ := doREST(testing, "GET", server.URL+"/keys/missing", "", nil); status != http.StatusNotFound {
+		testing.Errorf("Expected 404 for missing key but received %v", status)
+	}
+	if status, _ := doREST(testing, "PUT", server.URL+"/keys/a%2Fb", "value", map[string]string{TTLHeader: "60"}); status != http.StatusNoContent {
+		testing.Errorf("Expected 204 on set but received %v", status)
+	}
+	if status, body := doREST(testing, "GET", server.URL+"/keys/a%2Fb", "", nil); status != http.StatusOK || body != "value" {
+		testing.Errorf("Unexpected get result: %v %v", status, body)
+	}
+	if status, _ := doREST(testing, "PUT", server.URL+"/keys/other", "v", map[string]string{"If-Match": "*"}); status != http.StatusNotFound {
+		testing.Errorf("Conditional update of missing key should fail with 404 but received %v", status)
+	}
+	if status, body := doREST(testing, "GET", server.URL+"/keys", "", nil); status != http.StatusOK || body != `["a/b"]` {
+		testing.Errorf("Unexpected keys result: %v %v", status, body)
+	}
+	doREST(testing, "PUT", server.URL+"/keys/report:1", "v", nil)
+	status, body := doREST(testing, "GET", server.URL+"/keys", "", nil)
+	var keys []string
+	json.Unmarshal([]byte(body), &keys)
+	sort.Strings(keys)
+	if status != http.StatusOK || !reflect.DeepEqual(keys, []string{"a/b", "report:1"}) {
+		testing.Errorf("Keys containing a colon are expected to be listed whole: %v %v", status, body)
+	}
+	if keys, err := NewGoodiesClient(server.URL).Keys(); err != nil || len(keys) != 2 {
+		testing.Errorf("Client is expected to read keys containing a colon: %v %v", keys, err)
+	}
+	doREST(testing, "DELETE", server.URL+"/keys/report:1", "", nil)
+	if status, _ := doREST(testing, "PUT", server.URL+"/keys/a%2Fb", "value", map[string]string{TTLHeader: "soon"}); status != http.StatusBadRequest {
+		testing.Errorf("Expected 400 for malformed ttl but received %v", status)
+	}
+	if status, _ := doREST(testing, "POST", server.URL+"/keys/a%2Fb", "", nil); status != http.StatusMethodNotAllowed {
+		testing.Errorf("Expected 405 for unsupported method but received %v", status)
+	}
+	if status, _ := doREST(testing, "DELETE", server.URL+"/keys/a%2Fb", "", nil); status != http.StatusNoContent {
+		testing.Errorf("Expected 204 on delete but received %v", status)
+	}
+}
+
+func TestRESTListsAndDicts(testing *testing.T) {
+	server := newTestRESTServer()
+	defer server.Close()
+
+	doREST(testing, "POST", server.URL+"/lists/list", "first", nil)
+	doREST(testing, "POST", server.URL+"/lists/list", "second", nil)
+	if status, body := doREST(testing, "GET", server.URL+"/lists/list", "", nil); status != http.StatusOK || body != `["first","second"]` {
+		testing.Errorf("Unexpected list: %v %v", status, body)
+	}
+	if status, _ := doREST(testing, "PUT", server.URL+"/lists/list", "[]", nil); status != http.StatusMethodNotAllowed {
+		testing.Errorf("Expected 405 on replacing a list but received %v", status)
+	}
+	if status, body := doREST(testing, "GET", server.URL+"/lists/list/1", "", nil); status != http.StatusOK || body != "second" {
+		testing.Errorf("Unexpected list item: %v %v", status, body)
+	}
+	for _, method := range []string{"GET", "DELETE"} {
+		if status, _ := doREST(testing, method, server.URL+"/lists/list/-1", "", nil); status != http.StatusBadRequest {
+			testing.Errorf("Expected 400 on %v of negative index but received %v", method, status)
+		}
+	}
+	if status, _ := doREST(testing, "GET", server.URL+"/keys/list", "", nil); status != http.StatusConflict {
+		testing.Errorf("Expected 409 on reading list as a string but received %v", status)
+	}
+
+	if status, _ := doREST(testing, "PUT", server.URL+"/dicts/dict/field", "value", nil); status != http.StatusNoContent {
+		testing.Errorf("Expected 204 on dict set but received %v", status)
+	}
+	doREST(testing, "PUT", server.URL+"/dicts/dict/other", "value2", nil)
+	if status, body := doREST(testing, "GET", server.URL+"/dicts/dict/other", "", nil); status != http.StatusOK || body != "value2" {
+		testing.Errorf("Unexpected dict value: %v %v", status, body)
+	}
+	if status, _ := doREST(testing, "HEAD", server.URL+"/dicts/dict/field", "", nil); status != http.StatusOK {
+		testing.Errorf("Expected existing dict field but received %v", status)
+	}
+	doREST(testing, "DELETE", server.URL+"/dicts/dict/field", "", nil)
+	if status, _ := doREST(testing, "GET", server.URL+"/dicts/dict/field", "", nil); status != http.StatusNotFound {
+		testing.Errorf("Expected 404 for removed dict field but received %v", status)
+	}
+	if status, _ := doREST(testing, "PUT", server.URL+"/dicts/list/field", "value", nil); status != http.StatusConflict {
+		testing.Errorf("Expected 409 on using list as a dict but received %v", status)
+	}
+}
+
+func TestRESTCollectionExpiry(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	server := httptest.NewServer(newGoodiesHTTPHandler(storage))
+	defer server.Close()
+
+	ttl := map[string]string{TTLHeader: "60"}
+	if status, _ := doREST(testing, "POST", server.URL+"/lists/list", "first", ttl); status != http.StatusNoContent {
+		testing.Errorf("Expected 204 on push with ttl but received %v", status)
+	}
+	if status, _ := doREST(testing, "PUT", server.URL+"/dicts/dict/field", "value", ttl); status != http.StatusNoContent {
+		testing.Errorf("Expected 204 on dict set with ttl but received %v", status)
+	}
+	for _, key := range []string{"list", "dict"} {
+		if item := storage.storage[key]; item.Expiry == 0 {
+			testing.Errorf("Ttl of %v is expected to be set with the write", key)
+		}
+	}
+
+	storage.Set("string", "value", ExpireNever)
+	if status, _ := doREST(testing, "POST", server.URL+"/lists/string", "value", ttl); status != http.StatusConflict {
+		testing.Errorf("Expected 409 on pushing to a string but received %v", status)
+	}
+	if item := storage.storage["string"]; item.Expiry != 0 {
+		testing.Error("Failed write is not expected to change the ttl")
+	}
+}
+
+func TestRESTBodyLimit(testing *testing.T) {
+	server := newTestRESTServer()
+	defer server.Close()
+	body := strings.Repeat("x", restMaxBodySize+1)
+	if status, _ := doREST(testing, "PUT", server.URL+"/keys/large", body, nil); status != http.StatusRequestEntityTooLarge {
+		testing.Errorf("Expected 413 for oversized body but received %v", status)
+	}
+}
@@ -0,0 +1,269 @@
+package goodies
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// RetryPolicy Describes how commands failed on transport level are retried
+// Delay before n-th retry is BaseDelay*2^(n-1) capped by MaxDelay, randomised by up to a half (jitter)
+type RetryPolicy struct {
+	// MaxAttempts Total amount of attempts including the first one, values below 2 disable retries
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// DefaultRetryPolicy Retry policy suitable for riding out a server restart
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 4, BaseDelay: 50 * time.Millisecond, MaxDelay: 2 * time.Second}
+
+// idempotentCommands Commands which can be safely resent when it is unknown if they were executed
+var idempotentCommands = map[string]bool{
+	"Set":               true,
+	"Get":               true,
+	"Update":            true,
+	"Remove":            true,
+	"Keys":              true,
+	"ListLen":           true,
+	"ListGetByIndex":    true,
+	"ListGetAll":        true,
+	"DictSet":           true,
+	"DictGet":           true,
+	"DictRemove":        true,
+	"DictHasKey":        true,
+	"SetExpiry":         true,
+	"Role":              true,
+	"ReplicaOf":         true,
+	"ClusterSlots":      true,
+	"ClusterKeysInSlot": true,
+	// acquiring a lock again by the same owner only extends the lease
+	"LockAcquire": true,
+	"LockRenew":   true,
+	"LockRelease": true,
+
+	"QueueMaxAttempts": true,
+	"QueueStats":       true,
+	"ScheduleList":     true,
+	"ScheduleCancel":   true,
+	"FlushAll":         true,
+	"DbSize":           true,
+	"Save":             true,
+	"LastSave":         true,
+	"ConfigGet":        true,
+	"ConfigSet":        true,
+	"DatabaseList":     true,
+	"DatabaseFlush":    true,
+	"QuotaSet":         true,
+	"QuotaUsage":       true,
+	"ACLSet":           true,
+	"ACLList":          true,
+}
+
+// ClientOption Configures the client created by NewGoodiesClient
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	retry            RetryPolicy
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	nearCache        *NearCacheConfig
+	database         string
+	credentials      Credentials
+	tls              *tls.Config
+}
+
+// WithRetryPolicy Retries idempotent commands failed on transport level according to the policy
+// Other commands are retried only if the connection could not be established, so they were not sent
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(options *clientOptions) {
+		options.retry = policy
+	}
+}
+
+// WithCircuitBreaker Fails commands fast with ErrCircuitOpen after failureThreshold consecutive transport
+// failures, a single probe command is let through once cooldown passed
+func WithCircuitBreaker(failureThreshold int, cooldown time.Duration) ClientOption {
+	return func(options *clientOptions) {
+		options.breakerThreshold = failureThreshold
+		options.breakerCooldown = cooldown
+	}
+}
+
+func newClientOptions(options []ClientOption) clientOptions {
+	var configured clientOptions
+	for _, option := range options {
+		option(&configured)
+	}
+	return configured
+}
+
+// connect Applies connection options (database, credentials and TLS) to the transport
+func (configured clientOptions) connect(transport GoodiesHttpCommandClient) GoodiesHttpCommandClient {
+	transport.database = configured.database
+	transport.credentials = configured.credentials
+	if configured.tls != nil {
+		transport.client = httpClient(configured.tls, transport.socket)
+	}
+	return transport
+}
+
+// connectedTransport Creates a transport to the address applying connection options only, used by clients
+// managing transports to several nodes on their own
+func connectedTransport(address string, options []ClientOption) GoodiesHttpCommandClient {
+	return newClientOptions(options).connect(NewGoodiesHttpCommandClient(address))
+}
+
+// withClientOptions Wraps the transport if any of the options requires it
+// Near cache is the outermost layer, so cache hits are served even while the circuit is open
+func withClientOptions(transport GoodiesHttpCommandClient, options []ClientOption) CommandProcessor {
+	configured := newClientOptions(options)
+	transport = configured.connect(transport)
+	var wrapped ContextCommandProcessor = transport
+	if configured.retry.MaxAttempts >= 2 || configured.breakerThreshold >= 1 {
+		resilient := &resilientTransport{next: transport, retry: configured.retry}
+		if configured.breakerThreshold > 0 {
+			resilient.breaker = &circuitBreaker{threshold: configured.breakerThreshold, cooldown: configured.breakerCooldown}
+		}
+		wrapped = resilient
+	}
+	if configured.nearCache != nil && (configured.database == "" || configured.database == DefaultDatabase) {
+		wrapped = newNearCacheTransport(wrapped, transport, *configured.nearCache)
+	}
+	return wrapped
+}
+
+// resilientTransport Transport decorator retrying failed commands and breaking the circuit to a dead server
+type resilientTransport struct {
+	next    ContextCommandProcessor
+	retry   RetryPolicy
+	breaker *circuitBreaker
+}
+
+func (t *resilientTransport) Process(req CommandRequest, res *CommandResponse) error {
+	return t.ProcessContext(context.Background(), req, res)
+}
+
+func (t *resilientTransport) ProcessContext(ctx context.Context, req CommandRequest, res *CommandResponse) error {
+	for attempt := 1; ; attempt++ {
+		if err := t.breaker.allow(); err != nil {
+			return err
+		}
+		*res = CommandResponse{}
+		err := t.next.ProcessContext(ctx, req, res)
+		if ctx.Err() != nil {
+			t.breaker.release()
+			return err
+		}
+		// errors returned by the server mean it is alive
+		t.breaker.record(err == nil)
+		if err == nil || attempt >= t.retry.MaxAttempts {
+			return err
+		}
+		if !idempotentCommands[req.Name] && !isDialError(err) {
+			return err
+		}
+		select {
+		case <-time.After(t.retry.delay(attempt)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (t *resilientTransport) subscribe(channels []string, patterns []string) (*Subscription, error) {
+	transport, ok := t.next.(subscribingTransport)
+	if !ok {
+		return nil, ErrInternalError{"Transport doesn't support subscriptions"}
+	}
+	return transport.subscribe(channels, patterns)
+}
+
+func (t *resilientTransport) watch(prefix string) (*Watcher, error) {
+	transport, ok := t.next.(watchingTransport)
+	if !ok {
+		return nil, ErrInternalError{"Transport doesn't support watching"}
+	}
+	return transport.watch(prefix)
+}
+
+// delay Returns pause before the retry following the attempt
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 1 {
+		return delay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)))
+}
+
+// isDialError Reports if the connection was not established, so the command was not sent
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// circuitBreaker Counts consecutive transport failures, nil breaker lets everything through
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	lock      sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// allow Returns ErrCircuitOpen while the circuit is open or a probe command is in flight
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.failures < b.threshold {
+		return nil
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return ErrCircuitOpen{fmt.Sprintf("Server failed %v consecutive requests", b.failures)}
+	}
+	b.probing = true
+	return nil
+}
+
+// release Lets another probe through if the command was cancelled before its outcome was known
+func (b *circuitBreaker) release() {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.probing = false
+}
+
+func (b *circuitBreaker) record(success bool) {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.probing = false
+	if success {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
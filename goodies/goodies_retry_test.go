@@ -0,0 +1,89 @@
+package goodies
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFlakyServer Returns server dropping connections of the first failures requests (all while down is set)
+func newFlakyServer(failures int32, down *atomic.Bool) (*httptest.Server, *atomic.Int32) {
+	handler := newGoodiesHTTPHandler(NewGoodiesStorage(ExpireNever))
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures || (down != nil && down.Load()) {
+			panic(http.ErrAbortHandler)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	return server, &requests
+}
+
+func TestClientRetries(testing *testing.T) {
+	server, requests := newFlakyServer(2, nil)
+	defer server.Close()
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+	client := NewGoodiesClient(server.URL, WithRetryPolicy(policy))
+
+	if err := client.Set("key", "value", ExpireNever); err != nil {
+		testing.Fatalf("Idempotent command was not retried: %v", err)
+	}
+	if requests.Load() != 3 {
+		testing.Errorf("Expected 3 attempts, got %v", requests.Load())
+	}
+
+	server2, requests2 := newFlakyServer(1, nil)
+	defer server2.Close()
+	client = NewGoodiesClient(server2.URL, WithRetryPolicy(policy))
+	if err := client.ListPush("list", "value"); err == nil {
+		testing.Error("Not idempotent command is not expected to be retried after it was sent")
+	}
+	if requests2.Load() != 1 {
+		testing.Errorf("Expected single attempt, got %v", requests2.Load())
+	}
+}
+
+func TestRetryPolicyDelay(testing *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		max *= time.Millisecond
+		if delay := policy.delay(attempt + 1); delay < max/2 || delay > max {
+			testing.Errorf("Delay of attempt %v is out of range: %v", attempt+1, delay)
+		}
+	}
+}
+
+func TestClientCircuitBreaker(testing *testing.T) {
+	var down atomic.Bool
+	down.Store(true)
+	server, requests := newFlakyServer(0, &down)
+	defer server.Close()
+	client := NewGoodiesClient(server.URL, WithCircuitBreaker(2, 50*time.Millisecond))
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Get("key"); err == nil {
+			testing.Fatal("Expected failure of a server which is down")
+		}
+	}
+	if _, err := client.Get("key"); err == nil {
+		testing.Fatal("Expected circuit to be open")
+	} else if _, open := err.(ErrCircuitOpen); !open {
+		testing.Errorf("Expected ErrCircuitOpen, got %v", err)
+	}
+	if requests.Load() != 2 {
+		testing.Errorf("Open circuit is not expected to reach server, got %v requests", requests.Load())
+	}
+
+	down.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	if _, err := client.Get("key"); err == nil {
+		testing.Error("Expected ErrNotFound from recovered server")
+	} else if _, notFound := err.(ErrNotFound); !notFound {
+		testing.Errorf("Probe command didn't reach recovered server: %v", err)
+	}
+	if err := client.Set("key", "value", ExpireNever); err != nil {
+		testing.Errorf("Circuit is expected to be closed after successful probe: %v", err)
+	}
+}
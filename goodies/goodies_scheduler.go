@@ -0,0 +1,239 @@
+package goodies
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// schedulerInterval Period of checking the schedule for due commands
+const schedulerInterval = 100 * time.Millisecond
+
+// ScheduledCommand A command executed by the server once RunAt passes
+type ScheduledCommand struct {
+	ID      string
+	RunAt   time.Time
+	Command CommandRequest
+}
+
+// SchedulerProvider Delayed command execution implemented by the client returned from NewGoodiesClient
+// Commands are executed at most once by the leader, a command due while the server was down runs right after start
+type SchedulerProvider interface {
+	// ScheduleCommand Schedules the command to be executed at runAt, returns id of the scheduled command
+	// A command without Database runs in the database selected by the client
+	ScheduleCommand(runAt time.Time, command CommandRequest) (string, error)
+	// ScheduledCommands Returns commands waiting for execution ordered by run time
+	ScheduledCommands() ([]ScheduledCommand, error)
+	// CancelScheduled Removes the scheduled command, returns ErrNotFound if it was executed or cancelled already
+	CancelScheduled(id string) error
+}
+
+// scheduleEntry Stored scheduled command, RunAt is in unix nanoseconds
+type scheduleEntry struct {
+	RunAt   int64
+	Command CommandRequest
+}
+
+// scheduleItem State of the schedule kept in serverState
+type scheduleItem struct {
+	Entries map[string]scheduleEntry
+	NextID  int64
+}
+
+// schedule is implemented by storages keeping the schedule
+type schedule interface {
+	addScheduled(runAt int64, command CommandRequest) (string, error)
+	removeScheduled(id string) error
+	listScheduled() ([]ScheduledCommand, error)
+}
+
+func (g *GoodiesStorage) addScheduled(runAt int64, command CommandRequest) (string, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	state := &g.state.Schedule
+	if state.Entries == nil {
+		state.Entries = make(map[string]scheduleEntry)
+	}
+	state.NextID++
+	id := strconv.FormatInt(state.NextID, 10)
+	state.Entries[id] = scheduleEntry{RunAt: runAt, Command: CommandRequest{Name: command.Name, Parameters: command.Parameters, Database: command.Database}}
+	return id, nil
+}
+
+func (g *GoodiesStorage) removeScheduled(id string) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if _, found := g.state.Schedule.Entries[id]; !found {
+		return ErrNotFound{fmt.Sprintf("scheduled command %v", id)}
+	}
+	delete(g.state.Schedule.Entries, id)
+	return nil
+}
+
+func (g *GoodiesStorage) listScheduled() ([]ScheduledCommand, error) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	commands := make([]ScheduledCommand, 0, len(g.state.Schedule.Entries))
+	for id, entry := range g.state.Schedule.Entries {
+		commands = append(commands, ScheduledCommand{ID: id, RunAt: time.Unix(0, entry.RunAt), Command: entry.Command})
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		if commands[i].RunAt.Equal(commands[j].RunAt) {
+			// commands scheduled for the same time run in the order they were scheduled
+			first, _ := strconv.ParseInt(commands[i].ID, 10, 64)
+			second, _ := strconv.ParseInt(commands[j].ID, 10, 64)
+			return first < second
+		}
+		return commands[i].RunAt.Before(commands[j].RunAt)
+	})
+	return commands, nil
+}
+
+// runScheduler Executes due commands through the processor until it is stopped
+func (gcp *goodiesCommandProcessor) runScheduler() {
+	defer gcp.scheduling.Done()
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			gcp.runDueCommands(time.Now())
+		case <-gcp.stopping:
+			return
+		}
+	}
+}
+
+// runDueCommands Claims every due command by a replicated cancel before executing it, so followers
+// (which reject the cancel) never execute it and the leader executes it once
+func (gcp *goodiesCommandProcessor) runDueCommands(now time.Time) {
+	store, ok := gcp.storage.(schedule)
+	if !ok {
+		return
+	}
+	commands, err := store.listScheduled()
+	if err != nil {
+		return
+	}
+	for _, scheduled := range commands {
+		if scheduled.RunAt.After(now) {
+			return
+		}
+		select {
+		case <-gcp.stopping:
+			return
+		default:
+		}
+		claim := gcp.HandleCommand(CommandRequest{Name: "ScheduleCancel", Parameters: []string{scheduled.ID}})
+		if !claim.Success {
+			continue
+		}
+		if res := gcp.HandleCommand(scheduled.Command); !res.Success {
+			fmt.Printf("Scheduled command %v (%v) failed: %v\n", scheduled.ID, scheduled.Command.Name, res.Err)
+		}
+	}
+}
+
+func (gcp *goodiesCommandProcessor) scheduleAddCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 2 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"ScheduleAdd command is expected to have 2 arguments (runAt(INT UNIX MILLISECONDS), command(JSON))"})
+	}
+	store, ok := storage.(schedule)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support scheduling"})
+	}
+	runAt, err := strconv.ParseInt(command.Parameters[0], 10, 64)
+	if err != nil {
+		return createErrorResult(ErrCommandArgumentsMismatch{"ScheduleAdd runAt is expected to be an integer (unix milliseconds)"})
+	}
+	var scheduled CommandRequest
+	if err := json.Unmarshal([]byte(command.Parameters[1]), &scheduled); err != nil {
+		return createErrorResult(ErrCommandArgumentsMismatch{fmt.Sprintf("ScheduleAdd command is not valid: %v", err)})
+	}
+	if _, known := gcp.commandHandlers[scheduled.Name]; !known {
+		return createErrorResult(ErrUnknownCommand{scheduled.Name})
+	}
+	if scheduled.Database == "" {
+		// commands without a database run in the one selected by the client scheduling them
+		scheduled.Database = command.Database
+	}
+	// scheduled commands run on behalf of the server, so they are authorized for the identity scheduling them
+	if err := gcp.authorize(scheduled.WithContext(command.Context())); err != nil {
+		return createErrorResult(err)
+	}
+	id, err := store.addScheduled(time.UnixMilli(runAt).UnixNano(), scheduled)
+	if err != nil {
+		return createErrorResult(err)
+	}
+	// processors that are never stopped only run a scheduler once something is scheduled
+	gcp.startScheduler()
+	return createOkResult(id)
+}
+
+func scheduleCancelCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 1 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"ScheduleCancel command is expected to have 1 argument (id)"})
+	}
+	store, ok := storage.(schedule)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support scheduling"})
+	}
+	if err := store.removeScheduled(command.Parameters[0]); err != nil {
+		return createErrorResult(err)
+	}
+	return createOkResult("")
+}
+
+func scheduleListCommandHandler(command CommandRequest, storage Provider) CommandResponse {
+	if len(command.Parameters) != 0 {
+		return createErrorResult(ErrCommandArgumentsMismatch{"ScheduleList command is expected to have no arguments"})
+	}
+	store, ok := storage.(schedule)
+	if !ok {
+		return createErrorResult(ErrInternalError{"Storage doesn't support scheduling"})
+	}
+	commands, err := store.listScheduled()
+	if err != nil {
+		return createErrorResult(err)
+	}
+	data, err := json.Marshal(commands)
+	if err != nil {
+		return createErrorResult(ErrTransformation{err.Error()})
+	}
+	return createOkResult(string(data))
+}
+
+func (c goodiesClient) ScheduleCommand(runAt time.Time, command CommandRequest) (string, error) {
+	data, err := json.Marshal(command)
+	if err != nil {
+		return "", ErrTransformation{err.Error()}
+	}
+	req := CommandRequest{Name: "ScheduleAdd", Parameters: []string{strconv.FormatInt(runAt.UnixMilli(), 10), string(data)}}
+	res := internalProcess(req, c)
+	if !res.Success {
+		return "", res.Err
+	}
+	return res.Result, nil
+}
+
+func (c goodiesClient) ScheduledCommands() ([]ScheduledCommand, error) {
+	res := internalProcess(CommandRequest{Name: "ScheduleList"}, c)
+	if !res.Success {
+		return nil, res.Err
+	}
+	var commands []ScheduledCommand
+	if err := json.Unmarshal([]byte(res.Result), &commands); err != nil {
+		return nil, ErrTransformation{err.Error()}
+	}
+	return commands, nil
+}
+
+func (c goodiesClient) CancelScheduled(id string) error {
+	res := internalProcess(CommandRequest{Name: "ScheduleCancel", Parameters: []string{id}}, c)
+	if !res.Success {
+		return res.Err
+	}
+	return nil
+}
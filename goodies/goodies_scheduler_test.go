@@ -0,0 +1,142 @@
+package goodies
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestScheduledCommands(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	server := httptest.NewServer(newGoodiesHTTPHandler(storage))
+	defer server.Close()
+	client := NewGoodiesClient(server.URL)
+	scheduler := client.(SchedulerProvider)
+
+	client.Set("session", "value", ExpireNever)
+	later, err := scheduler.ScheduleCommand(time.Now().Add(time.Hour), CommandRequest{Name: "Remove", Parameters: []string{"other"}})
+	if err != nil {
+		testing.Fatalf("Unexpected error on schedule: %v", err)
+	}
+	soon, _ := scheduler.ScheduleCommand(time.Now().Add(50*time.Millisecond), CommandRequest{Name: "Remove", Parameters: []string{"session"}})
+	if _, err := scheduler.ScheduleCommand(time.Now(), CommandRequest{Name: "Unknown"}); err == nil {
+		testing.Error("Unknown command is not expected to be scheduled")
+	}
+	commands, err := scheduler.ScheduledCommands()
+	if err != nil || len(commands) != 2 || commands[0].ID != soon || commands[1].ID != later || commands[0].Command.Parameters[0] != "session" {
+		testing.Fatalf("Unexpected scheduled commands: %+v %v", commands, err)
+	}
+
+	waitFor(testing, "scheduled remove", func() bool {
+		_, err := client.Get("session")
+		_, notFound := err.(ErrNotFound)
+		return notFound
+	})
+	if commands, _ := scheduler.ScheduledCommands(); len(commands) != 1 || commands[0].ID != later {
+		testing.Errorf("Executed command is expected to leave the schedule: %+v", commands)
+	}
+
+	// schedule is kept out of the key space
+	if keys, _ := storage.Keys(); len(keys) != 0 {
+		testing.Errorf("Schedule is not expected among keys: %v", keys)
+	}
+	storage.FlushAll()
+	storage.CreateDatabase("staging", ExpireNever)
+	storage.SwapDatabases(DefaultDatabase, "staging")
+	if commands, _ := storage.listScheduled(); len(commands) != 1 {
+		testing.Errorf("Schedule is expected to survive flush and swap: %+v", commands)
+	}
+
+	// schedule is persisted with the snapshot
+	var snapshot bytes.Buffer
+	storage.writeSnapshot(&snapshot)
+	restored := NewGoodiesStorage(ExpireNever)
+	if err := restored.loadSnapshot(&snapshot); err != nil {
+		testing.Fatalf("Unexpected error on snapshot load: %v", err)
+	}
+	if commands, _ := restored.listScheduled(); len(commands) != 1 || commands[0].ID != later {
+		testing.Errorf("Schedule is expected to survive restore: %+v", commands)
+	}
+
+	if err := scheduler.CancelScheduled(later); err != nil {
+		testing.Errorf("Unexpected error on cancel: %v", err)
+	}
+	if _, notFound := scheduler.CancelScheduled(later).(ErrNotFound); !notFound {
+		testing.Error("Cancelled command is not expected to be cancelled again")
+	}
+}
+
+func TestScheduledCommandDatabase(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	server := httptest.NewServer(newGoodiesHTTPHandler(storage))
+	defer server.Close()
+	storage.CreateDatabase("staging", ExpireNever)
+	client := NewGoodiesClient(server.URL, WithDatabase("staging"))
+
+	client.Set("session", "value", ExpireNever)
+	if _, err := client.(SchedulerProvider).ScheduleCommand(time.Now(), CommandRequest{Name: "Remove", Parameters: []string{"session"}}); err != nil {
+		testing.Fatalf("Unexpected error on schedule: %v", err)
+	}
+	waitFor(testing, "scheduled remove in the selected database", func() bool {
+		_, err := client.Get("session")
+		_, notFound := err.(ErrNotFound)
+		return notFound
+	})
+}
+
+func TestSchedulerStopsOnShutdown(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	handler := newGoodiesHTTPHandler(storage)
+	storage.Set("session", "value", ExpireNever)
+	storage.addScheduled(time.Now().Add(50*time.Millisecond).UnixNano(), CommandRequest{Name: "Remove", Parameters: []string{"session"}})
+	handler.closeStreams()
+	<-time.After(200 * time.Millisecond)
+	if _, err := storage.Get("session"); err != nil {
+		testing.Errorf("Scheduled command is not expected to run after shutdown: %v", err)
+	}
+}
+
+func TestSchedulerStartsOnSchedule(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	processor := NewGoodiesCommandsProcessor(storage).(*goodiesCommandProcessor)
+	defer processor.stop()
+	storage.Set("session", "value", ExpireNever)
+	storage.addScheduled(time.Now().UnixNano(), CommandRequest{Name: "Remove", Parameters: []string{"session"}})
+	<-time.After(200 * time.Millisecond)
+	if _, err := storage.Get("session"); err != nil {
+		testing.Fatalf("Processor is not expected to run a scheduler before scheduling: %v", err)
+	}
+
+	runAt := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	res := processor.HandleCommand(CommandRequest{Name: "ScheduleAdd", Parameters: []string{runAt, `{"Name":"Set","Parameters":["other","value","0"]}`}})
+	if !res.Success {
+		testing.Fatalf("Unexpected error on schedule: %v", res.Err)
+	}
+	waitFor(testing, "scheduled commands", func() bool {
+		_, err := storage.Get("session")
+		_, notFound := err.(ErrNotFound)
+		_, set := storage.Get("other")
+		return notFound && set == nil
+	})
+}
+
+func TestHttpServerStopsSchedulerOnShutdown(testing *testing.T) {
+	server := NewGoodiesHttpServer("0", ExpireNever, filepath.Join(testing.TempDir(), "goodies.dat"), time.Hour)
+	handler := server.Handler.(*goodiesHTTPServer)
+	if err := server.Shutdown(context.Background()); err != nil {
+		testing.Fatalf("Unexpected error on shutdown: %v", err)
+	}
+	waitFor(testing, "closed streams", func() bool {
+		select {
+		case <-handler.closing:
+			return true
+		default:
+			return false
+		}
+	})
+	handler.storage.(StoppableProvider).Stop()
+}
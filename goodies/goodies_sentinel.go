@@ -0,0 +1,263 @@
+package goodies
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// sentinelRequestTimeout Timeout of a single health check of a node
+const sentinelRequestTimeout = time.Second
+
+// Sentinel Monitors a replicated deployment and promotes the most up-to-date follower
+// once the leader failed downAfter consecutive checks
+type Sentinel struct {
+	nodes     []string
+	interval  time.Duration
+	downAfter int
+	clients   map[string]goodiesClient
+
+	// round serialises checks, so lock guarding the leader is not held during requests to the nodes
+	round    sync.Mutex
+	failures int
+
+	lock   sync.Mutex
+	leader string
+	// ctx is done once the sentinel is stopped, aborting requests of a check in progress
+	ctx  context.Context
+	stop context.CancelFunc
+}
+
+// NewSentinel Creates a sentinel for the nodes (server addresses as used by NewGoodiesClient), connection
+// options (credentials, TLS) are applied to all of them
+func NewSentinel(nodes []string, checkInterval time.Duration, downAfter int, options ...ClientOption) (*Sentinel, error) {
+	if checkInterval <= 0 {
+		return nil, fmt.Errorf("sentinel check interval is expected to be positive, got %v", checkInterval)
+	}
+	clients := make(map[string]goodiesClient, len(nodes))
+	for _, node := range nodes {
+		clients[node] = goodiesClient{newGoodiesHttpCommandClientWithTimeout(node, sentinelRequestTimeout, options)}
+	}
+	if downAfter < 1 {
+		downAfter = 1
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	return &Sentinel{
+		nodes:     nodes,
+		interval:  checkInterval,
+		downAfter: downAfter,
+		clients:   clients,
+		ctx:       ctx,
+		stop:      stop,
+	}, nil
+}
+
+// Start Runs checks in background until Stop is called
+func (s *Sentinel) Start() {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.Check()
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop Stops background checks, it can be called more than once
+func (s *Sentinel) Stop() {
+	s.stop()
+}
+
+// Leader Returns address of the current leader or empty string if it is unknown
+func (s *Sentinel) Leader() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.leader
+}
+
+func (s *Sentinel) setLeader(leader string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.leader = leader
+}
+
+// Check Performs a single monitoring round: discovers the leader, fails over if it is down
+// and points all other reachable nodes to the leader
+func (s *Sentinel) Check() {
+	s.round.Lock()
+	defer s.round.Unlock()
+
+	roles := make(map[string]ReplicationInfo, len(s.nodes))
+	for _, node := range s.nodes {
+		if info, err := s.clients[node].RoleContext(s.ctx); err == nil {
+			roles[node] = info
+		}
+	}
+	if s.ctx.Err() != nil {
+		// stopped during the check, nodes whose requests were aborted are not down
+		return
+	}
+
+	leader := s.Leader()
+	if info, up := roles[leader]; up && info.Role != RoleLeader {
+		// leader was demoted by someone else, discover the deployment again
+		leader = ""
+	}
+	if leader == "" {
+		leader = pickLeader(s.nodes, roles, RoleLeader)
+	}
+	s.setLeader(leader)
+
+	// no leader known (e.g. all reachable nodes follow a node which is gone) is a failure as well
+	if _, up := roles[leader]; !up {
+		s.failures++
+		if s.failures < s.downAfter {
+			return
+		}
+		if leader != "" {
+			fmt.Printf("Sentinel: leader %v is down\n", leader)
+		}
+		candidate := pickLeader(s.nodes, roles, RoleFollower)
+		if candidate == "" || !s.promote(candidate) {
+			return
+		}
+		leader = candidate
+	}
+	s.failures = 0
+
+	for node, info := range roles {
+		if node == leader || (info.Role == RoleFollower && info.Leader == leader) {
+			continue
+		}
+		fmt.Printf("Sentinel: reconfiguring %v to follow %v\n", node, leader)
+		if err := s.clients[node].ReplicaOf(leader); err != nil {
+			fmt.Printf("Sentinel: cannot reconfigure %v: %v\n", node, err)
+		}
+	}
+}
+
+// promote Makes the node a leader, must be called during a check
+func (s *Sentinel) promote(node string) bool {
+	fmt.Printf("Sentinel: promoting %v to leader\n", node)
+	if err := s.clients[node].ReplicaOf(""); err != nil {
+		fmt.Printf("Sentinel: cannot promote %v: %v\n", node, err)
+		return false
+	}
+	s.setLeader(node)
+	return true
+}
+
+// pickLeader Returns reachable node of the role with the highest replication offset
+// (the first one in nodes order wins a tie)
+func pickLeader(nodes []string, roles map[string]ReplicationInfo, role string) string {
+	var best string
+	var bestOffset int64 = -1
+	for _, node := range nodes {
+		info, up := roles[node]
+		if !up || info.Role != role || info.Offset <= bestOffset {
+			continue
+		}
+		best, bestOffset = node, info.Offset
+	}
+	return best
+}
+
+// failoverTransport Sends commands to the current leader discovering it from seed addresses
+type failoverTransport struct {
+	seeds   []string
+	options []ClientOption
+	lock    sync.Mutex
+	leader  *GoodiesHttpCommandClient
+}
+
+// NewGoodiesFailoverClient Creates a client following the leader of a replicated deployment
+// Leader is discovered by asking seed nodes for their role. Commands rejected by a demoted leader
+// are resent to the new one, after a transport error leader is rediscovered on the next command
+// Connection options (database, credentials, TLS) are applied to all nodes, the others are ignored
+func NewGoodiesFailoverClient(seeds []string, options ...ClientOption) Provider {
+	return goodiesClient{&failoverTransport{seeds: seeds, options: options}}
+}
+
+func (t *failoverTransport) Process(req CommandRequest, res *CommandResponse) error {
+	return t.ProcessContext(context.Background(), req, res)
+}
+
+func (t *failoverTransport) ProcessContext(ctx context.Context, req CommandRequest, res *CommandResponse) error {
+	leader, err := t.currentLeader(ctx, false)
+	if err != nil {
+		return err
+	}
+	if err = leader.ProcessContext(ctx, req, res); err != nil {
+		// the command might have been executed, so it is not resent
+		t.forget(leader)
+		return err
+	}
+	if _, readOnly := res.Err.(ErrReadOnly); !readOnly {
+		return nil
+	}
+	if leader, err = t.currentLeader(ctx, true); err != nil {
+		return err
+	}
+	*res = CommandResponse{}
+	return leader.ProcessContext(ctx, req, res)
+}
+
+// forget Drops the leader so it is rediscovered on the next command
+func (t *failoverTransport) forget(leader *GoodiesHttpCommandClient) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.leader == leader {
+		t.leader = nil
+	}
+}
+
+func (t *failoverTransport) subscribe(channels []string, patterns []string) (*Subscription, error) {
+	leader, err := t.currentLeader(context.Background(), false)
+	if err != nil {
+		return nil, err
+	}
+	return leader.subscribe(channels, patterns)
+}
+
+func (t *failoverTransport) watch(prefix string) (*Watcher, error) {
+	leader, err := t.currentLeader(context.Background(), false)
+	if err != nil {
+		return nil, err
+	}
+	return leader.watch(prefix)
+}
+
+// currentLeader Returns transport of the known leader, rediscovering it if asked
+func (t *failoverTransport) currentLeader(ctx context.Context, rediscover bool) (*GoodiesHttpCommandClient, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.leader != nil && !rediscover {
+		return t.leader, nil
+	}
+	roles := make(map[string]ReplicationInfo, len(t.seeds))
+	for _, seed := range t.seeds {
+		client := goodiesClient{newGoodiesHttpCommandClientWithTimeout(seed, sentinelRequestTimeout, t.options)}
+		if info, err := client.RoleContext(ctx); err == nil {
+			roles[seed] = info
+		}
+	}
+	leader := pickLeader(t.seeds, roles, RoleLeader)
+	if leader == "" {
+		return nil, ErrInternalError{fmt.Sprintf("No leader found among %v", t.seeds)}
+	}
+	transport := connectedTransport(leader, t.options)
+	t.leader = &transport
+	return t.leader, nil
+}
+
+func newGoodiesHttpCommandClientWithTimeout(address string, timeout time.Duration, options []ClientOption) GoodiesHttpCommandClient {
+	transport := connectedTransport(address, options)
+	transport.client.Timeout = timeout
+	return transport
+}
@@ -0,0 +1,117 @@
+package goodies
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSentinelFailover(testing *testing.T) {
+	var handlers []*goodiesHTTPServer
+	var servers []*httptest.Server
+	var nodes []string
+	for i := 0; i < 3; i++ {
+		handler := newGoodiesHTTPHandler(NewGoodiesStorage(ExpireNever))
+		handlers = append(handlers, handler)
+		servers = append(servers, httptest.NewServer(handler))
+		nodes = append(nodes, servers[i].URL)
+	}
+	defer func() {
+		// replication streams keep servers from closing so they are stopped first
+		for _, handler := range handlers {
+			handler.replication.replicaOf("")
+		}
+		for _, server := range servers {
+			server.Close()
+		}
+	}()
+
+	sentinel, _ := NewSentinel(nodes, time.Second, 2)
+	sentinel.Check()
+	if sentinel.Leader() != nodes[0] {
+		testing.Fatalf("Expected first node to be elected as leader of a fresh deployment, got %v", sentinel.Leader())
+	}
+	sentinel.Check()
+	client := NewGoodiesFailoverClient(nodes)
+	if err := client.Set("key", "value", ExpireNever); err != nil {
+		testing.Fatalf("Unexpected error on set through failover client: %v", err)
+	}
+	for _, node := range nodes[1:] {
+		follower := NewGoodiesClient(node)
+		waitFor(testing, "replication to "+node, func() bool {
+			val, err := follower.Get("key")
+			return err == nil && val == "value"
+		})
+	}
+
+	servers[0].CloseClientConnections()
+	servers[0].Close()
+	sentinel.Check()
+	if sentinel.Leader() != nodes[0] {
+		testing.Fatal("Leader is not expected to be replaced before downAfter checks failed")
+	}
+	sentinel.Check()
+	newLeader := sentinel.Leader()
+	if newLeader == nodes[0] || newLeader == "" {
+		testing.Fatalf("Follower was not promoted, leader is %v", newLeader)
+	}
+	sentinel.Check()
+	for _, node := range nodes[1:] {
+		info, err := NewGoodiesClient(node).(ReplicationProvider).Role()
+		if err != nil {
+			testing.Fatalf("Unexpected error on role: %v", err)
+		}
+		if node == newLeader && info.Role != RoleLeader {
+			testing.Errorf("Promoted node reports %v role", info.Role)
+		}
+		if node != newLeader && (info.Role != RoleFollower || info.Leader != newLeader) {
+			testing.Errorf("Node %v is not following new leader: %+v", node, info)
+		}
+	}
+
+	// first command fails as the old leader is gone, leader is rediscovered afterwards
+	client.Set("after", "failover", ExpireNever)
+	if err := client.Set("after", "failover", ExpireNever); err != nil {
+		testing.Fatalf("Failover client didn't discover new leader: %v", err)
+	}
+	if val, err := NewGoodiesClient(newLeader).Get("after"); err != nil || val != "failover" {
+		testing.Errorf("Write didn't reach new leader: %v %v", val, err)
+	}
+}
+
+func TestSentinelWithoutLeader(testing *testing.T) {
+	leaderServer := httptest.NewServer(newGoodiesHTTPHandler(NewGoodiesStorage(ExpireNever)))
+	handler := newGoodiesHTTPHandler(NewGoodiesStorage(ExpireNever))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	defer handler.replication.replicaOf("")
+	if err := NewGoodiesClient(server.URL).(ReplicationProvider).ReplicaOf(leaderServer.URL); err != nil {
+		testing.Fatalf("Unexpected error on ReplicaOf: %v", err)
+	}
+	leaderServer.CloseClientConnections()
+	leaderServer.Close()
+
+	sentinel, _ := NewSentinel([]string{server.URL}, time.Second, 2)
+	sentinel.Check()
+	if sentinel.Leader() != "" {
+		testing.Fatal("Follower is not expected to be promoted before downAfter checks failed")
+	}
+	sentinel.Check()
+	if sentinel.Leader() != server.URL {
+		testing.Fatalf("Follower was not promoted, leader is %v", sentinel.Leader())
+	}
+}
+
+func TestSentinelLifecycle(testing *testing.T) {
+	if _, err := NewSentinel(nil, 0, 1); err == nil {
+		testing.Error("Sentinel is not expected to be created without check interval")
+	}
+	sentinel, err := NewSentinel(nil, time.Millisecond, 1)
+	if err != nil {
+		testing.Fatalf("Unexpected error on sentinel creation: %v", err)
+	}
+	sentinel.Stop()
+	sentinel.Start()
+	sentinel.Start()
+	sentinel.Stop()
+}
@@ -0,0 +1,363 @@
+package goodies
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultVirtualNodes Amount of points each node gets on the hash ring
+const DefaultVirtualNodes = 160
+
+// hashRing Consistent hash ring with virtual nodes
+type hashRing struct {
+	virtualNodes int
+	points       []uint64
+	owners       map[uint64]string
+}
+
+func newHashRing(virtualNodes int) *hashRing {
+	if virtualNodes < 1 {
+		virtualNodes = DefaultVirtualNodes
+	}
+	return &hashRing{virtualNodes: virtualNodes, owners: make(map[uint64]string)}
+}
+
+// hashKey Maps key onto the ring, md5 is used (as in ketama) for its even distribution of similar keys
+func hashKey(key string) uint64 {
+	sum := md5.Sum([]byte(key))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+func (r *hashRing) add(node string) {
+	for i := 0; i < r.virtualNodes; i++ {
+		point := hashKey(node + "#" + strconv.Itoa(i))
+		if _, taken := r.owners[point]; taken {
+			continue
+		}
+		r.owners[point] = node
+		r.points = append(r.points, point)
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+}
+
+func (r *hashRing) remove(node string) {
+	points := r.points[:0]
+	for _, point := range r.points {
+		if r.owners[point] == node {
+			delete(r.owners, point)
+			continue
+		}
+		points = append(points, point)
+	}
+	r.points = points
+}
+
+// get Returns the node owning the first point clockwise from the key hash
+func (r *hashRing) get(key string) (string, bool) {
+	if len(r.points) == 0 {
+		return "", false
+	}
+	hash := hashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= hash })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]], true
+}
+
+// ShardedProvider Provider spreading keys across several providers (usually goodies clients)
+// using a consistent hash ring, so adding or removing a node remaps only a fraction of keys
+// Keys are not moved between nodes, remapped ones are simply missed on the new owner
+type ShardedProvider struct {
+	lock  sync.RWMutex
+	ring  *hashRing
+	nodes map[string]Provider
+}
+
+// NewShardedProvider Creates an empty sharded provider, virtualNodes <= 0 means DefaultVirtualNodes
+func NewShardedProvider(virtualNodes int) *ShardedProvider {
+	return &ShardedProvider{ring: newHashRing(virtualNodes), nodes: make(map[string]Provider)}
+}
+
+// NewGoodiesShardedClient Creates a sharded provider over goodies servers, addresses are used as node names
+// and options are applied to clients of all of them
+func NewGoodiesShardedClient(addresses []string, options ...ClientOption) *ShardedProvider {
+	sharded := NewShardedProvider(DefaultVirtualNodes)
+	for _, address := range addresses {
+		sharded.AddNode(address, NewGoodiesClient(address, options...))
+	}
+	return sharded
+}
+
+// AddNode Adds a node (or replaces the provider of existing one)
+func (s *ShardedProvider) AddNode(name string, node Provider) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, exists := s.nodes[name]; !exists {
+		s.ring.add(name)
+	}
+	s.nodes[name] = node
+}
+
+// RemoveNode Removes a node, its keys are remapped to the neighbouring nodes
+func (s *ShardedProvider) RemoveNode(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, exists := s.nodes[name]; exists {
+		s.ring.remove(name)
+		delete(s.nodes, name)
+	}
+}
+
+// Nodes Returns names of all nodes
+func (s *ShardedProvider) Nodes() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	names := make([]string, 0, len(s.nodes))
+	for name := range s.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NodeFor Returns name of the node owning the key
+func (s *ShardedProvider) NodeFor(key string) (string, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	name, ok := s.ring.get(key)
+	if !ok {
+		return "", ErrInternalError{"No nodes available"}
+	}
+	return name, nil
+}
+
+func (s *ShardedProvider) node(key string) (ContextProvider, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	name, ok := s.ring.get(key)
+	if !ok {
+		return nil, ErrInternalError{"No nodes available"}
+	}
+	return asContextProvider(s.nodes[name]), nil
+}
+
+func (s *ShardedProvider) Set(key string, value string, ttl time.Duration) error {
+	return s.SetContext(context.Background(), key, value, ttl)
+}
+
+func (s *ShardedProvider) SetContext(ctx context.Context, key string, value string, ttl time.Duration) error {
+	node, err := s.node(key)
+	if err != nil {
+		return err
+	}
+	return node.SetContext(ctx, key, value, ttl)
+}
+
+func (s *ShardedProvider) Get(key string) (string, error) {
+	return s.GetContext(context.Background(), key)
+}
+
+func (s *ShardedProvider) GetContext(ctx context.Context, key string) (string, error) {
+	node, err := s.node(key)
+	if err != nil {
+		return "", err
+	}
+	return node.GetContext(ctx, key)
+}
+
+func (s *ShardedProvider) Update(key string, value string, ttl time.Duration) error {
+	return s.UpdateContext(context.Background(), key, value, ttl)
+}
+
+func (s *ShardedProvider) UpdateContext(ctx context.Context, key string, value string, ttl time.Duration) error {
+	node, err := s.node(key)
+	if err != nil {
+		return err
+	}
+	return node.UpdateContext(ctx, key, value, ttl)
+}
+
+func (s *ShardedProvider) Remove(key string) error {
+	return s.RemoveContext(context.Background(), key)
+}
+
+func (s *ShardedProvider) RemoveContext(ctx context.Context, key string) error {
+	node, err := s.node(key)
+	if err != nil {
+		return err
+	}
+	return node.RemoveContext(ctx, key)
+}
+
+func (s *ShardedProvider) Keys() ([]string, error) {
+	return s.KeysContext(context.Background())
+}
+
+// KeysContext Collects keys from all nodes concurrently, fails if any of the nodes fails
+func (s *ShardedProvider) KeysContext(ctx context.Context) ([]string, error) {
+	s.lock.RLock()
+	nodes := make([]ContextProvider, 0, len(s.nodes))
+	for _, node := range s.nodes {
+		nodes = append(nodes, asContextProvider(node))
+	}
+	s.lock.RUnlock()
+
+	type nodeKeys struct {
+		keys []string
+		err  error
+	}
+	results := make(chan nodeKeys, len(nodes))
+	for _, node := range nodes {
+		go func(node ContextProvider) {
+			keys, err := node.KeysContext(ctx)
+			results <- nodeKeys{keys, err}
+		}(node)
+	}
+
+	unique := make(map[string]bool)
+	var firstErr error
+	for range nodes {
+		result := <-results
+		if result.err != nil && firstErr == nil {
+			firstErr = result.err
+		}
+		for _, key := range result.keys {
+			unique[key] = true
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	keys := make([]string, 0, len(unique))
+	for key := range unique {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *ShardedProvider) ListPush(key string, value string) error {
+	return s.ListPushContext(context.Background(), key, value)
+}
+
+func (s *ShardedProvider) ListPushContext(ctx context.Context, key string, value string) error {
+	node, err := s.node(key)
+	if err != nil {
+		return err
+	}
+	return node.ListPushContext(ctx, key, value)
+}
+
+func (s *ShardedProvider) ListLen(key string) (int, error) {
+	return s.ListLenContext(context.Background(), key)
+}
+
+func (s *ShardedProvider) ListLenContext(ctx context.Context, key string) (int, error) {
+	node, err := s.node(key)
+	if err != nil {
+		return 0, err
+	}
+	return node.ListLenContext(ctx, key)
+}
+
+func (s *ShardedProvider) ListRemoveIndex(key string, index int) error {
+	return s.ListRemoveIndexContext(context.Background(), key, index)
+}
+
+func (s *ShardedProvider) ListRemoveIndexContext(ctx context.Context, key string, index int) error {
+	node, err := s.node(key)
+	if err != nil {
+		return err
+	}
+	return node.ListRemoveIndexContext(ctx, key, index)
+}
+
+func (s *ShardedProvider) ListRemoveValue(key string, value string) error {
+	return s.ListRemoveValueContext(context.Background(), key, value)
+}
+
+func (s *ShardedProvider) ListRemoveValueContext(ctx context.Context, key string, value string) error {
+	node, err := s.node(key)
+	if err != nil {
+		return err
+	}
+	return node.ListRemoveValueContext(ctx, key, value)
+}
+
+func (s *ShardedProvider) ListGetByIndex(key string, index int) (string, error) {
+	return s.ListGetByIndexContext(context.Background(), key, index)
+}
+
+func (s *ShardedProvider) ListGetByIndexContext(ctx context.Context, key string, index int) (string, error) {
+	node, err := s.node(key)
+	if err != nil {
+		return "", err
+	}
+	return node.ListGetByIndexContext(ctx, key, index)
+}
+
+func (s *ShardedProvider) DictSet(key string, dictKey string, value string) error {
+	return s.DictSetContext(context.Background(), key, dictKey, value)
+}
+
+func (s *ShardedProvider) DictSetContext(ctx context.Context, key string, dictKey string, value string) error {
+	node, err := s.node(key)
+	if err != nil {
+		return err
+	}
+	return node.DictSetContext(ctx, key, dictKey, value)
+}
+
+func (s *ShardedProvider) DictGet(key string, dictKey string) (string, error) {
+	return s.DictGetContext(context.Background(), key, dictKey)
+}
+
+func (s *ShardedProvider) DictGetContext(ctx context.Context, key string, dictKey string) (string, error) {
+	node, err := s.node(key)
+	if err != nil {
+		return "", err
+	}
+	return node.DictGetContext(ctx, key, dictKey)
+}
+
+func (s *ShardedProvider) DictRemove(key string, dictKey string) error {
+	return s.DictRemoveContext(context.Background(), key, dictKey)
+}
+
+func (s *ShardedProvider) DictRemoveContext(ctx context.Context, key string, dictKey string) error {
+	node, err := s.node(key)
+	if err != nil {
+		return err
+	}
+	return node.DictRemoveContext(ctx, key, dictKey)
+}
+
+func (s *ShardedProvider) DictHasKey(key string, dictKey string) (bool, error) {
+	return s.DictHasKeyContext(context.Background(), key, dictKey)
+}
+
+func (s *ShardedProvider) DictHasKeyContext(ctx context.Context, key string, dictKey string) (bool, error) {
+	node, err := s.node(key)
+	if err != nil {
+		return false, err
+	}
+	return node.DictHasKeyContext(ctx, key, dictKey)
+}
+
+func (s *ShardedProvider) SetExpiry(key string, ttl time.Duration) error {
+	return s.SetExpiryContext(context.Background(), key, ttl)
+}
+
+func (s *ShardedProvider) SetExpiryContext(ctx context.Context, key string, ttl time.Duration) error {
+	node, err := s.node(key)
+	if err != nil {
+		return err
+	}
+	return node.SetExpiryContext(ctx, key, ttl)
+}
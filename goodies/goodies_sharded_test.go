@@ -0,0 +1,66 @@
+package goodies
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestShardedProviderRouting(testing *testing.T) {
+	sharded := NewShardedProvider(DefaultVirtualNodes)
+	storages := map[string]*GoodiesStorage{}
+	for _, name := range []string{"a", "b", "c"} {
+		storages[name] = NewGoodiesStorage(ExpireNever)
+		sharded.AddNode(name, storages[name])
+	}
+
+	for i := 0; i < 300; i++ {
+		key := "key" + strconv.Itoa(i)
+		sharded.Set(key, key, ExpireNever)
+		node, _ := sharded.NodeFor(key)
+		if val, err := storages[node].Get(key); err != nil || val != key {
+			testing.Fatalf("Key %v was not stored on its owner %v", key, node)
+		}
+	}
+	for name, storage := range storages {
+		if keys, _ := storage.Keys(); len(keys) < 50 {
+			testing.Errorf("Node %v received only %v keys out of 300", name, len(keys))
+		}
+	}
+	if keys, err := sharded.Keys(); err != nil || len(keys) != 300 {
+		testing.Errorf("Expected 300 keys from all nodes but received %v (%v)", len(keys), err)
+	}
+}
+
+func TestShardedProviderMinimalMovement(testing *testing.T) {
+	sharded := NewShardedProvider(DefaultVirtualNodes)
+	for _, name := range []string{"a", "b", "c"} {
+		sharded.AddNode(name, NewGoodiesStorage(ExpireNever))
+	}
+	owners := map[string]string{}
+	for i := 0; i < 10000; i++ {
+		key := "key" + strconv.Itoa(i)
+		owners[key], _ = sharded.NodeFor(key)
+	}
+
+	sharded.AddNode("d", NewGoodiesStorage(ExpireNever))
+	moved := 0
+	for key, owner := range owners {
+		node, _ := sharded.NodeFor(key)
+		if node != owner {
+			if node != "d" {
+				testing.Fatalf("Key %v moved between existing nodes %v -> %v", key, owner, node)
+			}
+			moved++
+		}
+	}
+	if moved < 1500 || moved > 3500 {
+		testing.Errorf("Expected about a quarter of keys to move to the new node but %v of 10000 moved", moved)
+	}
+
+	sharded.RemoveNode("d")
+	for key, owner := range owners {
+		if node, _ := sharded.NodeFor(key); node != owner {
+			testing.Fatalf("Key %v didn't return to %v after node removal", key, owner)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package goodies
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	subscribePath = "/subscribe"
+	watchPath     = "/watch"
+)
+
+// sseStream Writes server-sent events into a streaming http response
+type sseStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// newSSEStream Sends event stream headers to the client so it knows the stream is established
+func newSSEStream(w http.ResponseWriter) (*sseStream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, ErrInternalError{"Streaming is not supported by the connection"}
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &sseStream{w, flusher}, nil
+}
+
+// Send Writes a single event with a JSON payload
+func (s *sseStream) Send(event string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return ErrTransformation{err.Error()}
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %v\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// readSSE Reads server-sent events until the stream ends or handler asks to stop
+func readSSE(r io.Reader, handler func(event string, data []byte) bool) error {
+	reader := bufio.NewReader(r)
+	var event string
+	var data []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			if len(data) > 0 && !handler(event, []byte(strings.Join(data, "\n"))) {
+				return nil
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(line[len("event:"):])
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(line[len("data:"):], " "))
+		}
+	}
+}
+
+// serveSubscribe Streams published messages for channel and pattern query parameters
+// e.g. GET /subscribe?channel=news&pattern=invalidate:*
+func (s *goodiesHTTPServer) serveSubscribe(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	channels, patterns := query["channel"], query["pattern"]
+	if len(channels) == 0 && len(patterns) == 0 {
+		http.Error(w, ErrCommandArgumentsMismatch{"At least one channel or pattern is expected"}.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validatePatterns(patterns); err != nil {
+		http.Error(w, err.Error(), statusForError(err))
+		return
+	}
+	subscription := s.pubsub.subscribe(channels, patterns)
+	defer subscription.Close()
+
+	stream, err := newSSEStream(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for {
+		select {
+		case msg := <-subscription.Messages():
+			if err := stream.Send("message", msg); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		}
+	}
+}
+
+// serveWatch Streams key events for the prefix query parameter, e.g. GET /watch?prefix=user:
+func (s *goodiesHTTPServer) serveWatch(w http.ResponseWriter, r *http.Request) {
+	acl, restricted := aclOf(s.storage, r.Context())
+	if restricted && !acl.allowsCommand("Get") {
+		identity, _ := identityFrom(r.Context())
+		err := ErrForbidden{fmt.Sprintf("%v is not allowed to watch keys", identity)}
+		http.Error(w, err.Error(), statusForError(err))
+		return
+	}
+	storage := s.storage
+	if set, ok := storage.(databases); ok {
+		database, err := set.Database(r.Header.Get(DatabaseHeader))
+		if err != nil {
+			http.Error(w, err.Error(), statusForError(err))
+			return
+		}
+		storage = database
+	}
+	watchable, ok := storage.(Watchable)
+	if !ok {
+		http.Error(w, ErrInternalError{"Storage doesn't support watching"}.Error(), http.StatusNotImplemented)
+		return
+	}
+	watcher, err := watchable.Watch(r.URL.Query().Get("prefix"))
+	if err != nil {
+		http.Error(w, err.Error(), statusForError(err))
+		return
+	}
+	defer watcher.Close()
+
+	stream, err := newSSEStream(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for {
+		select {
+		case event, ok := <-watcher.Events():
+			if !ok {
+				// watcher was lost, client has to reconnect and resync
+				return
+			}
+			if restricted && !acl.allowsKey(event.Key) {
+				continue
+			}
+			if err := stream.Send("key", event); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		}
+	}
+}
+
+// openStream Starts a streaming GET request to the server path relative to client address
+// Stream lives until ctx is cancelled
+func (tr GoodiesHttpCommandClient) openStream(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	base, err := url.Parse(tr.address)
+	if err != nil {
+		return nil, ErrInternalError{err.Error()}
+	}
+	target := base.ResolveReference(&url.URL{Path: strings.TrimPrefix(path, "/"), RawQuery: query.Encode()})
+
+	httpRequest, err := http.NewRequestWithContext(ctx, "GET", target.String(), nil)
+	if err != nil {
+		return nil, ErrInternalError{err.Error()}
+	}
+	httpRequest.Header.Set("Accept", "text/event-stream")
+	tr.credentials.authorize(httpRequest)
+	if tr.database != "" {
+		httpRequest.Header.Set(DatabaseHeader, tr.database)
+	}
+	resp, err := tr.client.Do(httpRequest)
+	if err != nil {
+		return nil, ErrInternalError{err.Error()}
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, ErrorFromString(strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// subscribe Opens subscription stream and delivers received messages into a Subscription
+func (tr GoodiesHttpCommandClient) subscribe(channels []string, patterns []string) (*Subscription, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	query := url.Values{"channel": channels, "pattern": patterns}
+	resp, err := tr.openStream(ctx, subscribePath, query)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	subscription := newSubscription()
+	subscription.unsubscribe = cancel
+	go func() {
+		defer close(subscription.messages)
+		defer resp.Body.Close()
+		err := readSSE(resp.Body, func(event string, data []byte) bool {
+			var msg Message
+			if event != "message" || json.Unmarshal(data, &msg) != nil {
+				return true
+			}
+			select {
+			case subscription.messages <- msg:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+		if ctx.Err() == nil {
+			subscription.setErr(ErrInternalError{fmt.Sprintf("Subscription stream ended: %v", err)})
+		}
+	}()
+	return subscription, nil
+}
+
+// watch Opens key events stream and delivers received events into a Watcher
+func (tr GoodiesHttpCommandClient) watch(prefix string) (*Watcher, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	resp, err := tr.openStream(ctx, watchPath, url.Values{"prefix": []string{prefix}})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	watcher := newWatcher()
+	watcher.stop = cancel
+	go func() {
+		defer close(watcher.events)
+		defer resp.Body.Close()
+		err := readSSE(resp.Body, func(event string, data []byte) bool {
+			var keyEvent KeyEvent
+			if event != "key" || json.Unmarshal(data, &keyEvent) != nil {
+				return true
+			}
+			select {
+			case watcher.events <- keyEvent:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+		if ctx.Err() == nil {
+			watcher.setErr(ErrInternalError{fmt.Sprintf("Watch stream ended: %v", err)})
+		}
+	}()
+	return watcher, nil
+}
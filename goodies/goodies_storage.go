@@ -12,6 +12,11 @@ type GoodiesStorage struct {
 	storage       map[string]goodiesItem
 	lock          sync.RWMutex
 	defaultExpiry time.Duration
+	watchers      keyWatchers
+	databases     *databaseSet
+	state         serverState
+	// observers are notified about sizes of changed keys, guarded by lock
+	observers map[*sizeObserver]bool
 }
 
 // goodiesItem is internal Goodies item
@@ -26,10 +31,26 @@ func NewGoodiesStorage(ttl time.Duration) *GoodiesStorage {
 	goodies := &GoodiesStorage{
 		storage:       initialStorage,
 		defaultExpiry: ttl,
+		watchers:      keyWatchers{watchers: make(map[*Watcher]string)},
+		databases:     &databaseSet{named: make(map[string]*GoodiesStorage)},
 	}
 	return goodies
 }
 
+// DefaultExpiry Returns ttl of items stored with ExpireDefault
+func (g *GoodiesStorage) DefaultExpiry() time.Duration {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	return g.defaultExpiry
+}
+
+// SetDefaultExpiry Changes ttl of items stored with ExpireDefault from now on, stored items keep their expiry
+func (g *GoodiesStorage) SetDefaultExpiry(ttl time.Duration) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.defaultExpiry = ttl
+}
+
 func (g *GoodiesStorage) newItem(value interface{}, ttl time.Duration) goodiesItem {
 	return goodiesItem{
 		Value:  value,
@@ -49,7 +70,9 @@ func (g *GoodiesStorage) Set(key string, value string, ttl time.Duration) error
 	g.lock.Lock()
 	defer g.lock.Unlock()
 	//TODO: disallow key to contain ',' for keys serialisation simplification
+	g.internalExpire(key)
 	g.internalSet(key, value, ttl)
+	g.emit(KeySet, key)
 	return nil
 }
 
@@ -59,6 +82,7 @@ func (g *GoodiesStorage) internalSet(key string, value string, ttl time.Duration
 
 // Get Method
 func (g *GoodiesStorage) Get(key string) (string, error) {
+	defer g.removeIfExpired(key)
 	g.lock.RLock()
 	defer g.lock.RUnlock()
 	return g.internalGetString(key)
@@ -70,11 +94,13 @@ func (g *GoodiesStorage) Get(key string) (string, error) {
 func (g *GoodiesStorage) Update(key string, value string, ttl time.Duration) error {
 	g.lock.Lock()
 	defer g.lock.Unlock()
+	g.internalExpire(key)
 	_, err := g.internalGetString(key)
 	if err != nil {
 		return err
 	}
 	g.internalSet(key, value, ttl)
+	g.emit(KeyUpdated, key)
 	return nil
 }
 
@@ -82,7 +108,11 @@ func (g *GoodiesStorage) Update(key string, value string, ttl time.Duration) err
 func (g *GoodiesStorage) Remove(key string) error {
 	g.lock.Lock()
 	defer g.lock.Unlock()
-	g.internalRemove(key)
+	g.internalExpire(key)
+	if _, found := g.storage[key]; found {
+		g.internalRemove(key)
+		g.emit(KeyRemoved, key)
+	}
 	return nil
 }
 
@@ -90,15 +120,39 @@ func (g *GoodiesStorage) internalRemove(key string) {
 	delete(g.storage, key)
 }
 
+// internalExpire Removes the item if it is outdated notifying watchers about expiry
+// Should be called under write lock before modifying an item
+func (g *GoodiesStorage) internalExpire(key string) {
+	if val, found := g.storage[key]; found && checkExpiry(val.Expiry) {
+		g.internalRemove(key)
+		g.emit(KeyExpired, key)
+	}
+}
+
+// removeIfExpired Lazily removes an outdated item found by read operations
+// Must be called without holding a lock
+func (g *GoodiesStorage) removeIfExpired(key string) {
+	g.lock.RLock()
+	val, found := g.storage[key]
+	g.lock.RUnlock()
+	if !found || !checkExpiry(val.Expiry) {
+		return
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.internalExpire(key)
+}
+
 // Keys returns list of keys
 func (g *GoodiesStorage) Keys() ([]string, error) {
 	g.lock.RLock()
 	defer g.lock.RUnlock()
-	keys := make([]string, len(g.storage))
-	i := 0
-	for k := range g.storage {
-		keys[i] = k
-		i++
+	keys := make([]string, 0, len(g.storage))
+	for k, v := range g.storage {
+		if checkExpiry(v.Expiry) {
+			continue
+		}
+		keys = append(keys, k)
 	}
 	return keys, nil
 }
@@ -108,12 +162,29 @@ func (g *GoodiesStorage) Keys() ([]string, error) {
 func (g *GoodiesStorage) ListPush(key string, value string) error {
 	g.lock.Lock()
 	defer g.lock.Unlock()
+	return g.internalListPush(key, value)
+}
+
+// listPushWithExpiry Adds a value into the end of list and sets ttl of the list at once
+func (g *GoodiesStorage) listPushWithExpiry(key string, value string, ttl time.Duration) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if err := g.internalListPush(key, value); err != nil {
+		return err
+	}
+	return g.internalSetExpiry(key, ttl)
+}
+
+// internalListPush Should be called under write lock
+func (g *GoodiesStorage) internalListPush(key string, value string) error {
+	g.internalExpire(key)
 
 	list, err := g.internalGetList(key)
 	if err != nil {
 		switch err.(type) {
 		case ErrNotFound:
 			g.storage[key] = g.newItem(createList(value), g.defaultExpiry)
+			g.emit(KeySet, key)
 			return nil
 		default:
 			return err
@@ -122,12 +193,17 @@ func (g *GoodiesStorage) ListPush(key string, value string) error {
 
 	list = append(list, value)
 	g.storage[key] = newItemWithExpiry(list, g.storage[key].Expiry)
+	g.emit(KeyUpdated, key)
 	return nil
 }
 
 // ListLen Returns the length of list. Returns 0 if list not found
 // Returns error if value stored is not a list
 func (g *GoodiesStorage) ListLen(key string) (int, error) {
+	defer g.removeIfExpired(key)
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
 	list, err := g.internalGetList(key)
 	if err != nil {
 		switch err.(type) {
@@ -147,6 +223,7 @@ func (g *GoodiesStorage) ListLen(key string) (int, error) {
 func (g *GoodiesStorage) ListRemoveIndex(key string, index int) error {
 	g.lock.Lock()
 	defer g.lock.Unlock()
+	g.internalExpire(key)
 	list, err := g.internalGetList(key)
 	if err != nil {
 		switch err.(type) {
@@ -156,12 +233,13 @@ func (g *GoodiesStorage) ListRemoveIndex(key string, index int) error {
 			return err
 		}
 	}
-	if len(list) <= index {
+	if index < 0 || len(list) <= index {
 		return nil
 	}
 	g.storage[key] = newItemWithExpiry(
 		append(list[:index], list[index+1:]...),
 		g.storage[key].Expiry)
+	g.emit(KeyUpdated, key)
 	return nil
 }
 
@@ -170,6 +248,7 @@ func (g *GoodiesStorage) ListRemoveIndex(key string, index int) error {
 func (g *GoodiesStorage) ListRemoveValue(key string, value string) error {
 	g.lock.Lock()
 	defer g.lock.Unlock()
+	g.internalExpire(key)
 
 	list, err := g.internalGetList(key)
 	if err != nil {
@@ -190,12 +269,16 @@ func (g *GoodiesStorage) ListRemoveValue(key string, value string) error {
 	}
 
 	g.storage[key] = newItemWithExpiry(result, g.storage[key].Expiry)
+	if len(result) != len(list) {
+		g.emit(KeyUpdated, key)
+	}
 	return nil
 }
 
 // ListGetByIndex Returns an item from a referenced list by index
 // Returns ErrNotFound in case if list was not found, ErrTypeMismatch in case if referenced item is not a list
 func (g *GoodiesStorage) ListGetByIndex(key string, index int) (string, error) {
+	defer g.removeIfExpired(key)
 	g.lock.RLock()
 	defer g.lock.RUnlock()
 
@@ -204,17 +287,47 @@ func (g *GoodiesStorage) ListGetByIndex(key string, index int) (string, error) {
 		return "", err
 	}
 
-	if len(list) <= index {
+	if index < 0 || len(list) <= index {
 		return "", nil
 	}
 	return list[index], nil
 }
 
+// ListGetAll Returns a copy of all items of a referenced list
+// Returns ErrNotFound in case if list was not found, ErrTypeMismatch in case if referenced item is not a list
+func (g *GoodiesStorage) ListGetAll(key string) ([]string, error) {
+	defer g.removeIfExpired(key)
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	list, err := g.internalGetList(key)
+	if err != nil {
+		return nil, err
+	}
+	return append([]string{}, list...), nil
+}
+
 // DictSet Sets a value for a specific dictionary key in storage
 // Returns an error if referenced item is not a dictionary
 func (g *GoodiesStorage) DictSet(key string, dictKey string, value string) error {
 	g.lock.Lock()
 	defer g.lock.Unlock()
+	return g.internalDictSet(key, dictKey, value)
+}
+
+// dictSetWithExpiry Sets a value for a dictionary key and ttl of the dictionary at once
+func (g *GoodiesStorage) dictSetWithExpiry(key string, dictKey string, value string, ttl time.Duration) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if err := g.internalDictSet(key, dictKey, value); err != nil {
+		return err
+	}
+	return g.internalSetExpiry(key, ttl)
+}
+
+// internalDictSet Should be called under write lock
+func (g *GoodiesStorage) internalDictSet(key string, dictKey string, value string) error {
+	g.internalExpire(key)
 
 	dict, err := g.internalGetDict(key)
 	if err != nil {
@@ -223,20 +336,23 @@ func (g *GoodiesStorage) DictSet(key string, dictKey string, value string) error
 			dict := make(map[string]string, 1)
 			dict[dictKey] = value
 			g.storage[key] = g.newItem(dict, g.defaultExpiry)
+			g.emit(KeySet, key)
 			return nil
 		default:
 			return err
 		}
 	}
 
-	dict[key] = value
+	dict[dictKey] = value
 	g.storage[key] = newItemWithExpiry(dict, g.storage[key].Expiry)
+	g.emit(KeyUpdated, key)
 	return nil
 }
 
 // DictGet returns a value for a dictionary by a key
 // Returns an error if referenced item is not a dictionary
 func (g *GoodiesStorage) DictGet(key string, dictKey string) (string, error) {
+	defer g.removeIfExpired(key)
 	g.lock.RLock()
 	defer g.lock.RUnlock()
 
@@ -254,19 +370,24 @@ func (g *GoodiesStorage) DictGet(key string, dictKey string) (string, error) {
 // DictRemove Remove a specific key from a dictionary
 // Returns an error if referenced item is not a dictionary
 func (g *GoodiesStorage) DictRemove(key string, dictKey string) error {
-	g.lock.RLock()
-	defer g.lock.RUnlock()
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.internalExpire(key)
 
 	dict, err := g.internalGetDict(key)
 	if err != nil {
 		return err
 	}
-	delete(dict, dictKey)
+	if _, ok := dict[dictKey]; ok {
+		delete(dict, dictKey)
+		g.emit(KeyUpdated, key)
+	}
 	return nil
 }
 
 // DictHasKey Can be used to retreive key existence in a dictionary
 func (g *GoodiesStorage) DictHasKey(key string, dictKey string) (bool, error) {
+	defer g.removeIfExpired(key)
 	g.lock.RLock()
 	defer g.lock.RUnlock()
 
@@ -283,6 +404,12 @@ func (g *GoodiesStorage) DictHasKey(key string, dictKey string) (bool, error) {
 func (g *GoodiesStorage) SetExpiry(key string, ttl time.Duration) error {
 	g.lock.Lock()
 	defer g.lock.Unlock()
+	return g.internalSetExpiry(key, ttl)
+}
+
+// internalSetExpiry Should be called under write lock
+func (g *GoodiesStorage) internalSetExpiry(key string, ttl time.Duration) error {
+	g.internalExpire(key)
 
 	value, ok := g.internalGet(key)
 
@@ -290,6 +417,7 @@ func (g *GoodiesStorage) SetExpiry(key string, ttl time.Duration) error {
 		return &ErrTypeMismatch{fmt.Sprintf("Item %v doesn't exist", key)}
 	}
 	g.storage[key] = g.newItem(value, ttl)
+	g.emit(KeyUpdated, key)
 	return nil
 }
 
@@ -298,7 +426,7 @@ func (g *GoodiesStorage) internalGetString(key string) (string, error) {
 	if !found {
 		return "", ErrNotFound{key}
 	}
-	isString := checkValueIsString(key)
+	isString := checkValueIsString(val)
 	if !isString {
 		return "", ErrTypeMismatch{fmt.Sprintf("Requested item is not a string")}
 	}
@@ -311,7 +439,7 @@ func (g *GoodiesStorage) internalGet(key string) (interface{}, bool) {
 		return nil, false
 	}
 	if expired := checkExpiry(val.Expiry); expired {
-		g.internalRemove(key)
+		// outdated items are removed by writers, removeIfExpired or cleanup
 		return nil, false
 	}
 	return val.Value, found
@@ -341,23 +469,54 @@ func (g *GoodiesStorage) internalGetDict(key string) (map[string]string, error)
 	return value.(map[string]string), nil
 }
 
+// internalReplaceItems Replaces all items notifying watchers about every key loaded or removed
+// Must be called under write lock
+func (g *GoodiesStorage) internalReplaceItems(items map[string]goodiesItem) {
+	previous := g.storage
+	g.storage = items
+	for key := range previous {
+		if _, kept := items[key]; !kept {
+			g.emit(KeyRemoved, key)
+		}
+	}
+	for key := range items {
+		if _, existed := previous[key]; existed {
+			g.emit(KeyUpdated, key)
+		} else {
+			g.emit(KeySet, key)
+		}
+	}
+}
+
+// cleanupOutdated Removes expired items of the storage and of all its databases
 // TODO: make cleanup strategy to run every 2 x defaultExpiration or each 10k items
 func (g *GoodiesStorage) cleanupOutdated() {
+	g.removeOutdated()
+	if g.databases == nil {
+		return
+	}
+	g.databases.lock.RLock()
+	named := make([]*GoodiesStorage, 0, len(g.databases.named))
+	for _, database := range g.databases.named {
+		named = append(named, database)
+	}
+	g.databases.lock.RUnlock()
+	for _, database := range named {
+		database.removeOutdated()
+	}
+}
+
+func (g *GoodiesStorage) removeOutdated() {
 	g.lock.Lock()
 	defer g.lock.Unlock()
 	for key, value := range g.storage {
 		if checkExpiry(value.Expiry) {
 			g.internalRemove(key)
+			g.emit(KeyExpired, key)
 		}
 	}
 }
 
-func (g *GoodiesStorage) getBlob() *map[string]goodiesItem {
-	g.lock.Lock()
-	defer g.lock.Unlock()
-	return &g.storage
-}
-
 func getExpiry(ttl time.Duration, def time.Duration) int64 {
 	var expiry int64
 	if ttl == ExpireDefault {
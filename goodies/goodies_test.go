@@ -1,6 +1,8 @@
 package goodies
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -80,6 +82,43 @@ func TestGoodiesPersisted(testing *testing.T) {
 	goodies2.Stop()
 }
 
+func TestPersistedUnreadableSnapshot(testing *testing.T) {
+	filename := filepath.Join(testing.TempDir(), "goodies.dat")
+	os.WriteFile(filename, []byte("not a snapshot"), 0600)
+	if _, err := OpenGoodiesPersistedStorage(ExpireNever, filename, time.Hour, nil); err == nil {
+		testing.Error("Unreadable snapshot is expected to be reported")
+	}
+	persisted := NewGoodiesPersistedStorage(ExpireNever, filename, time.Hour)
+	persisted.Set("key", "value", ExpireNever)
+	persisted.Stop()
+	if data, _ := os.ReadFile(filename); string(data) != "not a snapshot" {
+		testing.Errorf("Unreadable snapshot is not expected to be overwritten: %q", data)
+	}
+}
+
+func TestPersistIntervalAfterStop(testing *testing.T) {
+	persisted, err := OpenGoodiesPersistedStorage(ExpireNever, filepath.Join(testing.TempDir(), "goodies.dat"), time.Hour, nil)
+	if err != nil {
+		testing.Fatalf("Unexpected error: %v", err)
+	}
+	persisted.(Persister).SetPersistInterval(time.Minute)
+	persisted.Stop()
+	changed := make(chan struct{})
+	go func() {
+		persisted.(Persister).SetPersistInterval(time.Second)
+		persisted.(Persister).SetPersistInterval(2 * time.Second)
+		close(changed)
+	}()
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		testing.Fatal("Setting the interval is not expected to wait for a stopped persister")
+	}
+	if interval := persisted.(Persister).PersistInterval(); interval != 2*time.Second {
+		testing.Errorf("Latest interval is expected to be kept, got %v", interval)
+	}
+}
+
 func TestGoodiesNotAListError(testing *testing.T) {
 	goodies := NewGoodiesStorage(25 * time.Millisecond)
 	goodies.Set("value", "1", ExpireNever)
@@ -170,6 +209,12 @@ func TestGoodiesSimpleListOps(testing *testing.T) {
 	if err4 != nil {
 		testing.Error("Unexpected behaviour for removing non-existent list item by index")
 	}
+	if err := goodies.ListRemoveIndex(key, -1); err != nil {
+		testing.Error("Unexpected behaviour for removing list item by negative index")
+	}
+	if val, err := goodies.ListGetByIndex(key, -1); err != nil || val != "" {
+		testing.Error("Unexpected behaviour for getting list item by negative index")
+	}
 
 	notListKey := "not a list"
 	goodies.Set(notListKey, "I am string!", ExpireDefault)
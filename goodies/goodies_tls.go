@@ -0,0 +1,256 @@
+package goodies
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// TLSClientAuthRequest Client certificates are verified if presented, clients without one use other credentials
+	TLSClientAuthRequest = "request"
+	// TLSClientAuthRequire Connections without a verified client certificate are refused
+	TLSClientAuthRequire = "require"
+
+	// tlsReloadCheckInterval Files are checked for changes at most this often, on handshakes
+	tlsReloadCheckInterval = time.Second
+)
+
+// TLSConfig Configures TLS of the server, verified client certificates authenticate the common name of
+// their subject (e.g. to be restricted by an ACL)
+// Files are reloaded once they change, so rotated certificates are served without a restart
+type TLSConfig struct {
+	// CertFile PEM certificate chain served to clients and presented to other nodes, enables TLS
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	// ClientCAFile PEM bundle of CAs verifying client certificates
+	ClientCAFile string `json:"clientCAFile,omitempty"`
+	// ClientAuth Verification of client certificates (TLSClientAuthRequest, TLSClientAuthRequire), none if empty
+	ClientAuth string `json:"clientAuth,omitempty"`
+	// PeerCAFile PEM bundle of CAs verifying other nodes (leader, migration targets), system roots if empty
+	PeerCAFile string `json:"peerCAFile,omitempty"`
+}
+
+// Enabled Reports if the server is served over TLS
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+func (c TLSConfig) validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return ErrInvalidConfig{"tls certFile and keyFile have to be set together"}
+	}
+	switch c.ClientAuth {
+	case "":
+	case TLSClientAuthRequest, TLSClientAuthRequire:
+		if c.ClientCAFile == "" {
+			return ErrInvalidConfig{"tls clientAuth requires clientCAFile"}
+		}
+	default:
+		return ErrInvalidConfig{fmt.Sprintf("unknown tls clientAuth %q (expected %v or %v)", c.ClientAuth, TLSClientAuthRequest, TLSClientAuthRequire)}
+	}
+	if !c.Enabled() && (c.ClientCAFile != "" || c.ClientAuth != "") {
+		return ErrInvalidConfig{"tls client verification requires certFile"}
+	}
+	return nil
+}
+
+// loadedTLS Contents of TLS files
+type loadedTLS struct {
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+	clientAuth  tls.ClientAuthType
+	peerCAs     *x509.CertPool
+	// modified Latest modification time of the files
+	modified time.Time
+}
+
+func (c TLSConfig) files() []string {
+	return []string{c.CertFile, c.KeyFile, c.ClientCAFile, c.PeerCAFile}
+}
+
+func loadTLS(config TLSConfig) (loadedTLS, error) {
+	loaded := loadedTLS{modified: latestModification(config.files())}
+	if config.Enabled() {
+		certificate, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return loaded, ErrInvalidConfig{fmt.Sprintf("tls certificate: %v", err)}
+		}
+		loaded.certificate = &certificate
+	}
+	var err error
+	if loaded.clientCAs, err = loadCertPool(config.ClientCAFile); err != nil {
+		return loaded, err
+	}
+	if loaded.peerCAs, err = loadCertPool(config.PeerCAFile); err != nil {
+		return loaded, err
+	}
+	switch config.ClientAuth {
+	case TLSClientAuthRequest:
+		loaded.clientAuth = tls.VerifyClientCertIfGiven
+	case TLSClientAuthRequire:
+		loaded.clientAuth = tls.RequireAndVerifyClientCert
+	}
+	return loaded, nil
+}
+
+// loadCertPool Returns CAs of the PEM bundle, nil for an empty filename
+func loadCertPool(filename string) (*x509.CertPool, error) {
+	if filename == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, ErrInvalidConfig{fmt.Sprintf("tls CA bundle: %v", err)}
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, ErrInvalidConfig{fmt.Sprintf("tls CA bundle %v has no certificates", filename)}
+	}
+	return pool, nil
+}
+
+func latestModification(files []string) time.Time {
+	var latest time.Time
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// tlsFiles TLS files of the server reloaded once they change
+type tlsFiles struct {
+	lock    sync.Mutex
+	config  TLSConfig
+	loaded  loadedTLS
+	checked time.Time
+}
+
+func newTLSFiles(config TLSConfig) (*tlsFiles, error) {
+	files := &tlsFiles{}
+	return files, files.update(config)
+}
+
+// update Loads files of the config, the current ones are kept if any of them is invalid
+func (f *tlsFiles) update(config TLSConfig) error {
+	loaded, err := loadTLS(config)
+	if err != nil {
+		return err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.config, f.loaded, f.checked = config, loaded, time.Now()
+	return nil
+}
+
+// current Returns loaded files, reloading them if any changed, files failing to load are reported and skipped
+// until they change again
+func (f *tlsFiles) current() loadedTLS {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if time.Since(f.checked) < tlsReloadCheckInterval {
+		return f.loaded
+	}
+	f.checked = time.Now()
+	if modified := latestModification(f.config.files()); modified.After(f.loaded.modified) {
+		loaded, err := loadTLS(f.config)
+		if err != nil {
+			fmt.Printf("TLS files not reloaded %v\n", err)
+			f.loaded.modified = modified
+			return f.loaded
+		}
+		f.loaded = loaded
+	}
+	return f.loaded
+}
+
+// serverConfig Returns TLS configuration of the listener, every handshake uses the current files
+func (f *tlsFiles) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			loaded := f.current()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*loaded.certificate},
+				ClientCAs:    loaded.clientCAs,
+				ClientAuth:   loaded.clientAuth,
+			}, nil
+		},
+	}
+}
+
+// peerConfig Returns TLS configuration of connections to other nodes, the server certificate is their client certificate
+func (f *tlsFiles) peerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    f.current().peerCAs,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if certificate := f.current().certificate; certificate != nil {
+				return certificate, nil
+			}
+			return &tls.Certificate{}, nil
+		},
+	}
+}
+
+// certificateIdentity Returns the common name of the verified client certificate of the request
+func certificateIdentity(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	identity := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	return identity, identity != ""
+}
+
+// setTLS Loads TLS files of the config (reloading them if they are loaded already) and returns the listener configuration
+func (s *goodiesHTTPServer) setTLS(config TLSConfig) (*tls.Config, error) {
+	if files := s.replication.peerTLS.Load(); files != nil {
+		if err := files.update(config); err != nil {
+			return nil, err
+		}
+		return files.serverConfig(), nil
+	}
+	files, err := newTLSFiles(config)
+	if err != nil {
+		return nil, err
+	}
+	s.replication.peerTLS.Store(files)
+	return files.serverConfig(), nil
+}
+
+// WithTLSConfig Connects to the server over TLS configured by config, e.g. with RootCAs trusting the server
+// certificate and Certificates presenting a client certificate
+func WithTLSConfig(config *tls.Config) ClientOption {
+	return func(options *clientOptions) {
+		options.tls = config
+	}
+}
+
+// httpClient Returns HTTP client using the TLS configuration (the default one if config is nil) and dialling
+// the unix socket instead of hosts of requests if socket is set
+func httpClient(config *tls.Config, socket string) http.Client {
+	if config == nil && socket == "" {
+		return http.Client{}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	if socket != "" {
+		transport.DialContext = func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+	}
+	return http.Client{Transport: transport}
+}
@@ -0,0 +1,195 @@
+package goodies
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCertificate Self-signed CA or a certificate issued by it, written as PEM files
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	certFile    string
+	keyFile     string
+}
+
+func newTestCertificate(testing *testing.T, dir string, name string, serial int64, issuer *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		testing.Fatalf("Cannot generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	parent, signer := template, key
+	if issuer == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+	} else {
+		parent, signer = issuer.certificate, issuer.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		testing.Fatalf("Cannot create certificate: %v", err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	result := &testCertificate{certificate, key, filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")}
+	os.WriteFile(result.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(result.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return result
+}
+
+func (c *testCertificate) tlsCertificate(testing *testing.T) tls.Certificate {
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		testing.Fatalf("Cannot load certificate: %v", err)
+	}
+	return certificate
+}
+
+func startTLSServer(testing *testing.T, config ServerConfig) (string, func()) {
+	server, storage, err := NewGoodiesConfiguredServer(config)
+	if err != nil {
+		testing.Fatalf("Cannot create server: %v", err)
+	}
+	listener, err := net.Listen("tcp", config.Listen)
+	if err != nil {
+		testing.Fatalf("Cannot listen: %v", err)
+	}
+	go server.ServeTLS(listener, "", "")
+	return "https://" + listener.Addr().String() + "/", func() {
+		server.Close()
+		if stoppable, ok := storage.(StoppableProvider); ok {
+			stoppable.Stop()
+		}
+	}
+}
+
+func TestTLSClientCertificateIdentity(testing *testing.T) {
+	dir := testing.TempDir()
+	ca := newTestCertificate(testing, dir, "ca", 1, nil)
+	serverCert := newTestCertificate(testing, dir, "server", 2, ca)
+	reporting := newTestCertificate(testing, dir, "reporting", 3, ca)
+
+	config := DefaultServerConfig()
+	config.Listen = "127.0.0.1:0"
+	config.Persistence.Mode = PersistenceNone
+	config.TLS = TLSConfig{CertFile: serverCert.certFile, KeyFile: serverCert.keyFile, ClientCAFile: ca.certFile, ClientAuth: TLSClientAuthRequest}
+	config.Auth.Tokens = map[string]string{"admin": HashToken("admin-token")}
+	address, stop := startTLSServer(testing, config)
+	defer stop()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.certificate)
+	if err := NewGoodiesClient(address).Set("key", "value", ExpireNever); err == nil {
+		testing.Error("Server certificate is not expected to be trusted without its CA")
+	}
+	admin := NewGoodiesClient(address, WithTLSConfig(&tls.Config{RootCAs: roots}), WithToken("admin-token"))
+	if err := admin.Set("report:daily", "42", ExpireNever); err != nil {
+		testing.Fatalf("Unexpected error over TLS: %v", err)
+	}
+	sentinel, _ := NewSentinel([]string{address}, time.Second, 1, WithTLSConfig(&tls.Config{RootCAs: roots}), WithToken("admin-token"))
+	if sentinel.Check(); sentinel.Leader() != address {
+		testing.Error("Sentinel is expected to check nodes over TLS")
+	}
+	if err := admin.(ACLProvider).SetACL(ACL{Identity: "reporting", Commands: []string{"Get"}, Keys: []string{"report:*"}}); err != nil {
+		testing.Fatalf("Unexpected error on set ACL: %v", err)
+	}
+
+	transport := NewGoodiesHttpCommandClient(address, &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{reporting.tlsCertificate(testing)}})
+	client := goodiesClient{transport}
+	if val, err := client.Get("report:daily"); err != nil || val != "42" {
+		testing.Errorf("Client certificate is expected to authenticate reporting: %v %v", val, err)
+	}
+	if _, forbidden := client.Set("report:daily", "0", ExpireNever).(ErrForbidden); !forbidden {
+		testing.Error("Identity of the client certificate is expected to be restricted by its ACL")
+	}
+	if _, unauthorized := NewGoodiesClient(address, WithTLSConfig(&tls.Config{RootCAs: roots})).Set("key", "v", ExpireNever).(ErrUnauthorized); !unauthorized {
+		testing.Error("Client without certificate nor token is expected to be unauthorized")
+	}
+}
+
+func TestTLSCertificateReload(testing *testing.T) {
+	dir := testing.TempDir()
+	ca := newTestCertificate(testing, dir, "ca", 1, nil)
+	first := newTestCertificate(testing, dir, "server", 2, ca)
+
+	config := DefaultServerConfig()
+	config.Listen = "127.0.0.1:0"
+	config.Persistence.Mode = PersistenceNone
+	config.TLS = TLSConfig{CertFile: first.certFile, KeyFile: first.keyFile}
+	server, storage, err := NewGoodiesConfiguredServer(config)
+	if err != nil {
+		testing.Fatalf("Cannot create server: %v", err)
+	}
+	listener, err := net.Listen("tcp", config.Listen)
+	if err != nil {
+		testing.Fatalf("Cannot listen: %v", err)
+	}
+	go server.ServeTLS(listener, "", "")
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.certificate)
+	servedSerial := func() int64 {
+		connection, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{RootCAs: roots})
+		if err != nil {
+			testing.Fatalf("Cannot connect: %v", err)
+		}
+		defer connection.Close()
+		return connection.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+	}
+	if serial := servedSerial(); serial != 2 {
+		testing.Fatalf("Expected the first certificate, got serial %v", serial)
+	}
+
+	// rotated in place, as certificate managers do
+	newTestCertificate(testing, dir, "server", 3, ca)
+	if restart := ReconfigureServer(server, storage, config, config); len(restart) != 0 {
+		testing.Errorf("Certificate reload is not expected to require restart: %v", restart)
+	}
+	if serial := servedSerial(); serial != 3 {
+		testing.Errorf("Expected the rotated certificate, got serial %v", serial)
+	}
+
+	invalid := config
+	invalid.TLS.KeyFile = first.certFile
+	if restart := ReconfigureServer(server, storage, config, invalid); len(restart) != 1 || restart[0] != "tls" {
+		testing.Errorf("Invalid files are expected to be reported: %v", restart)
+	}
+	if serial := servedSerial(); serial != 3 {
+		testing.Errorf("Invalid files are not expected to replace the served certificate, got serial %v", serial)
+	}
+}
+
+func TestTLSConfigValidation(testing *testing.T) {
+	for _, tlsConfig := range []TLSConfig{
+		{CertFile: "server.crt"},
+		{CertFile: "server.crt", KeyFile: "server.key", ClientAuth: TLSClientAuthRequire},
+		{CertFile: "server.crt", KeyFile: "server.key", ClientCAFile: "ca.crt", ClientAuth: "always"},
+		{ClientCAFile: "ca.crt", ClientAuth: TLSClientAuthRequest},
+	} {
+		config := DefaultServerConfig()
+		config.TLS = tlsConfig
+		if _, invalid := config.Validate().(ErrInvalidConfig); !invalid {
+			testing.Errorf("TLS config %+v is expected to be invalid", tlsConfig)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package goodies
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	trackingPath = "/tracking"
+
+	// trackingBufferSize Amount of invalidations kept for a slow client before it is disconnected
+	trackingBufferSize = 1024
+	// trackingRetryInterval Pause between near cache reconnection attempts
+	trackingRetryInterval = time.Second
+)
+
+// cacheableCommands Read commands which results are kept by the near cache
+var cacheableCommands = map[string]bool{
+	"Get":            true,
+	"ListLen":        true,
+	"ListGetByIndex": true,
+	"DictGet":        true,
+	"DictHasKey":     true,
+}
+
+// NearCacheConfig Configures client side cache of read command results
+// While invalidation stream is connected entries live for TTL, otherwise for FallbackTTL
+type NearCacheConfig struct {
+	// MaxKeys Amount of keys cached, the least recently used ones are evicted first
+	MaxKeys     int
+	TTL         time.Duration
+	FallbackTTL time.Duration
+}
+
+// DefaultNearCacheConfig Near cache configuration suitable for hot read-mostly keys
+var DefaultNearCacheConfig = NearCacheConfig{MaxKeys: 10000, TTL: time.Minute, FallbackTTL: time.Second}
+
+// WithNearCache Caches results of reads (Get, ListLen, ListGetByIndex, DictGet, DictHasKey) in process
+// Server tracks keys read by the client and pushes their invalidations, the stream is closed by
+// closing the client (it implements io.Closer)
+func WithNearCache(config NearCacheConfig) ClientOption {
+	return func(options *clientOptions) {
+		options.nearCache = &config
+	}
+}
+
+// tracking Keys read by near cache clients, each tracked key is invalidated once on its next change
+type tracking struct {
+	lock    sync.Mutex
+	storage Provider
+	clients map[string]chan string
+	keys    map[string]map[string]bool
+	watcher *Watcher
+}
+
+func newTracking(storage Provider) *tracking {
+	return &tracking{storage: storage, clients: make(map[string]chan string), keys: make(map[string]map[string]bool)}
+}
+
+// connect Registers the client starting to watch storage changes for the first one
+func (t *tracking) connect(id string) (chan string, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if _, exists := t.clients[id]; exists {
+		return nil, ErrCommandArgumentsMismatch{fmt.Sprintf("Tracking client %v is already connected", id)}
+	}
+	if t.watcher == nil {
+		watchable, ok := t.storage.(Watchable)
+		if !ok {
+			return nil, ErrInternalError{"Storage doesn't support tracking"}
+		}
+		watcher, err := watchable.Watch("")
+		if err != nil {
+			return nil, err
+		}
+		t.watcher = watcher
+		go t.run(watcher)
+	}
+	invalidations := make(chan string, trackingBufferSize)
+	t.clients[id] = invalidations
+	return invalidations, nil
+}
+
+// disconnect Forgets the client, stops watching storage after the last one
+func (t *tracking) disconnect(id string, invalidations chan string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.clients[id] != invalidations {
+		return
+	}
+	t.drop(id)
+	if len(t.clients) == 0 && t.watcher != nil {
+		t.watcher.Close()
+		t.watcher = nil
+	}
+}
+
+// drop Removes the client closing its invalidations channel, must be called under lock
+// Tracked keys of the client are left to be cleaned up by invalidation
+func (t *tracking) drop(id string) {
+	if invalidations, ok := t.clients[id]; ok {
+		delete(t.clients, id)
+		close(invalidations)
+	}
+}
+
+// track Remembers the key was read by the client, must be called before reading the key
+func (t *tracking) track(key string, id string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if _, connected := t.clients[id]; !connected {
+		return
+	}
+	if t.keys[key] == nil {
+		t.keys[key] = make(map[string]bool)
+	}
+	t.keys[key][id] = true
+}
+
+// run Turns storage changes into invalidations until the watcher is closed or lost
+func (t *tracking) run(watcher *Watcher) {
+	for event := range watcher.Events() {
+		t.invalidate(event.Key)
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.watcher != watcher {
+		return
+	}
+	// changes were lost, clients reconnect and start with empty caches
+	for id := range t.clients {
+		t.drop(id)
+	}
+	t.watcher = nil
+}
+
+func (t *tracking) invalidate(key string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for id := range t.keys[key] {
+		select {
+		case t.clients[id] <- key:
+		default:
+			if _, connected := t.clients[id]; connected {
+				// slow client would miss invalidations, it starts over after reconnecting
+				t.drop(id)
+			}
+		}
+	}
+	delete(t.keys, key)
+}
+
+// serveTracking Streams invalidations of keys read by the client with its tracking id
+// e.g. GET /tracking?id=<random client id>
+func (s *goodiesHTTPServer) serveTracking(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, ErrCommandArgumentsMismatch{"Tracking id is expected"}.Error(), http.StatusBadRequest)
+		return
+	}
+	invalidations, err := s.tracking.connect(id)
+	if err != nil {
+		http.Error(w, err.Error(), statusForError(err))
+		return
+	}
+	defer s.tracking.disconnect(id, invalidations)
+	stream, err := newSSEStream(w)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := stream.Send("tracking", id); err != nil {
+		return
+	}
+	for {
+		select {
+		case key, ok := <-invalidations:
+			if !ok {
+				return
+			}
+			if err := stream.Send("invalidate", key); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		}
+	}
+}
+
+// nearCacheTransport Serves repeated reads from local cache kept coherent by server invalidations
+type nearCacheTransport struct {
+	next   ContextCommandProcessor
+	stream GoodiesHttpCommandClient
+	config NearCacheConfig
+	id     string
+	start  sync.Once
+	ctx    context.Context
+	stop   context.CancelFunc
+
+	lock      sync.Mutex
+	connected bool
+	// epoch is changed by every invalidation, results of reads started in an older epoch are not cached
+	epoch   uint64
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+// nearCacheEntry Cached results of read commands of a single key
+type nearCacheEntry struct {
+	key     string
+	expires time.Time
+	results map[string]CommandResponse
+}
+
+func newNearCacheTransport(next ContextCommandProcessor, stream GoodiesHttpCommandClient, config NearCacheConfig) *nearCacheTransport {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic("Cannot generate tracking id")
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	return &nearCacheTransport{
+		next:    next,
+		stream:  stream,
+		config:  config,
+		id:      hex.EncodeToString(id),
+		ctx:     ctx,
+		stop:    stop,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (t *nearCacheTransport) Process(req CommandRequest, res *CommandResponse) error {
+	return t.ProcessContext(context.Background(), req, res)
+}
+
+func (t *nearCacheTransport) ProcessContext(ctx context.Context, req CommandRequest, res *CommandResponse) error {
+	if !keyedCommands[req.Name] || len(req.Parameters) == 0 {
+		return t.next.ProcessContext(ctx, req, res)
+	}
+	key := req.Parameters[0]
+	if !cacheableCommands[req.Name] {
+		err := t.next.ProcessContext(ctx, req, res)
+		// own writes are invalidated right away, server invalidation would come a bit later
+		t.invalidate(key)
+		return err
+	}
+
+	t.start.Do(func() { go t.maintain() })
+	signature := req.Name + "\x00" + strings.Join(req.Parameters[1:], "\x00")
+	cached, epoch := t.lookup(key, signature)
+	if cached != nil {
+		*res = *cached
+		return nil
+	}
+	req.Tracking = t.id
+	if err := t.next.ProcessContext(ctx, req, res); err != nil {
+		return err
+	}
+	if res.Success {
+		t.store(key, signature, *res, epoch)
+	}
+	return nil
+}
+
+// lookup Returns cached result and the epoch the read started in
+func (t *nearCacheTransport) lookup(key string, signature string) (*CommandResponse, uint64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	element, found := t.entries[key]
+	if !found {
+		return nil, t.epoch
+	}
+	entry := element.Value.(*nearCacheEntry)
+	if time.Now().After(entry.expires) {
+		t.lru.Remove(element)
+		delete(t.entries, key)
+		return nil, t.epoch
+	}
+	t.lru.MoveToFront(element)
+	if res, ok := entry.results[signature]; ok {
+		return &res, t.epoch
+	}
+	return nil, t.epoch
+}
+
+func (t *nearCacheTransport) store(key string, signature string, res CommandResponse, epoch uint64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if epoch != t.epoch {
+		return
+	}
+	if element, found := t.entries[key]; found {
+		element.Value.(*nearCacheEntry).results[signature] = res
+		t.lru.MoveToFront(element)
+		return
+	}
+	ttl := t.config.FallbackTTL
+	if t.connected {
+		ttl = t.config.TTL
+	}
+	entry := &nearCacheEntry{key: key, expires: time.Now().Add(ttl), results: map[string]CommandResponse{signature: res}}
+	t.entries[key] = t.lru.PushFront(entry)
+	for t.config.MaxKeys > 0 && t.lru.Len() > t.config.MaxKeys {
+		oldest := t.lru.Back()
+		t.lru.Remove(oldest)
+		delete(t.entries, oldest.Value.(*nearCacheEntry).key)
+	}
+}
+
+func (t *nearCacheTransport) invalidate(key string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.epoch++
+	if element, found := t.entries[key]; found {
+		t.lru.Remove(element)
+		delete(t.entries, key)
+	}
+}
+
+// reset Drops all entries switching between tracked and fallback modes
+func (t *nearCacheTransport) reset(connected bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.epoch++
+	t.connected = connected
+	t.lru.Init()
+	t.entries = make(map[string]*list.Element)
+}
+
+// maintain Keeps invalidation stream connected until the transport is closed
+func (t *nearCacheTransport) maintain() {
+	for {
+		err := t.receiveInvalidations()
+		t.reset(false)
+		if t.ctx.Err() != nil {
+			return
+		}
+		fmt.Printf("Near cache invalidation stream interrupted: %v\n", err)
+		select {
+		case <-time.After(trackingRetryInterval):
+		case <-t.ctx.Done():
+			return
+		}
+	}
+}
+
+func (t *nearCacheTransport) receiveInvalidations() error {
+	resp, err := t.stream.openStream(t.ctx, trackingPath, url.Values{"id": {t.id}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	err = readSSE(resp.Body, func(event string, data []byte) bool {
+		switch event {
+		case "tracking":
+			t.reset(true)
+		case "invalidate":
+			var key string
+			if json.Unmarshal(data, &key) == nil {
+				t.invalidate(key)
+			}
+		}
+		return true
+	})
+	if err == nil {
+		err = io.EOF
+	}
+	return err
+}
+
+// Close Stops invalidation stream, the cache keeps working in fallback mode
+func (t *nearCacheTransport) Close() error {
+	t.stop()
+	return nil
+}
+
+func (t *nearCacheTransport) subscribe(channels []string, patterns []string) (*Subscription, error) {
+	return t.stream.subscribe(channels, patterns)
+}
+
+func (t *nearCacheTransport) watch(prefix string) (*Watcher, error) {
+	return t.stream.watch(prefix)
+}
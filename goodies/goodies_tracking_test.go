@@ -0,0 +1,83 @@
+package goodies
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNearCacheInvalidation(testing *testing.T) {
+	handler := newGoodiesHTTPHandler(NewGoodiesStorage(ExpireNever))
+	var commands atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			commands.Add(1)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	config := NearCacheConfig{MaxKeys: 2, TTL: time.Minute, FallbackTTL: 100 * time.Millisecond}
+	cached := NewGoodiesClient(server.URL, WithNearCache(config))
+	near := cached.(goodiesClient).transport.(*nearCacheTransport)
+	defer cached.(goodiesClient).Close()
+	other := NewGoodiesClient(server.URL)
+
+	other.Set("flag", "on", ExpireNever)
+	if val, err := cached.Get("flag"); err != nil || val != "on" {
+		testing.Fatalf("Unexpected result of first read: %v %v", val, err)
+	}
+	waitFor(testing, "invalidation stream", func() bool {
+		near.lock.Lock()
+		defer near.lock.Unlock()
+		return near.connected
+	})
+
+	cached.Get("flag")
+	sent := commands.Load()
+	for i := 0; i < 10; i++ {
+		if val, _ := cached.Get("flag"); val != "on" {
+			testing.Fatalf("Unexpected cached value %v", val)
+		}
+	}
+	if commands.Load() != sent {
+		testing.Errorf("Cached reads reached server: %v", commands.Load()-sent)
+	}
+
+	other.Set("flag", "off", ExpireNever)
+	waitFor(testing, "invalidation of changed key", func() bool {
+		val, _ := cached.Get("flag")
+		return val == "off"
+	})
+	cached.Set("flag", "mine", ExpireNever)
+	if val, _ := cached.Get("flag"); val != "mine" {
+		testing.Errorf("Own write is expected to be visible immediately, got %v", val)
+	}
+
+	other.DictSet("dict", "field", "value")
+	cached.DictGet("dict", "field")
+	cached.ListLen("missing")
+	other.Set("third", "value", ExpireNever)
+	cached.Get("third")
+	near.lock.Lock()
+	if near.lru.Len() != config.MaxKeys {
+		testing.Errorf("Cache is expected to be bounded by %v keys, has %v", config.MaxKeys, near.lru.Len())
+	}
+	near.lock.Unlock()
+
+	// without invalidations entries live for the fallback ttl only
+	cached.(goodiesClient).Close()
+	waitFor(testing, "fallback mode", func() bool {
+		near.lock.Lock()
+		defer near.lock.Unlock()
+		return !near.connected
+	})
+	cached.Get("third")
+	other.Set("third", "changed", ExpireNever)
+	waitFor(testing, "fallback ttl expiry", func() bool {
+		val, _ := cached.Get("third")
+		return val == "changed"
+	})
+}
@@ -0,0 +1,227 @@
+package goodies
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/json"
+	"time"
+)
+
+// Codec Converts typed values to storage strings and back
+// Encoding has to be deterministic for List.RemoveValue to find equal values
+type Codec[T any] interface {
+	Encode(value T) (string, error)
+	Decode(data string) (T, error)
+}
+
+// JSONCodec Stores values as JSON
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(value T) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (JSONCodec[T]) Decode(data string) (T, error) {
+	var value T
+	err := json.Unmarshal([]byte(data), &value)
+	return value, err
+}
+
+// GobCodec Stores values as base64 encoded gob, it is not deterministic for maps
+type GobCodec[T any] struct{}
+
+func (GobCodec[T]) Encode(value T) (string, error) {
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(value); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(data.Bytes()), nil
+}
+
+func (GobCodec[T]) Decode(data string) (T, error) {
+	var value T
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return value, err
+	}
+	err = gob.NewDecoder(bytes.NewReader(raw)).Decode(&value)
+	return value, err
+}
+
+// CodecFuncs Adapts a pair of functions to Codec
+type CodecFuncs[T any] struct {
+	EncodeFunc func(T) (string, error)
+	DecodeFunc func(string) (T, error)
+}
+
+func (c CodecFuncs[T]) Encode(value T) (string, error) {
+	return c.EncodeFunc(value)
+}
+
+func (c CodecFuncs[T]) Decode(data string) (T, error) {
+	return c.DecodeFunc(data)
+}
+
+// encode Encodes the value reporting codec failures as ErrTransformation
+func encode[T any](codec Codec[T], value T) (string, error) {
+	data, err := codec.Encode(value)
+	if err != nil {
+		return "", asTransformationError(err)
+	}
+	return data, nil
+}
+
+// decode Decodes stored data reporting codec failures as ErrTransformation
+func decode[T any](codec Codec[T], data string, err error) (T, error) {
+	var value T
+	if err != nil {
+		return value, err
+	}
+	if value, err = codec.Decode(data); err != nil {
+		return value, asTransformationError(err)
+	}
+	return value, nil
+}
+
+func asTransformationError(err error) error {
+	if _, ok := err.(ErrTransformation); ok {
+		return err
+	}
+	return ErrTransformation{err.Error()}
+}
+
+// Value Typed handle of a single value item
+type Value[T any] struct {
+	provider Provider
+	key      string
+	codec    Codec[T]
+}
+
+// NewValue Creates typed handle of the value stored under key
+func NewValue[T any](provider Provider, key string, codec Codec[T]) Value[T] {
+	return Value[T]{provider, key, codec}
+}
+
+func (v Value[T]) Key() string {
+	return v.key
+}
+
+func (v Value[T]) Set(value T, ttl time.Duration) error {
+	data, err := encode(v.codec, value)
+	if err != nil {
+		return err
+	}
+	return v.provider.Set(v.key, data, ttl)
+}
+
+func (v Value[T]) Get() (T, error) {
+	data, err := v.provider.Get(v.key)
+	return decode(v.codec, data, err)
+}
+
+func (v Value[T]) Update(value T, ttl time.Duration) error {
+	data, err := encode(v.codec, value)
+	if err != nil {
+		return err
+	}
+	return v.provider.Update(v.key, data, ttl)
+}
+
+func (v Value[T]) Remove() error {
+	return v.provider.Remove(v.key)
+}
+
+// List Typed handle of a list item
+type List[T any] struct {
+	provider Provider
+	key      string
+	codec    Codec[T]
+}
+
+// NewList Creates typed handle of the list stored under key
+func NewList[T any](provider Provider, key string, codec Codec[T]) List[T] {
+	return List[T]{provider, key, codec}
+}
+
+func (l List[T]) Key() string {
+	return l.key
+}
+
+func (l List[T]) Push(value T) error {
+	data, err := encode(l.codec, value)
+	if err != nil {
+		return err
+	}
+	return l.provider.ListPush(l.key, data)
+}
+
+func (l List[T]) Len() (int, error) {
+	return l.provider.ListLen(l.key)
+}
+
+func (l List[T]) GetByIndex(index int) (T, error) {
+	data, err := l.provider.ListGetByIndex(l.key, index)
+	return decode(l.codec, data, err)
+}
+
+func (l List[T]) RemoveIndex(index int) error {
+	return l.provider.ListRemoveIndex(l.key, index)
+}
+
+func (l List[T]) RemoveValue(value T) error {
+	data, err := encode(l.codec, value)
+	if err != nil {
+		return err
+	}
+	return l.provider.ListRemoveValue(l.key, data)
+}
+
+func (l List[T]) Remove() error {
+	return l.provider.Remove(l.key)
+}
+
+// Dict Typed handle of a dictionary item, dictionary keys stay strings
+type Dict[T any] struct {
+	provider Provider
+	key      string
+	codec    Codec[T]
+}
+
+// NewDict Creates typed handle of the dictionary stored under key
+func NewDict[T any](provider Provider, key string, codec Codec[T]) Dict[T] {
+	return Dict[T]{provider, key, codec}
+}
+
+func (d Dict[T]) Key() string {
+	return d.key
+}
+
+func (d Dict[T]) Set(dictKey string, value T) error {
+	data, err := encode(d.codec, value)
+	if err != nil {
+		return err
+	}
+	return d.provider.DictSet(d.key, dictKey, data)
+}
+
+func (d Dict[T]) Get(dictKey string) (T, error) {
+	data, err := d.provider.DictGet(d.key, dictKey)
+	return decode(d.codec, data, err)
+}
+
+func (d Dict[T]) HasKey(dictKey string) (bool, error) {
+	return d.provider.DictHasKey(d.key, dictKey)
+}
+
+func (d Dict[T]) RemoveKey(dictKey string) error {
+	return d.provider.DictRemove(d.key, dictKey)
+}
+
+func (d Dict[T]) Remove() error {
+	return d.provider.Remove(d.key)
+}
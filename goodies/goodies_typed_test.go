@@ -0,0 +1,88 @@
+package goodies
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+type typedUser struct {
+	Name  string
+	Age   int
+	Roles []string
+}
+
+func TestTypedValue(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	user := typedUser{"john", 42, []string{"admin"}}
+	for _, value := range []Value[typedUser]{
+		NewValue[typedUser](storage, "json", JSONCodec[typedUser]{}),
+		NewValue[typedUser](storage, "gob", GobCodec[typedUser]{}),
+	} {
+		if err := value.Set(user, ExpireNever); err != nil {
+			testing.Fatalf("Unexpected error on typed set: %v", err)
+		}
+		got, err := value.Get()
+		if err != nil || got.Name != user.Name || got.Age != user.Age || len(got.Roles) != 1 {
+			testing.Errorf("Unexpected typed value of %v: %+v %v", value.Key(), got, err)
+		}
+	}
+
+	missing := NewValue[typedUser](storage, "missing", JSONCodec[typedUser]{})
+	if _, err := missing.Get(); err == nil {
+		testing.Error("Expected not found error")
+	} else if _, notFound := err.(ErrNotFound); !notFound {
+		testing.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	storage.Set("broken", "not a json", ExpireNever)
+	broken := NewValue[typedUser](storage, "broken", JSONCodec[typedUser]{})
+	if _, err := broken.Get(); err == nil {
+		testing.Error("Expected decode error")
+	} else if _, transformation := err.(ErrTransformation); !transformation {
+		testing.Errorf("Expected ErrTransformation, got %v", err)
+	}
+}
+
+func TestTypedListAndDict(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	ints := CodecFuncs[int]{
+		EncodeFunc: func(value int) (string, error) {
+			if value < 0 {
+				return "", errors.New("negative values are not supported")
+			}
+			return strconv.Itoa(value), nil
+		},
+		DecodeFunc: strconv.Atoi,
+	}
+
+	list := NewList[int](storage, "list", ints)
+	for _, value := range []int{1, 2, 3} {
+		list.Push(value)
+	}
+	if err := list.Push(-1); err == nil {
+		testing.Error("Expected encode error")
+	} else if _, transformation := err.(ErrTransformation); !transformation {
+		testing.Errorf("Expected ErrTransformation from encoder, got %v", err)
+	}
+	list.RemoveValue(2)
+	if size, _ := list.Len(); size != 2 {
+		testing.Errorf("Unexpected list length %v", size)
+	}
+	if value, err := list.GetByIndex(1); err != nil || value != 3 {
+		testing.Errorf("Unexpected list item: %v %v", value, err)
+	}
+
+	dict := NewDict[typedUser](storage, "users", JSONCodec[typedUser]{})
+	dict.Set("john", typedUser{Name: "john", Age: 42})
+	if user, err := dict.Get("john"); err != nil || user.Age != 42 {
+		testing.Errorf("Unexpected dict item: %+v %v", user, err)
+	}
+	if has, _ := dict.HasKey("jane"); has {
+		testing.Error("Unexpected dict key")
+	}
+	dict.RemoveKey("john")
+	if _, err := dict.Get("john"); err == nil {
+		testing.Error("Expected removed dict key to be missing")
+	}
+}
@@ -0,0 +1,125 @@
+package goodies
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// watcherBufferSize Amount of events kept for a slow watcher before it is considered lost
+const watcherBufferSize = 1024
+
+// KeyEventType Kind of change happened to a key
+type KeyEventType string
+
+const (
+	// KeySet Item was created or overwritten
+	KeySet KeyEventType = "set"
+	// KeyUpdated Existing item was modified (value, list or dictionary content, expiry)
+	KeyUpdated KeyEventType = "updated"
+	// KeyRemoved Item was removed explicitly
+	KeyRemoved KeyEventType = "removed"
+	// KeyExpired Item was removed because its ttl passed (either on access or by cleanup)
+	KeyExpired KeyEventType = "expired"
+	// KeyEvicted Item was removed to free up resources
+	KeyEvicted KeyEventType = "evicted"
+)
+
+// KeyEvent Notification about a key change
+type KeyEvent struct {
+	Type KeyEventType
+	Key  string
+	Time time.Time
+}
+
+// Watchable is implemented by anything able to stream key change notifications
+// (GoodiesStorage in-process and the client returned from NewGoodiesClient)
+type Watchable interface {
+	Watch(prefix string) (*Watcher, error)
+}
+
+// Watcher Stream of key events for keys starting with a prefix
+// Events channel is closed when watcher is closed or lost (see Err)
+type Watcher struct {
+	events chan KeyEvent
+	once   sync.Once
+	stop   func()
+	lock   sync.Mutex
+	err    error
+}
+
+func newWatcher() *Watcher {
+	return &Watcher{events: make(chan KeyEvent, watcherBufferSize)}
+}
+
+// Events Returns channel delivering key events
+func (w *Watcher) Events() <-chan KeyEvent {
+	return w.events
+}
+
+// Close Stops watching
+func (w *Watcher) Close() {
+	w.once.Do(w.stop)
+}
+
+// Err Returns the reason watcher stopped if it was not closed by the caller
+// Consumers relying on events completeness (e.g. caches) should treat it as a signal to resync
+func (w *Watcher) Err() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.err
+}
+
+func (w *Watcher) setErr(err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.err = err
+}
+
+// keyWatchers Registry of watchers by key prefix
+type keyWatchers struct {
+	lock     sync.Mutex
+	watchers map[*Watcher]string
+}
+
+// Watch Starts streaming events for all keys starting with prefix (empty prefix watches everything)
+func (g *GoodiesStorage) Watch(prefix string) (*Watcher, error) {
+	watcher := newWatcher()
+	watcher.stop = func() {
+		g.watchers.lock.Lock()
+		defer g.watchers.lock.Unlock()
+		if _, ok := g.watchers.watchers[watcher]; ok {
+			delete(g.watchers.watchers, watcher)
+			close(watcher.events)
+		}
+	}
+
+	g.watchers.lock.Lock()
+	defer g.watchers.lock.Unlock()
+	g.watchers.watchers[watcher] = prefix
+	return watcher, nil
+}
+
+// emit Notifies watchers about a key change
+// Watchers which are not keeping up are dropped instead of blocking storage
+func (g *GoodiesStorage) emit(eventType KeyEventType, key string) {
+	g.notifyObservers(key)
+	g.watchers.lock.Lock()
+	defer g.watchers.lock.Unlock()
+	if len(g.watchers.watchers) == 0 {
+		return
+	}
+	event := KeyEvent{eventType, key, time.Now()}
+	for watcher, prefix := range g.watchers.watchers {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		select {
+		case watcher.events <- event:
+		default:
+			watcher.setErr(ErrInternalError{"Watcher is not keeping up, events were lost"})
+			delete(g.watchers.watchers, watcher)
+			close(watcher.events)
+		}
+	}
+}
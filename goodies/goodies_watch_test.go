@@ -0,0 +1,99 @@
+package goodies
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func expectKeyEvent(testing *testing.T, watcher *Watcher, eventType KeyEventType, key string) {
+	select {
+	case event := <-watcher.Events():
+		if event.Type != eventType || event.Key != key {
+			testing.Errorf("Expected %v event for %v but received %v for %v", eventType, key, event.Type, event.Key)
+		}
+	case <-time.After(time.Second):
+		testing.Errorf("Expected %v event for %v was not delivered", eventType, key)
+	}
+}
+
+func TestWatchMutations(testing *testing.T) {
+	goodies := NewGoodiesStorage(ExpireNever)
+	watcher, _ := goodies.Watch("user:")
+	defer watcher.Close()
+
+	goodies.Set("other", "1", ExpireNever)
+	goodies.Set("user:1", "1", ExpireNever)
+	expectKeyEvent(testing, watcher, KeySet, "user:1")
+	goodies.Update("user:1", "2", ExpireNever)
+	expectKeyEvent(testing, watcher, KeyUpdated, "user:1")
+	goodies.DictSet("user:2", "name", "Dude")
+	expectKeyEvent(testing, watcher, KeySet, "user:2")
+	goodies.DictRemove("user:2", "name")
+	expectKeyEvent(testing, watcher, KeyUpdated, "user:2")
+	goodies.Remove("user:1")
+	expectKeyEvent(testing, watcher, KeyRemoved, "user:1")
+
+	goodies.Set("user:3", "1", 10*time.Millisecond)
+	expectKeyEvent(testing, watcher, KeySet, "user:3")
+	<-time.After(20 * time.Millisecond)
+	if _, err := goodies.Get("user:3"); err == nil {
+		testing.Error("Expired item is still returned")
+	}
+	expectKeyEvent(testing, watcher, KeyExpired, "user:3")
+
+	goodies.ListPush("user:4", "1")
+	expectKeyEvent(testing, watcher, KeySet, "user:4")
+	goodies.SetExpiry("user:4", 10*time.Millisecond)
+	expectKeyEvent(testing, watcher, KeyUpdated, "user:4")
+	<-time.After(20 * time.Millisecond)
+	goodies.cleanupOutdated()
+	expectKeyEvent(testing, watcher, KeyExpired, "user:4")
+}
+
+func TestWatchSnapshotLoad(testing *testing.T) {
+	source := NewGoodiesStorage(ExpireNever)
+	source.Set("user:1", "new", ExpireNever)
+	source.CreateDatabase("staging", ExpireNever)
+	staging, _ := source.Database("staging")
+	staging.Set("user:3", "1", ExpireNever)
+	var snapshot bytes.Buffer
+	source.writeSnapshot(&snapshot)
+
+	goodies := NewGoodiesStorage(ExpireNever)
+	goodies.Set("user:2", "old", ExpireNever)
+	goodies.CreateDatabase("staging", ExpireNever)
+	loadedStaging, _ := goodies.Database("staging")
+	watcher, _ := goodies.Watch("user:")
+	defer watcher.Close()
+	stagingWatcher, _ := loadedStaging.Watch("user:")
+	defer stagingWatcher.Close()
+
+	if err := goodies.loadSnapshot(&snapshot); err != nil {
+		testing.Fatalf("Unexpected error on load: %v", err)
+	}
+	expectKeyEvent(testing, watcher, KeyRemoved, "user:2")
+	expectKeyEvent(testing, watcher, KeySet, "user:1")
+	expectKeyEvent(testing, stagingWatcher, KeySet, "user:3")
+	if val, err := loadedStaging.Get("user:3"); err != nil || val != "1" {
+		testing.Errorf("Database is expected to be loaded in place: %v %v", val, err)
+	}
+}
+
+func TestWatchOverHTTP(testing *testing.T) {
+	storage := NewGoodiesStorage(ExpireNever)
+	server := httptest.NewServer(newGoodiesHTTPHandler(storage))
+	defer server.Close()
+	client := NewGoodiesClient(server.URL)
+
+	watcher, err := client.(Watchable).Watch("flags:")
+	if err != nil {
+		testing.Fatalf("Unexpected error on watch: %v", err)
+	}
+	defer watcher.Close()
+	client.Set("flags:dark-mode", "on", ExpireNever)
+	expectKeyEvent(testing, watcher, KeySet, "flags:dark-mode")
+	client.Remove("flags:dark-mode")
+	expectKeyEvent(testing, watcher, KeyRemoved, "flags:dark-mode")
+}